@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"strange-errors-server/internal/conformance"
+	"strange-errors-server/internal/openapi"
+)
+
+// runCheckSpec implements "strange-errors-server check-spec": it drives every
+// operation of an API description against a running server and prints where
+// the server departs from it. It exits 1 if there are findings. Requests
+// that may change the server's state are only sent with -mutating.
+func runCheckSpec(args []string) int {
+	fs := flag.NewFlagSet("check-spec", flag.ContinueOnError)
+	target := fs.String("url", "http://localhost:3000", "base URL of a running server")
+	spec := fs.String("spec", "docs/swagger.json", "OpenAPI 2/3 document, JSON or YAML")
+	token := fs.String("token", "", "bearer token sent with every request")
+	methods := fs.String("methods", "", "comma-separated extra methods to try on every documented path (default GOAT with -mutating)")
+	mutating := fs.Bool("mutating", false, "also send requests that change the server's state: examples for POST, PUT, PATCH and DELETE, and GOAT")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	doc, err := openapi.Load(*spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check-spec: %v\n", err)
+		return 2
+	}
+	base, err := url.Parse(*target)
+	if err != nil || base.Host == "" {
+		fmt.Fprintf(os.Stderr, "check-spec: invalid url %q\n", *target)
+		return 2
+	}
+
+	checker := conformance.NewChecker(doc, base, &http.Client{Timeout: 10 * time.Second})
+	if *token != "" {
+		checker.SetHeader("Authorization", "Bearer "+*token)
+	}
+	checker.SetMutating(*mutating)
+	if *methods == "" && *mutating {
+		*methods = "GOAT"
+	}
+	var extra []string
+	for _, method := range strings.Split(*methods, ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			extra = append(extra, strings.ToUpper(method))
+		}
+	}
+	checker.SetProbeMethods(extra)
+
+	report := checker.Run(context.Background())
+	report.Document = *spec
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		conformance.WriteText(os.Stdout, report)
+	}
+	if len(report.Findings) > 0 {
+		return 1
+	}
+	return 0
+}
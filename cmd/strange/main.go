@@ -0,0 +1,381 @@
+// Command strange exercises a Strange Errors Server and prints every response
+// side by side with the outcome the HTTP RFCs call for, so that the fallacies
+// are visible at a glance.
+//
+// Usage:
+//
+//	strange [-url URL] [-token TOKEN] [-api-key KEY] [-json] [-no-color] COMMAND ...
+//
+//	strange articles list
+//	strange articles create -title T -content C
+//	strange articles delete ID
+//	strange users create -name N -email E [-password P] [-role R]
+//	strange users delete ID
+//	strange goat [-n CALLS]
+//	strange health
+//	strange request METHOD PATH [-d BODY] [-expect CODES]
+//
+// Every command but request takes -X METHOD to send a different, possibly
+// custom, method to the same path. strange exits 1 if any response departs
+// from the RFCs and 2 on usage and connection errors.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"strange-errors-server/internal/inspect"
+)
+
+// errUsage is returned for invalid command lines; the flag package has
+// already explained what is wrong
+var errUsage = errors.New("usage")
+
+// client holds the global flags
+type client struct {
+	base   string
+	token  string
+	apiKey string
+	asJSON bool
+	color  bool
+	http   *http.Client
+	out    io.Writer
+
+	discrepancies int
+	results       []*inspect.Result
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+// run parses the command line and runs a command, returning the exit code
+func run(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("strange", flag.ContinueOnError)
+	fs.Usage = func() { usage(fs) }
+	base := fs.String("url", envOr("STRANGE_URL", "http://localhost:3000"), "base URL of the server (env STRANGE_URL)")
+	token := fs.String("token", os.Getenv("STRANGE_TOKEN"), "bearer token (env STRANGE_TOKEN)")
+	apiKey := fs.String("api-key", os.Getenv("STRANGE_API_KEY"), "API key sent as X-API-Key (env STRANGE_API_KEY)")
+	asJSON := fs.Bool("json", false, "print results as JSON")
+	noColor := fs.Bool("no-color", false, "never color the output")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return 2
+	}
+
+	c := &client{
+		base:   strings.TrimSuffix(*base, "/"),
+		token:  *token,
+		apiKey: *apiKey,
+		asJSON: *asJSON,
+		color:  !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(out),
+		http:   &http.Client{Timeout: 10 * time.Second},
+		out:    out,
+	}
+
+	var err error
+	command, rest := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "articles":
+		err = c.articles(rest)
+	case "users":
+		err = c.users(rest)
+	case "goat":
+		err = c.goat(rest)
+	case "health":
+		err = c.health(rest)
+	case "request":
+		err = c.request(rest)
+	default:
+		fmt.Fprintf(os.Stderr, "strange: unknown command %q\n", command)
+		usage(fs)
+		return 2
+	}
+
+	if c.asJSON && len(c.results) > 0 {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		enc.Encode(c.results)
+	}
+	switch {
+	case errors.Is(err, errUsage):
+		return 2
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "strange: %v\n", err)
+		return 2
+	case c.discrepancies > 0:
+		return 1
+	}
+	return 0
+}
+
+// usage prints the commands and global flags
+func usage(fs *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, `Usage: strange [flags] COMMAND ...
+
+Commands:
+  articles list                                 GET /api/articles
+  articles create -title T -content C           POST /api/article
+  articles delete ID                            DELETE /api/article/ID
+  users create -name N -email E [-password P] [-role R]
+                                                POST /api/user
+  users delete ID                               DELETE /api/user/ID
+  goat [-n CALLS]                               GOAT /api/health-check
+  health                                        GET /api/health-check
+  request METHOD PATH [-d BODY] [-expect CODES] any method, any path
+
+Every command but request takes -X METHOD to send another method.
+
+Flags:
+`)
+	fs.PrintDefaults()
+}
+
+// articles implements "strange articles list|create|delete"
+func (c *client) articles(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "strange articles: want list, create or delete")
+		return errUsage
+	}
+	switch args[0] {
+	case "list":
+		fs, method := commandFlags("articles list", "GET")
+		if err := fs.Parse(args[1:]); err != nil {
+			return errUsage
+		}
+		return c.send(*method, "GET", "/api/articles", nil, inspect.Expect("RFC 9110 §15.3.1", 200))
+
+	case "create":
+		fs, method := commandFlags("articles create", "POST")
+		title := fs.String("title", "", "article title")
+		content := fs.String("content", "", "article content")
+		if err := fs.Parse(args[1:]); err != nil {
+			return errUsage
+		}
+		exp := inspect.Expect("RFC 9110 §15.3.2", 201)
+		if *title == "" || *content == "" {
+			exp = inspect.Expect("RFC 9110 §15.5.1, title and content are required", 400, 422)
+		}
+		return c.send(*method, "POST", "/api/article", map[string]string{"title": *title, "content": *content}, exp)
+
+	case "delete":
+		fs, method := commandFlags("articles delete", "DELETE")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "strange articles delete: want an article ID")
+			return errUsage
+		}
+		return c.send(*method, "DELETE", "/api/article/"+fs.Arg(0), nil, deleteExpectation(fs.Arg(0)))
+	}
+	fmt.Fprintf(os.Stderr, "strange articles: unknown command %q\n", args[0])
+	return errUsage
+}
+
+// users implements "strange users create|delete"
+func (c *client) users(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "strange users: want create or delete")
+		return errUsage
+	}
+	switch args[0] {
+	case "create":
+		fs, method := commandFlags("users create", "POST")
+		name := fs.String("name", "", "user name")
+		email := fs.String("email", "", "email address")
+		password := fs.String("password", "", "password for POST /api/login")
+		role := fs.String("role", "", "reader, editor or admin")
+		if err := fs.Parse(args[1:]); err != nil {
+			return errUsage
+		}
+		exp := inspect.Expect("RFC 9110 §15.3.2, or §15.5.10 if the name is taken", 201, 409)
+		switch {
+		case *name == "" || *email == "":
+			exp = inspect.Expect("RFC 9110 §15.5.1, name and email are required", 400, 422)
+		case !validEmail(*email):
+			exp = inspect.Expect("RFC 9110 §15.5.1, the email address is invalid", 400, 422)
+		}
+		body := map[string]string{"name": *name, "email": *email}
+		if *password != "" {
+			body["password"] = *password
+		}
+		if *role != "" {
+			body["role"] = *role
+		}
+		return c.send(*method, "POST", "/api/user", body, exp)
+
+	case "delete":
+		fs, method := commandFlags("users delete", "DELETE")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "strange users delete: want a user ID")
+			return errUsage
+		}
+		return c.send(*method, "DELETE", "/api/user/"+fs.Arg(0), nil, deleteExpectation(fs.Arg(0)))
+	}
+	fmt.Fprintf(os.Stderr, "strange users: unknown command %q\n", args[0])
+	return errUsage
+}
+
+// goat implements "strange goat": the custom GOAT method, as many times as asked
+func (c *client) goat(args []string) error {
+	fs, method := commandFlags("goat", "GOAT")
+	calls := fs.Int("n", 1, "number of calls")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	// Extension methods are fine (RFC 9110 §16.1), but calling one again
+	// does not make the request malformed, nor is it the server's fault
+	exp := inspect.Expect("RFC 9110 §15.5.1 reserves 400 for malformed requests; repeated calls are a 429 (RFC 6585 §4)", 200, 429)
+	for i := 0; i < *calls; i++ {
+		if i > 0 && !c.asJSON {
+			fmt.Fprintln(c.out, strings.Repeat("─", 72))
+		}
+		if err := c.send(*method, "GOAT", "/api/health-check", nil, exp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// health implements "strange health"
+func (c *client) health(args []string) error {
+	fs, method := commandFlags("health", "GET")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return c.send(*method, "GET", "/api/health-check", nil, inspect.Expect("RFC 9110 §15.3.1", 200))
+}
+
+// request implements "strange request METHOD PATH": anything the other
+// commands do not cover
+func (c *client) request(args []string) error {
+	fs := flag.NewFlagSet("request", flag.ContinueOnError)
+	data := fs.String("d", "", "request body, sent as JSON")
+	expect := fs.String("expect", "", "comma-separated acceptable status codes")
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "strange request: want METHOD PATH")
+		return errUsage
+	}
+	method, path := strings.ToUpper(args[0]), args[1]
+	if err := fs.Parse(args[2:]); err != nil {
+		return errUsage
+	}
+
+	var exp inspect.Expectation
+	for _, code := range strings.Split(*expect, ",") {
+		if code = strings.TrimSpace(code); code == "" {
+			continue
+		}
+		n, err := strconv.Atoi(code)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "strange request: invalid status code %q\n", code)
+			return errUsage
+		}
+		exp.Statuses = append(exp.Statuses, n)
+		exp.Why = "-expect"
+	}
+
+	var body any
+	if *data != "" {
+		body = json.RawMessage(*data)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return c.send(method, method, path, body, exp)
+}
+
+// send sends one request and prints the result. When method differs from
+// the one the path is meant for, the RFCs call for a 405 or a 501 instead.
+func (c *client) send(method, natural, path string, body any, exp inspect.Expectation) error {
+	method = strings.ToUpper(method)
+	if method != natural {
+		exp = inspect.Expect(fmt.Sprintf("RFC 9110 §15.5.6, the path serves %s", natural), 405, 501)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	res, err := inspect.Do(c.http, req, exp)
+	if err != nil {
+		return err
+	}
+	c.discrepancies += len(res.Discrepancies)
+	if c.asJSON {
+		c.results = append(c.results, res)
+		return nil
+	}
+	inspect.WriteText(c.out, res, c.color)
+	return nil
+}
+
+// commandFlags creates the flag set of a command, with -X to override its method
+func commandFlags(name, method string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return fs, fs.String("X", method, "send this method instead, e.g. GOAT")
+}
+
+// deleteExpectation is what deleting the resource with id should produce
+func deleteExpectation(id string) inspect.Expectation {
+	if _, err := strconv.Atoi(id); err != nil {
+		return inspect.Expect("RFC 9110 §15.5.1, a malformed ID is the client's fault", 400, 404)
+	}
+	return inspect.Expect("RFC 9110 §9.3.5, or §15.5.5 if it does not exist", 200, 204, 404)
+}
+
+// validEmail reports whether an email address has a local part and a dotted domain
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return false
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	return strings.Contains(domain, ".")
+}
+
+// envOr returns an environment variable, or fallback if it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// isTerminal reports whether w is a terminal, where color makes sense
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
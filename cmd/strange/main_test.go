@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/health-check":
+			w.WriteHeader(200)
+			w.Write([]byte(`{"status":"OK"}`))
+		case "GET /api/articles":
+			w.WriteHeader(777)
+			w.Write([]byte(`{"message":"Articles retrieved"}`))
+		default:
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(405)
+			w.Write([]byte(`{"error":"method not allowed"}`))
+		}
+	}))
+	defer srv.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"honest response", []string{"-url", srv.URL, "health"}, 0},
+		{"honest 405 for another method", []string{"-url", srv.URL, "health", "-X", "PATCH"}, 0},
+		{"status code 777", []string{"-url", srv.URL, "articles", "list"}, 1},
+		{"unexpected status code", []string{"-url", srv.URL, "request", "GET", "/api/health-check", "-expect", "204"}, 1},
+		{"discrepancies as JSON", []string{"-url", srv.URL, "-json", "articles", "list"}, 1},
+		{"no command", []string{"-url", srv.URL}, 2},
+		{"unknown command", []string{"-url", srv.URL, "frobnicate"}, 2},
+		{"unknown flag", []string{"-frobnicate"}, 2},
+		{"missing article ID", []string{"-url", srv.URL, "articles", "delete"}, 2},
+		{"invalid -expect", []string{"-url", srv.URL, "request", "GET", "/", "-expect", "abc"}, 2},
+		{"connection refused", []string{"-url", closed.URL, "health"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if got := run(tt.args, &out); got != tt.want {
+				t.Errorf("run(%q) = %d, want %d\n%s", tt.args, got, tt.want, out.String())
+			}
+		})
+	}
+}
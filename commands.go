@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"strange-errors-server/internal/config"
+	"strange-errors-server/internal/database"
+	"strange-errors-server/internal/seed"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// command is a subcommand of the server binary
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order usage shows them
+func commands() []command {
+	return []command{
+		{"serve", "run the server (the default)", runServe},
+		{"migrate", "create the database or bring its schema up to date", runMigrate},
+		{"seed", "add articles and users from a YAML or JSON file", runSeed},
+		{"snapshot", "copy the database to a file while it is in use", runSnapshot},
+		{"export", "write every article and user as JSON or YAML", runExport},
+		{"check-spec", "compare an OpenAPI document with a running server", runCheckSpec},
+		{"report", "print the status classification of a running server", runReport},
+		{"version", "print version information", runVersion},
+	}
+}
+
+// run dispatches to a subcommand. Without one, or when the first argument
+// is a flag, the server is started.
+func run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" && args[0] != "--help" {
+		return runServe(args)
+	}
+	name := args[0]
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage(os.Stdout)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage(os.Stderr)
+	return 2
+}
+
+// usage lists the subcommands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: strange-errors-server [COMMAND] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run \"strange-errors-server COMMAND -h\" for the flags of a command. Every")
+	fmt.Fprintln(w, "setting can come from a config file (-config), an environment variable or")
+	fmt.Fprintln(w, "a flag, the latter winning.")
+}
+
+// loadConfig registers the configuration flags and -print-config on fs,
+// parses args and loads the configuration. The loader can load it again
+// later. A nil configuration means the command is done and should return
+// code.
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, *config.Loader, int) {
+	loader := config.NewLoader(fs)
+	printConfig := fs.Bool("print-config", false, "print the effective configuration as a config file and exit")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, 0
+		}
+		return nil, nil, 2
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid configuration:\n%v\n", fs.Name(), err)
+		return nil, nil, 2
+	}
+	if *printConfig {
+		cfg.Write(os.Stdout)
+		return nil, nil, 0
+	}
+	return cfg, loader, 0
+}
+
+// runMigrate implements "strange-errors-server migrate". Opening the
+// database creates missing tables and columns.
+func runMigrate(args []string) int {
+	cfg, _, code := loadConfig(flag.NewFlagSet("migrate", flag.ContinueOnError), args)
+	if cfg == nil {
+		return code
+	}
+	db, err := database.New(cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	fmt.Printf("✅ Database schema of %s is up to date\n", cfg.DBPath)
+	return 0
+}
+
+// runSeed implements "strange-errors-server seed"
+func runSeed(args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := fs.String("file", "", "YAML or JSON file with articles and users, as written by export")
+	reset := fs.Bool("reset", false, "empty the database first")
+	cfg, _, code := loadConfig(fs, args)
+	if cfg == nil {
+		return code
+	}
+
+	data := &seed.Data{}
+	if *file != "" {
+		loaded, err := seed.Load(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+			return 1
+		}
+		data = loaded
+	}
+
+	db, err := database.New(cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := seed.Apply(context.Background(), db, data, *reset); err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		return 1
+	}
+	if cfg.AdminPassword != "" {
+		if err := ensureAdmin(db, cfg.AdminPassword); err != nil {
+			fmt.Fprintf(os.Stderr, "seed: failed to create admin user: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Printf("🌱 Seeded %s with %d articles and %d users\n", cfg.DBPath, len(data.Articles), len(data.Users))
+	return 0
+}
+
+// runSnapshot implements "strange-errors-server snapshot"
+func runSnapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	out := fs.String("o", "", "file to write, database-<time>.db by default; must not exist")
+	cfg, _, code := loadConfig(fs, args)
+	if cfg == nil {
+		return code
+	}
+	if *out == "" {
+		*out = "database-" + time.Now().Format("20060102-150405") + ".db"
+	}
+
+	db, err := database.New(cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "snapshot: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	if err := db.Snapshot(context.Background(), *out); err != nil {
+		fmt.Fprintf(os.Stderr, "snapshot: %v\n", err)
+		return 1
+	}
+	fmt.Printf("📸 Snapshot of %s written to %s\n", cfg.DBPath, *out)
+	return 0
+}
+
+// runExport implements "strange-errors-server export". The output can be
+// fed back with "seed -reset -file".
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "json", "json or yaml")
+	out := fs.String("o", "", "file to write instead of stdout")
+	cfg, _, code := loadConfig(fs, args)
+	if cfg == nil {
+		return code
+	}
+	if *format != "json" && *format != "yaml" {
+		fmt.Fprintf(os.Stderr, "export: unknown format %q (want json or yaml)\n", *format)
+		return 2
+	}
+
+	db, err := database.New(cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	data, err := seed.Export(context.Background(), db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+
+	var encoded []byte
+	if *format == "yaml" {
+		encoded, err = yaml.Marshal(data)
+	} else {
+		encoded, err = json.MarshalIndent(data, "", "  ")
+		encoded = append(encoded, '\n')
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+
+	if *out == "" {
+		os.Stdout.Write(encoded)
+		return 0
+	}
+	if err := os.WriteFile(*out, encoded, 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runVersion implements "strange-errors-server version"
+func runVersion(args []string) int {
+	fmt.Printf("strange-errors-server %s (%s %s/%s", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		var revision, modified string
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				revision = s.Value
+			case "vcs.modified":
+				modified = s.Value
+			}
+		}
+		if revision != "" {
+			fmt.Printf(", commit %.12s", revision)
+			if modified == "true" {
+				fmt.Print(" with local changes")
+			}
+		}
+	}
+	fmt.Println(")")
+	return 0
+}
@@ -24,8 +24,103 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/admin/recording": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns every recorded exchange with headers, bodies, timing and the quirks applied to it. Credentials in headers are redacted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Download recorded traffic",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "har (default) or jsonl",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HAR 1.2 archive",
+                        "schema": {
+                            "$ref": "#/definitions/traffic.HAR"
+                        }
+                    },
+                    "400": {
+                        "description": "Unknown format",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Forgets every recorded exchange so that a new session starts from scratch.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Clear recorded traffic",
+                "responses": {
+                    "200": {
+                        "description": "Recording cleared",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/sandboxes": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists every sandbox, most recently used first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List sandboxes",
+                "responses": {
+                    "200": {
+                        "description": "Sandboxes",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.SandboxInfo"
+                            }
+                        }
+                    }
+                }
+            }
+        },
         "/api/article": {
             "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Creates a new article in the database. ID is generated by the server.",
                 "consumes": [
                     "application/json"
@@ -72,6 +167,11 @@ const docTemplate = `{
         },
         "/api/article/{id}": {
             "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Deletes an article by ID from the database.",
                 "consumes": [
                     "application/json"
@@ -143,72 +243,232 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/health-check": {
+        "/api/challenge/dashboard": {
             "get": {
-                "description": "Performs a regular health check of the server",
-                "consumes": [
+                "description": "An HTML page with every trainee's requests, GOAT stage, discovered defects and score. It updates itself from /api/challenge/dashboard/events and needs nothing but the server. Add format=json for the same data as JSON.",
+                "produces": [
+                    "text/html",
+                    "application/json"
+                ],
+                "tags": [
+                    "challenge"
+                ],
+                "summary": "Instructor dashboard",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Set to json for the data behind the page",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Dashboard",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Dashboard"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/challenge/dashboard/events": {
+            "get": {
+                "description": "A Server-Sent Events stream. Every \"standings\" event carries the rendered trainee table, sent on connect and whenever traffic is recorded or a submission comes in.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "challenge"
+                ],
+                "summary": "Dashboard updates",
+                "responses": {
+                    "200": {
+                        "description": "Event stream",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/challenge/defects": {
+            "get": {
+                "description": "Lists the behaviors that may hide a planted defect: wrong status codes, idempotency violations and GOAT side effects. Some entries are honeypots, correct behavior that costs points when reported.",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "challenge"
+                ],
+                "summary": "List the challenge catalog",
+                "responses": {
+                    "200": {
+                        "description": "Catalog entries",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/challenge.Defect"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/challenge/scores": {
+            "get": {
+                "description": "Lists every trainee's points, best first, without revealing what they found.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "health"
+                    "challenge"
                 ],
-                "summary": "Health check",
+                "summary": "Challenge leaderboard",
                 "responses": {
                     "200": {
-                        "description": "Server is healthy",
+                        "description": "Scores",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/challenge.Score"
+                            }
                         }
                     }
                 }
             },
-            "post": {
-                "description": "Demonstrates progressive server behavior with a custom GOAT HTTP method. Use: curl -X GOAT http://localhost:3000/api/health-check",
-                "consumes": [
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Forgets every score and every cited request ID.",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "challenge"
+                ],
+                "summary": "Reset the challenge",
+                "responses": {
+                    "200": {
+                        "description": "Scores cleared",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/challenge/scores/{trainee}": {
+            "get": {
+                "description": "Returns a trainee's points together with the defects they found and the honeypots they fell for.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "health"
+                    "challenge"
+                ],
+                "summary": "Trainee progress",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Trainee name",
+                        "name": "trainee",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "GOAT method (Custom HTTP Method)",
                 "responses": {
                     "200": {
-                        "description": "First call - Happy GOAT",
+                        "description": "Progress",
                         "schema": {
-                            "$ref": "#/definitions/models.GoatResponse"
+                            "$ref": "#/definitions/challenge.Score"
                         }
                     },
-                    "400": {
-                        "description": "Second/Third call - Annoyed/Upset GOAT",
+                    "404": {
+                        "description": "No submissions from this trainee",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/challenge/submissions": {
+            "post": {
+                "description": "Reports a defect by catalog ID or free description, citing the X-Request-ID of the exchanges that show it. The report is verified against the recorded traffic. Logged-in users are scored under their user name, anonymous ones under the trainee field or the X-Trainee header. Only requests recorded under the same name count as evidence. Anonymous names are taken on trust, so in a workshop where that matters, give trainees accounts and have them log in.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "challenge"
+                ],
+                "summary": "Report a defect",
+                "parameters": [
+                    {
+                        "description": "Finding with evidence request IDs",
+                        "name": "submission",
+                        "in": "body",
+                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.GoatResponse"
+                            "$ref": "#/definitions/challenge.Submission"
                         }
                     },
-                    "500": {
-                        "description": "Fourth call - Enraged GOAT",
+                    {
+                        "type": "string",
+                        "description": "Trainee name when there is none in the body",
+                        "name": "X-Trainee",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Verdict, accepted or not",
                         "schema": {
-                            "$ref": "#/definitions/models.GoatResponse"
+                            "$ref": "#/definitions/challenge.Verdict"
                         }
                     },
-                    "503": {
-                        "description": "Fifth call - Fatal GOAT",
+                    "400": {
+                        "description": "Malformed submission",
                         "schema": {
-                            "$ref": "#/definitions/models.GoatResponse"
+                            "$ref": "#/definitions/models.APIResponse"
                         }
                     }
                 }
             }
         },
-        "/api/user": {
+        "/api/health-check": {
+            "get": {
+                "description": "Performs a regular health check of the server. The same path answers the custom GOAT method, which Swagger 2.0 cannot describe: see /openapi.json.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "Server is healthy",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/login": {
             "post": {
-                "description": "Creates a new user if the name doesn't already exist. This demonstrates idempotent POST behavior - calling multiple times with the same name will return an error instead of creating duplicates.",
+                "description": "Exchanges a user name and password for an HMAC-signed bearer token.",
                 "consumes": [
                     "application/json"
                 ],
@@ -216,79 +476,564 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "auth"
                 ],
-                "summary": "Create a new user (Idempotent POST)",
+                "summary": "Log in",
                 "parameters": [
                     {
-                        "description": "User data (name and email required)",
-                        "name": "user",
+                        "description": "User name and password",
+                        "name": "credentials",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.CreateUserRequest"
+                            "$ref": "#/definitions/models.LoginRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "User created successfully",
+                    "200": {
+                        "description": "Token issued",
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "$ref": "#/definitions/models.LoginResponse"
                         }
                     },
                     "400": {
-                        "description": "User already exists or invalid data",
+                        "description": "Invalid request data",
                         "schema": {
                             "$ref": "#/definitions/models.APIResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal server error (wrong status for invalid email)",
+                    "401": {
+                        "description": "Invalid credentials",
                         "schema": {
                             "$ref": "#/definitions/models.APIResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.APIResponse": {
-            "type": "object",
-            "properties": {
-                "data": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/models.Article"
-                    }
-                },
-                "error": {
-                    "type": "string"
-                },
-                "message": {
-                    "type": "string"
-                },
-                "status": {
-                    "type": "string"
-                }
-            }
         },
-        "models.Article": {
-            "type": "object",
-            "properties": {
-                "content": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "integer"
-                },
-                "title": {
-                    "type": "string"
+        "/api/reports/classification": {
+            "get": {
+                "description": "Replays recorded traffic through several success/error classification rules (first digit, IANA registry, body \"status\" field, intended status) and lists the exchanges they disagree on.",
+                "produces": [
+                    "application/json",
+                    "text/plain"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Status classification report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Set to text for a plain-text table",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Classification report",
+                        "schema": {
+                            "$ref": "#/definitions/report.Classification"
+                        }
+                    }
                 }
             }
         },
-        "models.CreateArticleRequest": {
+        "/api/sandbox": {
+            "get": {
+                "description": "Describes the sandbox the request belongs to, creating it if needed: its quirk profile and difficulty, how annoyed its GOAT is and when it is dropped for inactivity.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sandbox"
+                ],
+                "summary": "Show your sandbox",
+                "responses": {
+                    "200": {
+                        "description": "Sandbox",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SandboxInfo"
+                        }
+                    },
+                    "404": {
+                        "description": "The request names no sandbox",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Switches the quirk profile of the sandbox the request belongs to, by name or by difficulty: beginner (strange) uses obviously wrong codes, intermediate (plausible) believable but wrong ones and expert (subtle) correct codes with bugs in bodies, headers, ordering and timing. Other sandboxes are not affected.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sandbox"
+                ],
+                "summary": "Change your sandbox",
+                "parameters": [
+                    {
+                        "description": "New settings",
+                        "name": "settings",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SandboxSettings"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Sandbox",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SandboxInfo"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid settings",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "The request names no sandbox",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Drops the sandbox the request belongs to. The next request gets a fresh copy of the seed data and a calm GOAT.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sandbox"
+                ],
+                "summary": "Drop your sandbox",
+                "responses": {
+                    "200": {
+                        "description": "Sandbox dropped",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "The request names no sandbox",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user": {
+            "post": {
+                "description": "Creates a new user if the name doesn't already exist. This demonstrates idempotent POST behavior - calling multiple times with the same name will return an error instead of creating duplicates.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Create a new user (Idempotent POST)",
+                "parameters": [
+                    {
+                        "description": "User data (name and email required, password optional)",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CreateUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "User created successfully, including a one-time API key",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    },
+                    "400": {
+                        "description": "User already exists or invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Only admins can hand out editor and admin roles",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error (wrong status for invalid email)",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a user by ID. Requires the admin role when authentication is enabled.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Delete a user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User deleted successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "challenge.Defect": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "challenge.Finding": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "defect_id": {
+                    "type": "string"
+                },
+                "evidence": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "points": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "challenge.Score": {
+            "type": "object",
+            "properties": {
+                "false_positives": {
+                    "description": "honeypots reported as defects",
+                    "type": "integer"
+                },
+                "findings": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/challenge.Finding"
+                    }
+                },
+                "found": {
+                    "type": "integer"
+                },
+                "honeypots": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "last_active": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "integer"
+                },
+                "rejected": {
+                    "type": "integer"
+                },
+                "remaining": {
+                    "description": "defects not found yet",
+                    "type": "integer"
+                },
+                "submissions": {
+                    "type": "integer"
+                },
+                "trainee": {
+                    "type": "string"
+                }
+            }
+        },
+        "challenge.Submission": {
+            "type": "object",
+            "properties": {
+                "defect_id": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "evidence": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "trainee": {
+                    "type": "string"
+                }
+            }
+        },
+        "challenge.Verdict": {
+            "type": "object",
+            "properties": {
+                "accepted": {
+                    "type": "boolean"
+                },
+                "defect_id": {
+                    "type": "string"
+                },
+                "explanation": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "points": {
+                    "description": "negative for a reported honeypot",
+                    "type": "integer"
+                },
+                "score": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.Dashboard": {
+            "type": "object",
+            "properties": {
+                "defects": {
+                    "description": "catalog entries that are not honeypots",
+                    "type": "integer"
+                },
+                "generated": {
+                    "type": "string"
+                },
+                "goat_calls": {
+                    "type": "integer"
+                },
+                "goat_stage": {
+                    "type": "string"
+                },
+                "requests": {
+                    "description": "exchanges in the traffic log",
+                    "type": "integer"
+                },
+                "trainees": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.TraineeBoard"
+                    }
+                }
+            }
+        },
+        "handlers.SandboxInfo": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "string"
+                },
+                "difficulty": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "dropped unless used again before",
+                    "type": "string"
+                },
+                "goat_calls": {
+                    "type": "integer"
+                },
+                "goat_stage": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_used": {
+                    "type": "string"
+                },
+                "quirk_profile": {
+                    "type": "string"
+                },
+                "requests": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.SandboxSettings": {
+            "type": "object",
+            "properties": {
+                "difficulty": {
+                    "description": "\"beginner\", \"intermediate\" or \"expert\"",
+                    "type": "string"
+                },
+                "quirk_profile": {
+                    "description": "\"strange\", \"plausible\", \"subtle\" or \"honest\"",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.TraineeBoard": {
+            "type": "object",
+            "properties": {
+                "false_positives": {
+                    "description": "honeypots reported as defects",
+                    "type": "integer"
+                },
+                "findings": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/challenge.Finding"
+                    }
+                },
+                "found": {
+                    "type": "integer"
+                },
+                "goat_stage": {
+                    "description": "last GOAT answer the trainee got",
+                    "type": "string"
+                },
+                "honeypots": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "last_active": {
+                    "type": "string"
+                },
+                "last_request": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "integer"
+                },
+                "rejected": {
+                    "type": "integer"
+                },
+                "remaining": {
+                    "description": "defects not found yet",
+                    "type": "integer"
+                },
+                "requests": {
+                    "type": "integer"
+                },
+                "submissions": {
+                    "type": "integer"
+                },
+                "trainee": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.APIResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Article"
+                    }
+                },
+                "error": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "description": "set on errors, matches X-Request-ID",
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Article": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "owner_id": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CreateArticleRequest": {
             "type": "object",
             "properties": {
                 "content": {
@@ -311,16 +1056,46 @@ const docTemplate = `{
                 },
                 "name": {
                     "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "role": {
+                    "description": "anything but reader requires an admin",
+                    "type": "string",
+                    "enum": [
+                        "reader",
+                        "editor",
+                        "admin"
+                    ]
                 }
             }
         },
-        "models.GoatResponse": {
+        "models.LoginRequest": {
             "type": "object",
+            "required": [
+                "name",
+                "password"
+            ],
             "properties": {
-                "message": {
+                "name": {
                     "type": "string"
                 },
-                "status": {
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.LoginResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                },
+                "token_type": {
                     "type": "string"
                 }
             }
@@ -328,6 +1103,10 @@ const docTemplate = `{
         "models.User": {
             "type": "object",
             "properties": {
+                "api_key": {
+                    "description": "only returned once, when the user is created",
+                    "type": "string"
+                },
                 "email": {
                     "type": "string"
                 },
@@ -336,10 +1115,324 @@ const docTemplate = `{
                 },
                 "name": {
                     "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                }
+            }
+        },
+        "quirks.Applied": {
+            "type": "object",
+            "properties": {
+                "actual": {
+                    "type": "integer"
+                },
+                "intended": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "report.Classification": {
+            "type": "object",
+            "properties": {
+                "counts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/report.Counts"
+                    }
+                },
+                "disagreements": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/report.Disagreement"
+                    }
+                },
+                "exchanges": {
+                    "type": "integer"
+                }
+            }
+        },
+        "report.Counts": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "integer"
+                },
+                "rule": {
+                    "type": "string"
+                },
+                "success": {
+                    "type": "integer"
+                },
+                "unknown": {
+                    "type": "integer"
+                }
+            }
+        },
+        "report.Disagreement": {
+            "type": "object",
+            "properties": {
+                "intended_status": {
+                    "type": "integer"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "outcomes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/report.Outcome"
+                    }
+                },
+                "path": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "report.Outcome": {
+            "type": "string",
+            "enum": [
+                "success",
+                "error",
+                "unknown"
+            ],
+            "x-enum-varnames": [
+                "Success",
+                "Error",
+                "Unknown"
+            ]
+        },
+        "traffic.HAR": {
+            "type": "object",
+            "properties": {
+                "log": {
+                    "$ref": "#/definitions/traffic.HARLog"
+                }
+            }
+        },
+        "traffic.HARContent": {
+            "type": "object",
+            "properties": {
+                "encoding": {
+                    "type": "string"
+                },
+                "mimeType": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "traffic.HARCreator": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "traffic.HAREntry": {
+            "type": "object",
+            "properties": {
+                "_intendedStatus": {
+                    "type": "integer"
+                },
+                "_quirks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/quirks.Applied"
+                    }
+                },
+                "_requestId": {
+                    "type": "string"
+                },
+                "_route": {
+                    "type": "string"
+                },
+                "cache": {
+                    "type": "object"
+                },
+                "request": {
+                    "$ref": "#/definitions/traffic.HARRequest"
+                },
+                "response": {
+                    "$ref": "#/definitions/traffic.HARResponse"
+                },
+                "startedDateTime": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "number"
+                },
+                "timings": {
+                    "$ref": "#/definitions/traffic.HARTimings"
+                }
+            }
+        },
+        "traffic.HARLog": {
+            "type": "object",
+            "properties": {
+                "creator": {
+                    "$ref": "#/definitions/traffic.HARCreator"
+                },
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/traffic.HAREntry"
+                    }
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "traffic.HARNameValue": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "traffic.HARPostData": {
+            "type": "object",
+            "properties": {
+                "encoding": {
+                    "description": "non-standard, \"base64\" for binary bodies",
+                    "type": "string"
+                },
+                "mimeType": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "traffic.HARRequest": {
+            "type": "object",
+            "properties": {
+                "bodySize": {
+                    "type": "integer"
+                },
+                "cookies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/traffic.HARNameValue"
+                    }
+                },
+                "headers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/traffic.HARNameValue"
+                    }
+                },
+                "headersSize": {
+                    "type": "integer"
+                },
+                "httpVersion": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "postData": {
+                    "$ref": "#/definitions/traffic.HARPostData"
+                },
+                "queryString": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/traffic.HARNameValue"
+                    }
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "traffic.HARResponse": {
+            "type": "object",
+            "properties": {
+                "bodySize": {
+                    "type": "integer"
+                },
+                "content": {
+                    "$ref": "#/definitions/traffic.HARContent"
+                },
+                "cookies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/traffic.HARNameValue"
+                    }
+                },
+                "headers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/traffic.HARNameValue"
+                    }
+                },
+                "headersSize": {
+                    "type": "integer"
+                },
+                "httpVersion": {
+                    "type": "string"
+                },
+                "redirectURL": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "statusText": {
+                    "type": "string"
+                }
+            }
+        },
+        "traffic.HARTimings": {
+            "type": "object",
+            "properties": {
+                "receive": {
+                    "type": "number"
+                },
+                "send": {
+                    "type": "number"
+                },
+                "wait": {
+                    "type": "number"
                 }
             }
         }
     },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "description": "Bearer token from POST /api/login, sent as \"Bearer \u003ctoken\u003e\"",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
+    },
     "tags": [
         {
             "description": "Article management operations",
@@ -349,9 +1442,29 @@ const docTemplate = `{
             "description": "User management operations",
             "name": "users"
         },
+        {
+            "description": "Authentication operations",
+            "name": "auth"
+        },
+        {
+            "description": "Reports built from recorded traffic",
+            "name": "reports"
+        },
+        {
+            "description": "Administration of recorded traffic and sandboxes",
+            "name": "admin"
+        },
         {
             "description": "Health check and GOAT method operations",
             "name": "health"
+        },
+        {
+            "description": "Challenge mode: defect catalog, submissions, scores and the instructor dashboard",
+            "name": "challenge"
+        },
+        {
+            "description": "Per-tenant sandboxes with their own data, GOAT and quirk profile",
+            "name": "sandbox"
         }
     ]
 }`
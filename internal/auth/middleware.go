@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+)
+
+// FailureMode selects how authentication and authorization failures are reported
+type FailureMode string
+
+const (
+	// FailHonest answers 401 Unauthorized / 403 Forbidden
+	FailHonest FailureMode = "honest"
+	// FailHide answers 404 Not Found, pretending the resource does not exist
+	FailHide FailureMode = "hide"
+	// FailOK answers 200 OK with "unauthorized" in the body
+	FailOK FailureMode = "ok"
+)
+
+// ParseFailureMode validates a failure mode name
+func ParseFailureMode(s string) (FailureMode, error) {
+	switch mode := FailureMode(strings.ToLower(s)); mode {
+	case FailHonest, FailHide, FailOK:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown auth failure mode %q (want honest, hide or ok)", s)
+}
+
+// UserStore looks up the users that credentials belong to
+type UserStore interface {
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
+	GetUserByAPIKey(ctx context.Context, keyHash string) (*models.User, error)
+}
+
+// Authenticator resolves bearer tokens and API keys to users
+type Authenticator struct {
+	issuer *Issuer
+	users  UserStore
+	grace  time.Duration
+
+	mu   sync.RWMutex
+	mode FailureMode
+}
+
+// NewAuthenticator creates a new Authenticator instance
+func NewAuthenticator(issuer *Issuer, users UserStore, mode FailureMode, grace time.Duration) *Authenticator {
+	return &Authenticator{
+		issuer: issuer,
+		users:  users,
+		mode:   mode,
+		grace:  grace,
+	}
+}
+
+// SetFailureMode changes how failures are reported while the server is running
+func (a *Authenticator) SetFailureMode(mode FailureMode) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.mode = mode
+}
+
+// FailureMode returns how failures are reported
+func (a *Authenticator) FailureMode() FailureMode {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.mode
+}
+
+// Issuer returns the token issuer used by the authenticator
+func (a *Authenticator) Issuer() *Issuer {
+	return a.issuer
+}
+
+type contextKey struct{}
+
+// WithUser returns a copy of ctx carrying the authenticated user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the authenticated user stored in ctx, if any
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*models.User)
+	return user, ok
+}
+
+// Authenticate resolves the credentials on a request to a user
+func (a *Authenticator) Authenticate(r *http.Request) (*models.User, error) {
+	return a.authenticate(r, true)
+}
+
+// Identity returns the user valid credentials on a request belong to. Unlike
+// Authenticate, it leaves no trace: an expired token that is still accepted
+// is neither logged nor noted as a quirk.
+func (a *Authenticator) Identity(r *http.Request) (*models.User, bool) {
+	user, err := a.authenticate(r, false)
+	return user, err == nil
+}
+
+// authenticate resolves credentials, noting accepted expired tokens if note
+func (a *Authenticator) authenticate(r *http.Request, note bool) (*models.User, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		user, err := a.users.GetUserByAPIKey(r.Context(), HashAPIKey(key))
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		return user, nil
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, errors.New("missing credentials")
+	}
+
+	claims, err := a.issuer.Verify(strings.TrimSpace(token))
+	if errors.Is(err, ErrExpiredToken) {
+		expiredFor := a.issuer.now().Sub(time.Unix(claims.ExpiresAt, 0))
+		if expiredFor > a.grace {
+			return nil, err
+		}
+		// Expired tokens are still accepted for a while - should be rejected immediately
+		if note {
+			slog.WarnContext(r.Context(), "accepting expired token", "user", claims.Name, "expired_for", expiredFor.Round(time.Second))
+			quirks.Note(r.Context(), "auth.expired-token-accepted", http.StatusUnauthorized, http.StatusOK)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	user, err := a.users.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return user, nil
+}
+
+// Require wraps a handler so that it is only reachable with valid credentials
+// and, if roles are given, only by users holding one of them
+func (a *Authenticator) Require(handler http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.Authenticate(r)
+		if err != nil {
+			a.Deny(w, r, http.StatusUnauthorized, fmt.Sprintf("Authentication required: %v", err))
+			return
+		}
+		if !HasRole(user, roles...) {
+			a.Deny(w, r, http.StatusForbidden, fmt.Sprintf("Users with role '%s' may not do this", user.Role))
+			return
+		}
+		handler(w, r.WithContext(WithUser(r.Context(), user)))
+	}
+}
+
+// Identify wraps a handler so that valid credentials, if present, put the user
+// in the request context. Requests without credentials pass through anonymously.
+func (a *Authenticator) Identify(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, err := a.Authenticate(r); err == nil {
+			r = r.WithContext(WithUser(r.Context(), user))
+		}
+		handler(w, r)
+	}
+}
+
+// Deny reports an authentication (401) or authorization (403) failure
+// according to the configured failure mode
+func (a *Authenticator) Deny(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch a.FailureMode() {
+	case FailHide:
+		// Wrong status code - should be 401/403, but we pretend the route does not exist
+		quirks.Note(r.Context(), "auth.hide", status, 404)
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Error:     "Not found",
+			Status:    "NOT_FOUND",
+			RequestID: middleware.RequestIDFromContext(r.Context()),
+		})
+	case FailOK:
+		// Wrong status code - should be 401/403, but we return 200
+		quirks.Note(r.Context(), "auth.ok", status, 200)
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Error:     "unauthorized",
+			Status:    "UNAUTHORIZED",
+			RequestID: middleware.RequestIDFromContext(r.Context()),
+		})
+	default:
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="strange-errors-server"`)
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Error:     message,
+			Status:    strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+			RequestID: middleware.RequestIDFromContext(r.Context()),
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"slices"
+
+	"strange-errors-server/internal/models"
+)
+
+// ValidRole reports whether role is one of the known user roles
+func ValidRole(role string) bool {
+	switch role {
+	case models.RoleReader, models.RoleEditor, models.RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// HasRole reports whether the user holds one of roles. An empty list allows any user.
+func HasRole(user *models.User, roles ...string) bool {
+	return len(roles) == 0 || slices.Contains(roles, user.Role)
+}
@@ -0,0 +1,371 @@
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"strange-errors-server/internal/traffic"
+)
+
+// maxEvidence caps the request IDs a submission may cite
+const maxEvidence = 20
+
+// traineeName is what a trainee name may look like
+var traineeName = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// ErrInvalid wraps problems with the submission itself, as opposed to
+// reports that do not hold up
+var ErrInvalid = errors.New("invalid submission")
+
+// Submission is a trainee's report of a defect. It names the defect by ID
+// or describes it in free text, and cites the request IDs that show it.
+type Submission struct {
+	Trainee     string   `json:"trainee"`
+	DefectID    string   `json:"defect_id,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Evidence    []string `json:"evidence"`
+}
+
+// Verdict is the outcome of a submission
+type Verdict struct {
+	Accepted    bool   `json:"accepted"`
+	DefectID    string `json:"defect_id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Points      int    `json:"points"` // negative for a reported honeypot
+	Message     string `json:"message"`
+	Explanation string `json:"explanation,omitempty"`
+	Score       int    `json:"score"`
+}
+
+// Finding is a defect a trainee has been credited with
+type Finding struct {
+	DefectID string    `json:"defect_id"`
+	Title    string    `json:"title"`
+	Points   int       `json:"points"`
+	At       time.Time `json:"at"`
+	Evidence []string  `json:"evidence"`
+}
+
+// Score is a trainee's progress. The findings themselves are only filled
+// in for the trainee's own view, so that the leaderboard gives nothing away.
+type Score struct {
+	Trainee        string    `json:"trainee"`
+	Points         int       `json:"points"`
+	Found          int       `json:"found"`
+	FalsePositives int       `json:"false_positives"` // honeypots reported as defects
+	Remaining      int       `json:"remaining"`       // defects not found yet
+	Submissions    int       `json:"submissions"`
+	Rejected       int       `json:"rejected"`
+	LastActive     time.Time `json:"last_active"`
+
+	Findings  []Finding `json:"findings,omitempty"`
+	Honeypots []string  `json:"honeypots,omitempty"`
+}
+
+// progress is the mutable state behind a Score
+type progress struct {
+	found       []Finding
+	honeypots   []string
+	penalty     int
+	submissions int
+	rejected    int
+	lastActive  time.Time
+}
+
+// Board verifies submissions against recorded traffic and keeps the scores
+type Board struct {
+	mu       sync.Mutex
+	log      *traffic.Log
+	defects  []Defect
+	trainees map[string]*progress
+	claimed  map[string]string // evidence request ID -> trainee who cited it first
+	now      func() time.Time
+	watchers map[chan struct{}]struct{}
+}
+
+// NewBoard creates a new Board instance verifying against log
+func NewBoard(log *traffic.Log, defects []Defect) *Board {
+	return &Board{
+		log:      log,
+		defects:  defects,
+		trainees: make(map[string]*progress),
+		claimed:  make(map[string]string),
+		now:      time.Now,
+	}
+}
+
+// SetClock sets where the board gets the time of findings from
+func (b *Board) SetClock(now func() time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.now = now
+}
+
+// Defects returns the catalog the board scores against
+func (b *Board) Defects() []Defect {
+	return slices.Clone(b.defects)
+}
+
+// Submit verifies a submission and updates the trainee's score. Reports
+// that do not hold up are rejected in the verdict; only malformed
+// submissions return an error.
+func (b *Board) Submit(s Submission) (Verdict, error) {
+	if !traineeName.MatchString(s.Trainee) {
+		return Verdict{}, fmt.Errorf("%w: trainee must be 1-64 letters, digits or . _ @ -", ErrInvalid)
+	}
+	if s.DefectID == "" && strings.TrimSpace(s.Description) == "" {
+		return Verdict{}, fmt.Errorf("%w: name a defect_id or give a description", ErrInvalid)
+	}
+	if len(s.Evidence) == 0 || len(s.Evidence) > maxEvidence {
+		return Verdict{}, fmt.Errorf("%w: cite 1 to %d request IDs as evidence", ErrInvalid, maxEvidence)
+	}
+	var defect *Defect
+	if s.DefectID != "" {
+		i := slices.IndexFunc(b.defects, func(d Defect) bool { return d.ID == s.DefectID })
+		if i < 0 {
+			return Verdict{}, fmt.Errorf("%w: unknown defect %q, see the catalog", ErrInvalid, s.DefectID)
+		}
+		defect = &b.defects[i]
+	}
+
+	// Look the evidence up before taking the lock; the log has its own
+	evidence, missing := b.lookup(s.Evidence)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	defer b.notify()
+	p := b.trainees[s.Trainee]
+	if p == nil {
+		p = &progress{}
+		b.trainees[s.Trainee] = p
+	}
+	p.submissions++
+	p.lastActive = b.now()
+
+	reject := func(format string, args ...any) (Verdict, error) {
+		p.rejected++
+		return Verdict{Message: fmt.Sprintf(format, args...), Score: p.score()}, nil
+	}
+
+	if len(missing) > 0 {
+		return reject("Evidence not found in the recorded traffic: %s. Only the most recent exchanges are kept, and the challenge endpoints are never recorded.", strings.Join(missing, ", "))
+	}
+	for _, e := range evidence {
+		if e.Trainee != s.Trainee {
+			return reject("Request %s was not sent by %s. Cite your own requests, sent while logged in or with the X-Trainee header.", e.RequestID, s.Trainee)
+		}
+	}
+	for _, id := range s.Evidence {
+		if owner, ok := b.claimed[id]; ok && owner != s.Trainee {
+			return reject("Request %s was already cited by another trainee. Send your own requests.", id)
+		}
+	}
+
+	if defect == nil {
+		defect = b.match(s.Description, evidence, p)
+		if defect == nil {
+			return reject("The evidence does not show a defect matching the description. Try naming the defect_id from the catalog.")
+		}
+	}
+	if slices.ContainsFunc(p.found, func(f Finding) bool { return f.DefectID == defect.ID }) || slices.Contains(p.honeypots, defect.ID) {
+		return reject("%s was already scored.", defect.ID)
+	}
+	if !defect.shows(evidence) {
+		return reject("The evidence does not show %q. Cite the request IDs of the exchanges where it happens.", defect.Title)
+	}
+
+	for _, id := range s.Evidence {
+		b.claimed[id] = s.Trainee
+	}
+	if defect.Honeypot() {
+		p.honeypots = append(p.honeypots, defect.ID)
+		p.penalty += defect.Points
+		return Verdict{
+			DefectID:    defect.ID,
+			Title:       defect.Title,
+			Points:      -defect.Points,
+			Message:     "False positive: this behavior is correct.",
+			Explanation: defect.Explanation,
+			Score:       p.score(),
+		}, nil
+	}
+	p.found = append(p.found, Finding{
+		DefectID: defect.ID,
+		Title:    defect.Title,
+		Points:   defect.Points,
+		At:       p.lastActive,
+		Evidence: slices.Clone(s.Evidence),
+	})
+	return Verdict{
+		Accepted:    true,
+		DefectID:    defect.ID,
+		Title:       defect.Title,
+		Points:      defect.Points,
+		Message:     "Defect confirmed by the recorded traffic.",
+		Explanation: defect.Explanation,
+		Score:       p.score(),
+	}, nil
+}
+
+// lookup finds the exchanges with the given request IDs, oldest first
+func (b *Board) lookup(ids []string) (evidence []traffic.Exchange, missing []string) {
+	found := make(map[string]bool)
+	for _, e := range b.log.Exchanges() {
+		if slices.Contains(ids, e.RequestID) {
+			evidence = append(evidence, e)
+			found[e.RequestID] = true
+		}
+	}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	return evidence, missing
+}
+
+// match picks the entry a description talks about among those the evidence
+// shows and the trainee has not reported yet: the one sharing the most
+// keywords with it. Caller must hold b.mu.
+func (b *Board) match(description string, evidence []traffic.Exchange, p *progress) *Defect {
+	words := strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-')
+	})
+	var best *Defect
+	bestHits := 0
+	for i := range b.defects {
+		d := &b.defects[i]
+		if slices.ContainsFunc(p.found, func(f Finding) bool { return f.DefectID == d.ID }) || slices.Contains(p.honeypots, d.ID) {
+			continue
+		}
+		hits := 0
+		for _, keyword := range d.Keywords {
+			if slices.Contains(words, keyword) {
+				hits++
+			}
+		}
+		if hits > bestHits && d.shows(evidence) {
+			best, bestHits = d, hits
+		}
+	}
+	return best
+}
+
+// score returns the trainee's points
+func (p *progress) score() int {
+	points := -p.penalty
+	for _, f := range p.found {
+		points += f.Points
+	}
+	return points
+}
+
+// Score returns one trainee's progress, findings included
+func (b *Board) Score(trainee string) (Score, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.trainees[trainee]
+	if !ok {
+		return Score{}, false
+	}
+	score := b.scoreOf(trainee, p)
+	score.Findings = slices.Clone(p.found)
+	score.Honeypots = slices.Clone(p.honeypots)
+	return score, true
+}
+
+// Scores returns everybody's progress, best first
+func (b *Board) Scores() []Score {
+	return b.scores(false)
+}
+
+// Standings returns everybody's progress with the findings, best first.
+// It is meant for the instructor, not for the trainees.
+func (b *Board) Standings() []Score {
+	return b.scores(true)
+}
+
+// scores returns everybody's progress, best first, with or without findings
+func (b *Board) scores(findings bool) []Score {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	scores := make([]Score, 0, len(b.trainees))
+	for trainee, p := range b.trainees {
+		score := b.scoreOf(trainee, p)
+		if findings {
+			score.Findings = slices.Clone(p.found)
+			score.Honeypots = slices.Clone(p.honeypots)
+		}
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Points != scores[j].Points {
+			return scores[i].Points > scores[j].Points
+		}
+		return scores[i].Trainee < scores[j].Trainee
+	})
+	return scores
+}
+
+// scoreOf builds a Score without the findings; caller must hold b.mu
+func (b *Board) scoreOf(trainee string, p *progress) Score {
+	total := 0
+	for _, d := range b.defects {
+		if !d.Honeypot() {
+			total++
+		}
+	}
+	return Score{
+		Trainee:        trainee,
+		Points:         p.score(),
+		Found:          len(p.found),
+		FalsePositives: len(p.honeypots),
+		Remaining:      total - len(p.found),
+		Submissions:    p.submissions,
+		Rejected:       p.rejected,
+		LastActive:     p.lastActive,
+	}
+}
+
+// Reset forgets every score
+func (b *Board) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	clear(b.trainees)
+	clear(b.claimed)
+	b.notify()
+}
+
+// Watch returns a channel that receives a value whenever a submission comes
+// in or the scores are reset. Notifications are coalesced, so a slow reader
+// sees one for any number of changes. Call stop to release the channel.
+func (b *Board) Watch() (changes <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.watchers == nil {
+		b.watchers = make(map[chan struct{}]struct{})
+	}
+	b.watchers[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.watchers, ch)
+	}
+}
+
+// notify wakes up the watchers; caller must hold b.mu
+func (b *Board) notify() {
+	for ch := range b.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
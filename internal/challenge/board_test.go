@@ -0,0 +1,194 @@
+package challenge
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/traffic"
+)
+
+// newBoard returns a board over a log holding the given exchanges
+func newBoard(t *testing.T, exchanges ...traffic.Exchange) *Board {
+	t.Helper()
+	log := traffic.NewLog(100)
+	for _, e := range exchanges {
+		log.Add(e)
+	}
+	return NewBoard(log, Catalog())
+}
+
+var (
+	listArticles = traffic.Exchange{
+		RequestID: "list", Trainee: "ana", Method: "GET", Path: "/api/articles", Status: 777,
+		Quirks: []quirks.Applied{{Name: "articles.list.success", Intended: 200, Actual: 777}},
+	}
+	deleteFirst  = traffic.Exchange{RequestID: "del-1", Trainee: "ana", Method: "DELETE", Path: "/api/article/1", Status: 200}
+	deleteAgain  = traffic.Exchange{RequestID: "del-2", Trainee: "ana", Method: "DELETE", Path: "/api/article/1", Status: 666}
+	deleteHonest = traffic.Exchange{RequestID: "del-3", Trainee: "ana", Method: "DELETE", Path: "/api/article/1", Status: 404}
+	healthCheck  = traffic.Exchange{RequestID: "health", Trainee: "ana", Method: "GET", Path: "/api/health-check", Status: 200}
+)
+
+func TestSubmitByID(t *testing.T) {
+	board := newBoard(t, listArticles, healthCheck)
+
+	verdict, err := board.Submit(Submission{Trainee: "ana", DefectID: "articles.list.success", Evidence: []string{"list"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verdict.Accepted || verdict.Points != 10 || verdict.Score != 10 || verdict.Explanation == "" {
+		t.Errorf("verdict = %+v, want 10 points with an explanation", verdict)
+	}
+
+	// The evidence has to show the defect
+	verdict, _ = board.Submit(Submission{Trainee: "ana", DefectID: "route.not-found", Evidence: []string{"health"}})
+	if verdict.Accepted || verdict.Score != 10 {
+		t.Errorf("unsupported report accepted: %+v", verdict)
+	}
+
+	// A defect scores once
+	verdict, _ = board.Submit(Submission{Trainee: "ana", DefectID: "articles.list.success", Evidence: []string{"list"}})
+	if verdict.Accepted || verdict.Score != 10 {
+		t.Errorf("repeated report accepted: %+v", verdict)
+	}
+}
+
+func TestSubmitByDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		evidence    []string
+		want        string
+	}{
+		{"wrong status", "listing articles answers 777", []string{"list"}, "articles.list.success"},
+		{"idempotency", "deleting the same article twice", []string{"del-1", "del-2"}, "article.delete.repeat"},
+		{"no keyword", "something is off", []string{"list"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board := newBoard(t, listArticles, deleteFirst, deleteAgain)
+			verdict, err := board.Submit(Submission{Trainee: "ana", Description: tt.description, Evidence: tt.evidence})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict.DefectID != tt.want || verdict.Accepted != (tt.want != "") {
+				t.Errorf("verdict = %+v, want %q", verdict, tt.want)
+			}
+		})
+	}
+}
+
+func TestHiddenDefect(t *testing.T) {
+	delayed := traffic.Exchange{
+		RequestID: "del-late", Trainee: "ana", Method: "DELETE", Path: "/api/article/1", Status: 200,
+		Quirks: []quirks.Applied{{Name: "article.delete.delayed", Intended: 200, Actual: 200}},
+	}
+	log := traffic.NewLog(100)
+	log.Add(delayed)
+	log.Add(deleteFirst)
+
+	if slices.ContainsFunc(Catalog(), func(d Defect) bool { return d.ID == "article.delete.delayed" }) {
+		t.Error("the catalog lists a hidden defect without the expert level")
+	}
+	board := NewBoard(log, Catalog("article.delete.delayed"))
+	verdict, _ := board.Submit(Submission{Trainee: "ana", DefectID: "article.delete.delayed", Evidence: []string{"del-1"}})
+	if verdict.Accepted {
+		t.Errorf("a delete without the quirk was accepted: %+v", verdict)
+	}
+	verdict, _ = board.Submit(Submission{Trainee: "ana", DefectID: "article.delete.delayed", Evidence: []string{"del-late"}})
+	if !verdict.Accepted || verdict.Points != 20 {
+		t.Errorf("verdict = %+v, want 20 points", verdict)
+	}
+}
+
+func TestRepeatedDeleteNeedsWrongStatus(t *testing.T) {
+	if !repeatedDelete([]traffic.Exchange{deleteFirst, deleteAgain}) {
+		t.Error("200 then 666 not recognized")
+	}
+	if repeatedDelete([]traffic.Exchange{deleteFirst, deleteHonest}) {
+		t.Error("200 then 404 is what an idempotent DELETE should do")
+	}
+	if repeatedDelete([]traffic.Exchange{deleteAgain}) {
+		t.Error("a single failed delete is not a repeat")
+	}
+}
+
+func TestHoneypotCostsPoints(t *testing.T) {
+	board := newBoard(t, healthCheck, listArticles)
+	board.Submit(Submission{Trainee: "ana", DefectID: "articles.list.success", Evidence: []string{"list"}})
+
+	verdict, _ := board.Submit(Submission{Trainee: "ana", DefectID: "health.get", Evidence: []string{"health"}})
+	if verdict.Accepted || verdict.Points != -10 || verdict.Score != 0 {
+		t.Errorf("verdict = %+v, want a 10 point penalty", verdict)
+	}
+	// Only the first report of a honeypot costs points
+	verdict, _ = board.Submit(Submission{Trainee: "ana", DefectID: "health.get", Evidence: []string{"health"}})
+	if verdict.Score != 0 {
+		t.Errorf("second honeypot report changed the score to %d", verdict.Score)
+	}
+
+	score, _ := board.Score("ana")
+	if score.Found != 1 || score.FalsePositives != 1 || len(score.Honeypots) != 1 {
+		t.Errorf("score = %+v", score)
+	}
+	for _, s := range board.Scores() {
+		if s.Findings != nil || s.Honeypots != nil {
+			t.Error("the leaderboard reveals findings")
+		}
+	}
+}
+
+func TestEvidenceRules(t *testing.T) {
+	board := newBoard(t, listArticles)
+
+	verdict, _ := board.Submit(Submission{Trainee: "ana", DefectID: "articles.list.success", Evidence: []string{"gone"}})
+	if verdict.Accepted {
+		t.Error("evidence missing from the log was accepted")
+	}
+
+	// A trainee harvesting request IDs from the classification report
+	verdict, _ = board.Submit(Submission{Trainee: "bo", DefectID: "articles.list.success", Evidence: []string{"list"}})
+	if verdict.Accepted {
+		t.Error("evidence sent by another trainee was accepted")
+	}
+	verdict, _ = board.Submit(Submission{Trainee: "ana", DefectID: "articles.list.success", Evidence: []string{"list"}})
+	if !verdict.Accepted {
+		t.Errorf("ana's own evidence was rejected: %+v", verdict)
+	}
+
+	invalid := []Submission{
+		{Trainee: "", DefectID: "articles.list.success", Evidence: []string{"list"}},
+		{Trainee: "has space", DefectID: "articles.list.success", Evidence: []string{"list"}},
+		{Trainee: "ana", Evidence: []string{"list"}},
+		{Trainee: "ana", DefectID: "articles.list.success"},
+		{Trainee: "ana", DefectID: "no.such.defect", Evidence: []string{"list"}},
+	}
+	for _, s := range invalid {
+		if _, err := board.Submit(s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Submit(%+v) = %v, want ErrInvalid", s, err)
+		}
+	}
+}
+
+func TestScoresRanking(t *testing.T) {
+	boList := listArticles
+	boList.RequestID, boList.Trainee = "list-bo", "bo"
+	board := newBoard(t, boList, deleteFirst, deleteAgain)
+	board.Submit(Submission{Trainee: "bo", DefectID: "articles.list.success", Evidence: []string{"list-bo"}})
+	board.Submit(Submission{Trainee: "ana", DefectID: "article.delete.repeat", Evidence: []string{"del-1", "del-2"}})
+
+	scores := board.Scores()
+	if len(scores) != 2 || scores[0].Trainee != "ana" || scores[1].Trainee != "bo" {
+		t.Fatalf("scores = %+v, want ana ahead of bo", scores)
+	}
+	// Everything but the four honeypots and the one defect found
+	if want := len(Catalog()) - 4 - 1; scores[0].Remaining != want {
+		t.Errorf("remaining = %d, want %d", scores[0].Remaining, want)
+	}
+
+	board.Reset()
+	if len(board.Scores()) != 0 {
+		t.Error("Reset kept scores")
+	}
+}
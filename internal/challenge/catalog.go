@@ -0,0 +1,274 @@
+// Package challenge turns the server into a training ground: trainees hunt
+// for the defects planted in it, report them with the request IDs that show
+// them, and score points once the recorded traffic backs the report up.
+package challenge
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/traffic"
+)
+
+// Categories of catalog entries
+const (
+	CategoryWrongStatus = "wrong-status"
+	CategoryIdempotency = "idempotency"
+	CategoryGoat        = "goat-side-effect"
+	// CategoryHidden entries keep the status code right and hide the bug in
+	// the body, the headers, the ordering or the timing
+	CategoryHidden = "hidden"
+	// CategoryHoneypot entries are correct behavior that looks suspicious.
+	// Reporting one costs its points.
+	CategoryHoneypot = "honeypot"
+)
+
+// Defect is an entry of the catalog. Titles only name the behavior, never
+// what is wrong with it, and honeypots look like every other entry.
+type Defect struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Points int    `json:"points"`
+
+	Category    string   `json:"-"`
+	Explanation string   `json:"-"` // revealed once the entry is reported
+	Keywords    []string `json:"-"` // match free-text descriptions
+
+	// shows reports whether the evidence demonstrates the behavior
+	shows func(evidence []traffic.Exchange) bool
+}
+
+// Honeypot reports whether the entry is correct behavior
+func (d Defect) Honeypot() bool {
+	return d.Category == CategoryHoneypot
+}
+
+// Catalog returns the defects planted in every server, followed by the
+// ones that only exist when the named optional quirks are switched on,
+// such as "rate-limit.disguise", "auth.hide" or the hidden quirks of the
+// expert level
+func Catalog(optional ...string) []Defect {
+	defects := []Defect{
+		quirkDefect("route.not-found", "Requesting a route that does not exist", "unknown", "route", "missing", "endpoint", "200"),
+		quirkDefect("articles.list.success", "Listing articles", "list", "articles", "get", "777"),
+		quirkDefect("article.create.success", "Creating an article", "create", "article", "post", "888"),
+		quirkDefect("article.create.invalid", "Creating an article with invalid data", "invalid", "article", "validation", "empty", "999"),
+		quirkDefect("article.delete.bad-id", "Deleting an article by a non-numeric ID", "non-numeric", "id", "delete", "article", "500"),
+		quirkDefect("article.delete.not-found", "Deleting an article that does not exist", "missing", "delete", "article", "666"),
+		quirkDefect("user.create.invalid-email", "Creating a user with an invalid email address", "email", "invalid", "user", "500"),
+		{
+			ID:          "user.create.duplicate",
+			Title:       "Creating a user whose name is taken",
+			Points:      15,
+			Category:    CategoryIdempotency,
+			Explanation: "A name that is taken is a conflict with the current state of the resource, not a malformed request: it should be 409 Conflict, but the server answers 400 (RFC 9110 §15.5.10).",
+			Keywords:    []string{"duplicate", "exists", "taken", "twice", "again", "conflict", "409", "400", "user"},
+			shows: func(evidence []traffic.Exchange) bool {
+				return slices.ContainsFunc(evidence, func(e traffic.Exchange) bool {
+					return e.Method == "POST" && e.Path == "/api/user" && e.Status == 400 && bytes.Contains(e.ResponseBody, []byte("USER_EXISTS"))
+				})
+			},
+		},
+		{
+			ID:          "article.delete.repeat",
+			Title:       "Deleting the same article twice",
+			Points:      15,
+			Category:    CategoryIdempotency,
+			Explanation: "DELETE is idempotent: repeating it must leave the server in the same state and answer 404 or 204, but the repeat answers with a status code that does not exist (RFC 9110 §9.2.2).",
+			Keywords:    []string{"twice", "again", "repeat", "idempotent", "second", "delete", "article"},
+			shows:       repeatedDelete,
+		},
+		{
+			ID:          "goat.mood",
+			Title:       "Calling GOAT /api/health-check repeatedly",
+			Points:      10,
+			Category:    CategoryGoat,
+			Explanation: "A health check must not change state, yet every GOAT call gets a different answer because the GOAT counts the calls.",
+			Keywords:    []string{"goat", "different", "changes", "state", "counts", "annoyed", "mood", "repeat", "again"},
+			shows: func(evidence []traffic.Exchange) bool {
+				statuses := map[int]bool{}
+				for _, e := range evidence {
+					if e.Method == "GOAT" {
+						statuses[e.Status] = true
+					}
+				}
+				return len(statuses) > 1
+			},
+		},
+		{
+			ID:          "goat.database",
+			Title:       "The fourth GOAT call",
+			Points:      20,
+			Category:    CategoryGoat,
+			Explanation: "The fourth GOAT call deletes the database file: a health check with a destructive side effect, reported as a plain 500.",
+			Keywords:    []string{"goat", "database", "deleted", "deletes", "data", "destroy", "fourth", "enraged"},
+			shows: func(evidence []traffic.Exchange) bool {
+				return slices.ContainsFunc(evidence, func(e traffic.Exchange) bool {
+					return e.Method == "GOAT" && e.Status == 500 && bytes.Contains(e.ResponseBody, []byte("database"))
+				})
+			},
+		},
+		{
+			ID:          "goat.shutdown",
+			Title:       "The fifth GOAT call",
+			Points:      20,
+			Category:    CategoryGoat,
+			Explanation: "The fifth GOAT call shuts the whole server down: any client can take the service offline through a health check.",
+			Keywords:    []string{"goat", "shutdown", "shuts", "down", "offline", "crash", "fifth", "fatal", "503"},
+			shows: func(evidence []traffic.Exchange) bool {
+				return slices.ContainsFunc(evidence, func(e traffic.Exchange) bool {
+					return e.Method == "GOAT" && e.Status == http.StatusServiceUnavailable
+				})
+			},
+		},
+		honeypot("user.delete.not-found", "Deleting a user that does not exist",
+			"404 Not Found is exactly what an unknown user ID calls for (RFC 9110 §15.5.5).",
+			[]string{"delete", "user", "missing", "404"},
+			func(e traffic.Exchange) bool {
+				return e.Method == "DELETE" && strings.HasPrefix(e.Path, "/api/user/") && e.Status == 404
+			}),
+		honeypot("route.wrong-method", "Using a method a route does not support",
+			"405 Method Not Allowed with an Allow header is exactly right for a known path and an unsupported method (RFC 9110 §15.5.6).",
+			[]string{"method", "405", "allowed", "put", "patch"},
+			func(e traffic.Exchange) bool { return e.Status == 405 }),
+		honeypot("health.get", "Checking health with GET /api/health-check",
+			"A plain 200 OK with a JSON body is what a health check should answer.",
+			[]string{"health", "check", "get", "200"},
+			func(e traffic.Exchange) bool {
+				return e.Method == "GET" && e.Path == "/api/health-check" && e.Status == 200
+			}),
+		honeypot("login.wrong-password", "Logging in with a wrong password",
+			"401 Unauthorized is the right answer to wrong credentials (RFC 9110 §15.5.2).",
+			[]string{"login", "password", "wrong", "401", "credentials"},
+			func(e traffic.Exchange) bool {
+				return e.Method == "POST" && e.Path == "/api/login" && e.Status == 401
+			}),
+	}
+
+	optionalTitles := map[string]string{
+		"rate-limit.disguise":          "Sending requests faster than the rate limit",
+		"rate-limit.ok":                "Sending requests faster than the rate limit",
+		"rate-limit.slow":              "Sending requests faster than the rate limit",
+		"auth.hide":                    "Calling a protected route without the right credentials",
+		"auth.ok":                      "Calling a protected route without the right credentials",
+		"auth.expired-token-accepted":  "Calling a protected route with an expired token",
+		"articles.list.newest-missing": "Listing articles right after creating one",
+		"articles.list.shuffled":       "Listing articles several times",
+		"article.delete.delayed":       "Listing articles right after deleting one",
+		"user.create.cacheable":        "The headers of a new user's response",
+	}
+	optionalKeywords := map[string][]string{
+		"rate-limit.disguise":          {"rate", "limit", "throttle", "many", "fast", "500", "429"},
+		"rate-limit.ok":                {"rate", "limit", "throttle", "many", "fast", "200", "429"},
+		"rate-limit.slow":              {"rate", "limit", "throttle", "slow", "sluggish", "delay", "429"},
+		"auth.hide":                    {"auth", "unauthorized", "forbidden", "token", "credentials", "404", "401", "403"},
+		"auth.ok":                      {"auth", "unauthorized", "forbidden", "token", "credentials", "200", "401", "403"},
+		"auth.expired-token-accepted":  {"expired", "token", "accepted", "auth", "401"},
+		"articles.list.newest-missing": {"newest", "missing", "latest", "last", "new", "list", "articles", "body"},
+		"articles.list.shuffled":       {"order", "ordering", "shuffled", "random", "sorted", "list", "articles"},
+		"article.delete.delayed":       {"delay", "delayed", "later", "still", "timing", "delete", "article"},
+		"user.create.cacheable":        {"cache", "cache-control", "header", "public", "api", "key", "user"},
+	}
+	for _, name := range optional {
+		title, ok := optionalTitles[name]
+		if !ok {
+			continue
+		}
+		if q, ok := quirks.Lookup(name); ok && q.Hidden {
+			defects = append(defects, hiddenDefect(q, title, optionalKeywords[name]...))
+			continue
+		}
+		defects = append(defects, noteDefect(name, title, optionalKeywords[name]...))
+	}
+	return defects
+}
+
+// quirkDefect is a wrong status code from the quirk catalog
+func quirkDefect(name, title string, keywords ...string) Defect {
+	q, _ := quirks.Lookup(name)
+	return Defect{
+		ID:          name,
+		Title:       title,
+		Points:      10,
+		Category:    CategoryWrongStatus,
+		Explanation: fmt.Sprintf("%s: it should be %d, but the server answers %d (%d at the intermediate level).", q.Description, q.Intended, q.Strange, q.Plausible),
+		Keywords:    keywords,
+		shows:       quirkApplied(name),
+	}
+}
+
+// noteDefect is a wrong status code planted by an optional fault, such as
+// a disguised rate limit
+func noteDefect(name, title string, keywords ...string) Defect {
+	return Defect{
+		ID:          name,
+		Title:       title,
+		Points:      15,
+		Category:    CategoryWrongStatus,
+		Explanation: "The server hides what really happened behind a different status code (quirk " + name + ").",
+		Keywords:    keywords,
+		shows:       quirkApplied(name),
+	}
+}
+
+// hiddenDefect is a bug of the expert level, behind a correct status code
+func hiddenDefect(q quirks.Quirk, title string, keywords ...string) Defect {
+	return Defect{
+		ID:          q.Name,
+		Title:       title,
+		Points:      20,
+		Category:    CategoryHidden,
+		Explanation: q.Description + ", even though the status code is right.",
+		Keywords:    keywords,
+		shows:       quirkApplied(q.Name),
+	}
+}
+
+// honeypot is correct behavior that invites a false report
+func honeypot(id, title, explanation string, keywords []string, match func(traffic.Exchange) bool) Defect {
+	return Defect{
+		ID:          id,
+		Title:       title,
+		Points:      10,
+		Category:    CategoryHoneypot,
+		Explanation: "Nothing wrong here. " + explanation,
+		Keywords:    keywords,
+		shows:       func(evidence []traffic.Exchange) bool { return slices.ContainsFunc(evidence, match) },
+	}
+}
+
+// quirkApplied shows a defect through the quirks recorded with an exchange
+func quirkApplied(name string) func([]traffic.Exchange) bool {
+	return func(evidence []traffic.Exchange) bool {
+		return slices.ContainsFunc(evidence, func(e traffic.Exchange) bool {
+			for _, q := range e.Quirks {
+				if q.Name == name {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
+// repeatedDelete shows an article deleted successfully and then deleted
+// again with anything but 404 or 204
+func repeatedDelete(evidence []traffic.Exchange) bool {
+	deleted := map[string]bool{}
+	for _, e := range evidence {
+		if e.Method != "DELETE" || !strings.HasPrefix(e.Path, "/api/article/") {
+			continue
+		}
+		switch {
+		case e.Status >= 200 && e.Status < 300 && !deleted[e.Path]:
+			deleted[e.Path] = true
+		case deleted[e.Path] && e.Status != 404 && e.Status != 204:
+			return true
+		}
+	}
+	return false
+}
@@ -1,29 +1,110 @@
 package config
 
 import (
-	"os"
+	"time"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Port     string
-	DBPath   string
-	LogLevel string
+	Port      string
+	DBPath    string
+	LogLevel  string
+	LogFormat string // "text" or "json"
+
+	QuirkProfile string // a quirk profile or difficulty, e.g. "strange" or "expert"
+
+	TrafficBuffer int // how many recent exchanges are kept for reports
+
+	// Recording. Full recordings keep headers and request bodies too.
+	RecordTraffic bool
+	RecordFile    string // appends every exchange as JSONL when set
+
+	// Replay. A ReplayFile answers requests from a recording (HAR or JSONL).
+	ReplayFile string
+	ReplayMiss string // "passthrough", "404" or "200"
+
+	// Proxy mode. A ProxyUpstream forwards the API to a real service.
+	ProxyUpstream string
+	ProxyLatency  time.Duration
+	ProxyJitter   time.Duration
+
+	// Mock mode. A MockSpec serves examples from an OpenAPI 2/3 document.
+	MockSpec string
+
+	// Tracing
+	TracingExporter string // "none", "stdout" or "otlp"
+	OTLPEndpoint    string // OTLP/HTTP traces endpoint
+	ServiceName     string
+
+	// HTTP server timeouts
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // how long in-flight requests get to finish
+
+	// Rate limiting. A RateLimit of 0 disables the limiter.
+	RateLimit       float64 // tokens per second
+	RateBurst       int
+	RateLimitKey    string // "ip" or "api-key"
+	RateLimitMode   string // "honest", "disguise", "ok" or "slow"
+	RateLimitRoutes string // per-route limits, e.g. "/api/article=1:2,/api/user=0.5:1"
+
+	// Authentication. An empty AuthSecret generates a random one at startup.
+	AuthRequired    bool
+	AuthSecret      string
+	AuthTokenTTL    time.Duration
+	AuthGracePeriod time.Duration // expired tokens are still accepted this long
+	AuthFailureMode string        // "honest", "hide" or "ok"
+
+	// Authorization
+	AdminPassword string // creates an "admin" user at startup when set
+	IDORBug       bool   // disables article ownership checks
+
+	// Challenge mode scores trainees hunting for the planted defects
+	ChallengeMode bool
+
+	// Tenants. A TenantKey gives every tenant a sandbox of its own.
+	TenantKey         string // "header:NAME", "cookie:NAME" or "subdomain:DOMAIN"
+	TenantDir         string // sandbox databases are files here, in memory if empty
+	TenantSeed        string // YAML or JSON seed file, a copy of db-path if empty
+	TenantIdleTimeout time.Duration
+	TenantMax         int
 }
 
-// LoadConfig loads configuration from environment variables with defaults
-func LoadConfig() *Config {
+// Default returns the configuration used when nothing is set
+func Default() *Config {
 	return &Config{
-		Port:     getEnv("PORT", ":3000"),
-		DBPath:   getEnv("DB_PATH", "./database.db"),
-		LogLevel: getEnv("LOG_LEVEL", "info"),
-	}
-}
+		Port:      ":3000",
+		DBPath:    "./database.db",
+		LogLevel:  "info",
+		LogFormat: "text",
+
+		QuirkProfile: "strange",
+
+		TrafficBuffer: 1000,
+
+		ReplayMiss: "passthrough",
+
+		TracingExporter: "none",
+		OTLPEndpoint:    "http://localhost:4318/v1/traces",
+		ServiceName:     "strange-errors-server",
+
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   10 * time.Second,
+
+		RateBurst:     5,
+		RateLimitKey:  "ip",
+		RateLimitMode: "disguise",
+
+		AuthTokenTTL:    time.Hour,
+		AuthGracePeriod: 10 * time.Minute,
+		AuthFailureMode: "hide",
 
-// getEnv gets an environment variable with a fallback default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+		TenantIdleTimeout: 30 * time.Minute,
+		TenantMax:         100,
 	}
-	return defaultValue
 }
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a config file into a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// load runs a Loader over args the way the server binary does
+func load(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parse %v: %v", args, err)
+	}
+	return loader.Load()
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default configuration is invalid: %v", err)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	file := writeFile(t, "server.yaml", "port: \":4000\"\nQUIRK_PROFILE: honest\nrate-limit: 2\n")
+	t.Setenv(FileEnv, "")
+	t.Setenv("PORT", ":5000")
+	t.Setenv("RATE_LIMIT", "3")
+
+	cfg, err := load(t, "-config", file, "-rate-limit", "4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != ":5000" {
+		t.Errorf("port = %q, want the environment to win over the file", cfg.Port)
+	}
+	if cfg.QuirkProfile != "honest" {
+		t.Errorf("quirk profile = %q, want the file to win over the default", cfg.QuirkProfile)
+	}
+	if cfg.RateLimit != 4 {
+		t.Errorf("rate limit = %g, want the flag to win over everything", cfg.RateLimit)
+	}
+	if cfg.ShutdownTimeout != 10*time.Second {
+		t.Errorf("shutdown timeout = %s, want the default", cfg.ShutdownTimeout)
+	}
+}
+
+func TestTOML(t *testing.T) {
+	file := writeFile(t, "server.toml", `# a comment
+port = ":4000"   # trailing comment
+DB_PATH = '/tmp/with # hash.db'
+rate-limit = 1_000
+idor-bug = true
+read-timeout = "3s"
+`)
+	t.Setenv(FileEnv, "")
+	cfg, err := load(t, "-config", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != ":4000" || cfg.DBPath != "/tmp/with # hash.db" || cfg.RateLimit != 1000 || !cfg.IDORBug || cfg.ReadTimeout != 3*time.Second {
+		t.Errorf("unexpected configuration: %+v", cfg)
+	}
+
+	for _, bad := range []string{
+		"[server]\nport = \":4000\"",
+		"port = :4000",
+		"port = \":4000",
+		"ports = [1, 2]",
+		"port = \":4000\"\nport = \":5000\"",
+	} {
+		if _, err := parseTOML([]byte(bad)); err == nil {
+			t.Errorf("parseTOML(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"port without colon", func(c *Config) { c.Port = "3000" }, `port: "3000" has no colon; use ":3000"`},
+		{"port out of range", func(c *Config) { c.Port = ":70000" }, "port: "},
+		{"log level", func(c *Config) { c.LogLevel = "loud" }, "log-level: "},
+		{"quirk profile", func(c *Config) { c.QuirkProfile = "odd" }, "quirk-profile: "},
+		{"record file without recording", func(c *Config) { c.RecordFile = "out.jsonl" }, "record-file: "},
+		{"relative upstream", func(c *Config) { c.ProxyUpstream = "example.com" }, "proxy-upstream: "},
+		{"negative timeout", func(c *Config) { c.ReadTimeout = -time.Second }, "read-timeout: "},
+		{"zero burst", func(c *Config) { c.RateBurst = 0 }, "rate-burst: "},
+		{"route limits", func(c *Config) { c.RateLimitRoutes = "api=1" }, "rate-limit-routes: "},
+		{"auth failure mode", func(c *Config) { c.AuthFailureMode = "shrug" }, "auth-failure-mode: "},
+		{"tenant key", func(c *Config) { c.TenantKey = "query:tenant" }, "tenant-key: "},
+		{"tenant seed without key", func(c *Config) { c.TenantSeed = "seed.yaml" }, "tenant-seed: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported at once
+	cfg := Default()
+	cfg.Port = "3000"
+	cfg.LogLevel = "loud"
+	if err := cfg.Validate(); err == nil || strings.Count(err.Error(), "\n") != 1 {
+		t.Errorf("Validate() = %v, want two problems", err)
+	}
+}
+
+func TestLoadReportsUnknownSettings(t *testing.T) {
+	file := writeFile(t, "server.yaml", "prot: \":4000\"\n")
+	t.Setenv(FileEnv, "")
+	if _, err := load(t, "-config", file); err == nil || !strings.Contains(err.Error(), `unknown setting "prot"`) {
+		t.Errorf("Load() = %v, want an unknown setting error", err)
+	}
+}
+
+func TestChangedAndCopyFrom(t *testing.T) {
+	a, b := Default(), Default()
+	b.QuirkProfile = "honest"
+	b.RateLimit = 5
+	b.ReadTimeout = time.Second
+
+	changed := Changed(a, b)
+	if !slices.Equal(changed, []string{"quirk-profile", "read-timeout", "rate-limit"}) {
+		t.Fatalf("Changed() = %v", changed)
+	}
+	a.CopyFrom(b, "quirk-profile", "rate-limit")
+	if got := Changed(a, b); !slices.Equal(got, []string{"read-timeout"}) {
+		t.Errorf("after CopyFrom, Changed() = %v, want only read-timeout", got)
+	}
+}
+
+func TestWriteRoundTrips(t *testing.T) {
+	cfg := Default()
+	cfg.Port = "127.0.0.1:4000"
+	cfg.RateLimitRoutes = "/api/article=1:2"
+	cfg.AuthSecret = "hunter2"
+
+	var out strings.Builder
+	cfg.Write(&out)
+	if strings.Contains(out.String(), "hunter2") {
+		t.Error("Write() printed a secret")
+	}
+
+	file := writeFile(t, "server.yaml", out.String())
+	loaded := Default()
+	if err := loaded.LoadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded.AuthSecret = cfg.AuthSecret
+	if changed := Changed(cfg, loaded); len(changed) > 0 {
+		t.Errorf("settings lost in the round trip: %v", changed)
+	}
+}
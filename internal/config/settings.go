@@ -0,0 +1,360 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// FileEnv names the environment variable pointing at a config file
+const FileEnv = "CONFIG_FILE"
+
+// setting is one configuration value: its key in config files and on the
+// command line, its environment variable and the Config field holding it
+type setting struct {
+	key    string // e.g. "db-path"
+	env    string // e.g. "DB_PATH"
+	usage  string
+	value  any  // *string, *int, *float64, *bool or *time.Duration
+	secret bool // left out of printed configurations
+}
+
+// settings lists every configuration value of c
+func (c *Config) settings() []setting {
+	return []setting{
+		{"port", "PORT", "address to listen on", &c.Port, false},
+		{"db-path", "DB_PATH", "SQLite database file", &c.DBPath, false},
+		{"log-level", "LOG_LEVEL", "debug, info, warn or error", &c.LogLevel, false},
+		{"log-format", "LOG_FORMAT", "text or json", &c.LogFormat, false},
+		{"quirk-profile", "QUIRK_PROFILE", "beginner (strange), intermediate (plausible), expert (subtle) or honest", &c.QuirkProfile, false},
+		{"traffic-buffer", "TRAFFIC_BUFFER", "recent exchanges kept for reports", &c.TrafficBuffer, false},
+		{"record-traffic", "RECORD_TRAFFIC", "keep full exchanges for download", &c.RecordTraffic, false},
+		{"record-file", "RECORD_FILE", "append every exchange to this JSONL file", &c.RecordFile, false},
+		{"replay-file", "REPLAY_FILE", "answer from this HAR or JSONL recording", &c.ReplayFile, false},
+		{"replay-miss", "REPLAY_MISS", "passthrough, 404 or 200 for requests not in the recording", &c.ReplayMiss, false},
+		{"proxy-upstream", "PROXY_UPSTREAM", "forward the API to this URL", &c.ProxyUpstream, false},
+		{"proxy-latency", "PROXY_LATENCY", "delay added to every proxied request", &c.ProxyLatency, false},
+		{"proxy-jitter", "PROXY_JITTER", "random extra delay of up to this much", &c.ProxyJitter, false},
+		{"mock-spec", "MOCK_SPEC", "serve examples from this OpenAPI 2/3 document", &c.MockSpec, false},
+		{"tracing-exporter", "TRACING_EXPORTER", "none, stdout or otlp", &c.TracingExporter, false},
+		{"otlp-endpoint", "OTLP_ENDPOINT", "OTLP/HTTP traces endpoint", &c.OTLPEndpoint, false},
+		{"service-name", "SERVICE_NAME", "service name reported with spans", &c.ServiceName, false},
+		{"read-timeout", "READ_TIMEOUT", "maximum time to read a request", &c.ReadTimeout, false},
+		{"read-header-timeout", "READ_HEADER_TIMEOUT", "maximum time to read request headers", &c.ReadHeaderTimeout, false},
+		{"write-timeout", "WRITE_TIMEOUT", "maximum time to write a response", &c.WriteTimeout, false},
+		{"idle-timeout", "IDLE_TIMEOUT", "keep-alive timeout", &c.IdleTimeout, false},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "time in-flight requests get to finish", &c.ShutdownTimeout, false},
+		{"rate-limit", "RATE_LIMIT", "requests per second per client, 0 to disable", &c.RateLimit, false},
+		{"rate-burst", "RATE_BURST", "requests allowed in a burst", &c.RateBurst, false},
+		{"rate-limit-key", "RATE_LIMIT_KEY", "ip or api-key", &c.RateLimitKey, false},
+		{"rate-limit-mode", "RATE_LIMIT_MODE", "honest, disguise, ok or slow", &c.RateLimitMode, false},
+		{"rate-limit-routes", "RATE_LIMIT_ROUTES", "per-route limits, e.g. /api/article=1:2", &c.RateLimitRoutes, false},
+		{"auth-required", "AUTH_REQUIRED", "require credentials for changes", &c.AuthRequired, false},
+		{"auth-secret", "AUTH_SECRET", "HMAC secret for tokens, random if empty", &c.AuthSecret, true},
+		{"auth-token-ttl", "AUTH_TOKEN_TTL", "token lifetime", &c.AuthTokenTTL, false},
+		{"auth-grace-period", "AUTH_GRACE_PERIOD", "how long expired tokens are still accepted", &c.AuthGracePeriod, false},
+		{"auth-failure-mode", "AUTH_FAILURE_MODE", "honest, hide or ok", &c.AuthFailureMode, false},
+		{"admin-password", "ADMIN_PASSWORD", "create an admin user with this password", &c.AdminPassword, true},
+		{"idor-bug", "IDOR_BUG", "disable article ownership checks", &c.IDORBug, false},
+		{"challenge-mode", "CHALLENGE_MODE", "score trainees reporting the planted defects", &c.ChallengeMode, false},
+		{"tenant-key", "TENANT_KEY", "give every tenant a sandbox, by header:NAME, cookie:NAME or subdomain:DOMAIN", &c.TenantKey, false},
+		{"tenant-dir", "TENANT_DIR", "directory for sandbox databases, in memory if empty", &c.TenantDir, false},
+		{"tenant-seed", "TENANT_SEED", "YAML or JSON file sandboxes start from, a copy of db-path if empty", &c.TenantSeed, false},
+		{"tenant-idle-timeout", "TENANT_IDLE_TIMEOUT", "drop sandboxes unused for this long", &c.TenantIdleTimeout, false},
+		{"tenant-max", "TENANT_MAX", "sandboxes that may exist at once", &c.TenantMax, false},
+	}
+}
+
+// set parses raw into the field of s
+func (s setting) set(raw string) error {
+	switch v := s.value.(type) {
+	case *string:
+		*v = raw
+	case *int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		*v = n
+	case *float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		*v = f
+	case *bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		*v = b
+	case *time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 10s or 5m", raw)
+		}
+		*v = d
+	}
+	return nil
+}
+
+// format returns the value of s the way set accepts it
+func (s setting) format() string {
+	switch v := s.value.(type) {
+	case *string:
+		return *v
+	case *int:
+		return strconv.Itoa(*v)
+	case *float64:
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	case *bool:
+		return strconv.FormatBool(*v)
+	case *time.Duration:
+		return v.String()
+	}
+	return ""
+}
+
+// LoadEnv applies the environment variables that are set. Every valid value
+// is applied; the invalid ones are reported together.
+func (c *Config) LoadEnv() error {
+	var errs []error
+	for _, s := range c.settings() {
+		raw := os.Getenv(s.env)
+		if raw == "" {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadFile applies a YAML, JSON or, with a .toml extension, TOML config
+// file. Keys are the flag names ("db-path") or the environment variable
+// names ("DB_PATH").
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	parse := parseFile
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		parse = parseTOML
+	}
+	values, err := parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return c.apply(path, values)
+}
+
+// parseFile decodes a YAML or JSON document into raw values per key
+func parseFile(data []byte) (map[string]string, error) {
+	converted, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(converted, &doc); err != nil {
+		return nil, fmt.Errorf("want a mapping of settings: %w", err)
+	}
+
+	values := make(map[string]string, len(doc))
+	for key, value := range doc {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		case nil:
+			values[key] = ""
+		default:
+			return nil, fmt.Errorf("%s: want a single value, got %T", key, value)
+		}
+	}
+	return values, nil
+}
+
+// apply sets raw values by key, naming source in errors
+func (c *Config) apply(source string, values map[string]string) error {
+	byKey := make(map[string]setting)
+	for _, s := range c.settings() {
+		byKey[s.key] = s
+		byKey[s.env] = s
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		raw := values[key]
+		s, ok := byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", source, key))
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", source, key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flagValue collects a command-line value until the file and the
+// environment have been applied, so that it can win over both
+type flagValue struct {
+	s       setting
+	def     string
+	pending map[string]string
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.def
+}
+
+func (f *flagValue) Set(raw string) error {
+	probe := f.s
+	switch f.s.value.(type) {
+	case *string:
+		probe.value = new(string)
+	case *int:
+		probe.value = new(int)
+	case *float64:
+		probe.value = new(float64)
+	case *bool:
+		probe.value = new(bool)
+	case *time.Duration:
+		probe.value = new(time.Duration)
+	}
+	if err := probe.set(raw); err != nil {
+		return err
+	}
+	f.pending[f.s.key] = raw
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be passed as a bare -flag
+func (f *flagValue) IsBoolFlag() bool {
+	_, ok := f.s.value.(*bool)
+	return ok
+}
+
+// Loader builds the configuration from, in increasing order of precedence,
+// the defaults, a config file (-config or CONFIG_FILE), the environment and
+// the command-line flags
+type Loader struct {
+	file    *string
+	pending map[string]string
+}
+
+// NewLoader creates a new Loader instance, registering a flag per setting on fs
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{pending: make(map[string]string)}
+	for _, s := range Default().settings() {
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		fs.Var(&flagValue{s: s, def: s.format(), pending: l.pending}, s.key, usage)
+	}
+	l.file = fs.String("config", os.Getenv(FileEnv), "YAML, JSON or TOML config file (env "+FileEnv+")")
+	return l
+}
+
+// File returns the config file in use, if any
+func (l *Loader) File() string {
+	return *l.file
+}
+
+// Load loads and validates the configuration once the flag set has been
+// parsed. It can be called again later to pick up changes to the file or
+// the environment; the flags still win.
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+	if *l.file != "" {
+		if err := cfg.LoadFile(*l.file); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.LoadEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.apply("command line", l.pending); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Write writes the configuration as a YAML config file that LoadFile
+// accepts. Secrets are masked.
+func (c *Config) Write(w io.Writer) {
+	for _, s := range c.settings() {
+		value := s.format()
+		if s.secret && value != "" {
+			value = "********"
+		}
+		fmt.Fprintf(w, "%s: %s\n", s.key, yamlString(value, s))
+	}
+}
+
+// yamlString quotes string values that YAML would otherwise read as
+// something else, such as ":3000" or "200"
+func yamlString(value string, s setting) string {
+	if _, ok := s.value.(*string); !ok {
+		return value
+	}
+	if value == "" || strings.ContainsAny(value, ":#{}[],&*!|>'\"%@`") || strings.TrimSpace(value) != value {
+		return strconv.Quote(value)
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.Quote(value)
+	}
+	if _, err := strconv.ParseBool(value); err == nil {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// Changed lists the keys of the settings that differ between a and b
+func Changed(a, b *Config) []string {
+	var keys []string
+	before, after := a.settings(), b.settings()
+	for i := range before {
+		if before[i].format() != after[i].format() {
+			keys = append(keys, before[i].key)
+		}
+	}
+	return keys
+}
+
+// CopyFrom copies the settings with the given keys from other
+func (c *Config) CopyFrom(other *Config, keys ...string) {
+	from := other.settings()
+	for i, s := range c.settings() {
+		if slices.Contains(keys, s.key) {
+			s.set(from[i].format())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML decodes the part of TOML a config file needs: top-level
+// "key = value" pairs with strings, numbers and booleans, and comments.
+// Settings are flat, so tables and arrays are rejected.
+func parseTOML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported, settings go at the top level", n+1)
+		}
+
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key = value", n+1)
+		}
+		key = strings.TrimSpace(key)
+		if unquoted, err := strconv.Unquote(key); err == nil {
+			key = unquoted
+		}
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", n+1)
+		}
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", n+1, key)
+		}
+
+		value, err := tomlValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n+1, key, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// tomlValue decodes a single value, dropping a trailing comment
+func tomlValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		end := closingQuote(raw)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if err := trailing(raw[end+1:]); err != nil {
+			return "", err
+		}
+		return strconv.Unquote(raw[:end+1])
+	case strings.HasPrefix(raw, "'"):
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if err := trailing(raw[end+2:]); err != nil {
+			return "", err
+		}
+		return raw[1 : end+1], nil
+	case strings.HasPrefix(raw, "[") || strings.HasPrefix(raw, "{"):
+		return "", fmt.Errorf("want a single value, got an array or table")
+	}
+
+	if i := strings.Index(raw, "#"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	if raw == "true" || raw == "false" {
+		return raw, nil
+	}
+	number := strings.ReplaceAll(raw, "_", "")
+	if _, err := strconv.ParseFloat(number, 64); err == nil {
+		return number, nil
+	}
+	return "", fmt.Errorf("%q is not a string, number or boolean (quote strings)", raw)
+}
+
+// closingQuote returns the index of the quote ending a basic string, or -1
+func closingQuote(raw string) int {
+	for i := 1; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// trailing accepts what may follow a value: nothing or a comment
+func trailing(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after the value", rest)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/replay"
+	"strange-errors-server/internal/tenant"
+)
+
+// Validate checks every setting and reports all problems together, each
+// prefixed with the setting's key
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(key string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	check("port", validateAddress(c.Port))
+	if c.DBPath == "" {
+		check("db-path", errors.New("must not be empty"))
+	}
+	var level slog.Level
+	if level.UnmarshalText([]byte(c.LogLevel)) != nil {
+		check("log-level", fmt.Errorf("unknown log level %q (want debug, info, warn or error)", c.LogLevel))
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "", "text", "json":
+	default:
+		check("log-format", fmt.Errorf("unknown log format %q (want text or json)", c.LogFormat))
+	}
+	_, err := quirks.ByName(c.QuirkProfile)
+	check("quirk-profile", err)
+	if c.TrafficBuffer < 0 {
+		check("traffic-buffer", fmt.Errorf("%d is negative", c.TrafficBuffer))
+	}
+
+	if c.RecordFile != "" && !c.RecordTraffic {
+		check("record-file", errors.New("is only written with record-traffic enabled"))
+	}
+	_, err = replay.ParseMissMode(c.ReplayMiss)
+	check("replay-miss", err)
+	if c.ProxyUpstream != "" {
+		check("proxy-upstream", validateURL(c.ProxyUpstream))
+	}
+	check("proxy-latency", nonNegative(c.ProxyLatency))
+	check("proxy-jitter", nonNegative(c.ProxyJitter))
+
+	switch c.TracingExporter {
+	case "", "none", "stdout":
+	case "otlp":
+		check("otlp-endpoint", validateURL(c.OTLPEndpoint))
+	default:
+		check("tracing-exporter", fmt.Errorf("unknown tracing exporter %q (want none, stdout or otlp)", c.TracingExporter))
+	}
+
+	// A zero HTTP timeout means no timeout, which net/http allows
+	check("read-timeout", nonNegative(c.ReadTimeout))
+	check("read-header-timeout", nonNegative(c.ReadHeaderTimeout))
+	check("write-timeout", nonNegative(c.WriteTimeout))
+	check("idle-timeout", nonNegative(c.IdleTimeout))
+	check("shutdown-timeout", positive(c.ShutdownTimeout))
+
+	if c.RateLimit < 0 {
+		check("rate-limit", fmt.Errorf("%g is negative; use 0 to disable rate limiting", c.RateLimit))
+	}
+	if c.RateBurst < 1 {
+		check("rate-burst", fmt.Errorf("%d allows no request at all (want 1 or more)", c.RateBurst))
+	}
+	if c.RateLimitKey != "ip" && c.RateLimitKey != "api-key" {
+		check("rate-limit-key", fmt.Errorf("unknown rate limit key %q (want ip or api-key)", c.RateLimitKey))
+	}
+	_, err = middleware.ParseRejectMode(c.RateLimitMode)
+	check("rate-limit-mode", err)
+	_, err = middleware.ParseRouteLimits(c.RateLimitRoutes)
+	check("rate-limit-routes", err)
+
+	check("auth-token-ttl", positive(c.AuthTokenTTL))
+	check("auth-grace-period", nonNegative(c.AuthGracePeriod))
+	_, err = auth.ParseFailureMode(c.AuthFailureMode)
+	check("auth-failure-mode", err)
+
+	if c.TenantKey != "" {
+		_, err = tenant.ParseKey(c.TenantKey)
+		check("tenant-key", err)
+	} else {
+		if c.TenantDir != "" {
+			check("tenant-dir", errors.New("is only used with a tenant-key"))
+		}
+		if c.TenantSeed != "" {
+			check("tenant-seed", errors.New("is only used with a tenant-key"))
+		}
+	}
+	check("tenant-idle-timeout", positive(c.TenantIdleTimeout))
+	if c.TenantMax < 1 {
+		check("tenant-max", fmt.Errorf("%d allows no sandbox at all (want 1 or more)", c.TenantMax))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateAddress checks a listen address such as ":3000" or "127.0.0.1:3000"
+func validateAddress(addr string) error {
+	if !strings.Contains(addr, ":") {
+		if _, err := strconv.Atoi(addr); err == nil {
+			return fmt.Errorf("%q has no colon; use \":%s\" to listen on port %s of every interface", addr, addr, addr)
+		}
+		return fmt.Errorf("%q has no port; use host:port such as \":3000\"", addr)
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%q is not host:port such as \":3000\"", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("%q has no valid port number (want 0-65535)", addr)
+	}
+	return nil
+}
+
+// validateURL checks for an absolute http or https URL
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute http or https URL", raw)
+	}
+	return nil
+}
+
+// nonNegative rejects negative durations
+func nonNegative(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("%s is negative", d)
+	}
+	return nil
+}
+
+// positive rejects durations that are zero or negative
+func positive(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s must be longer than zero", d)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Watch calls changed whenever the file at path is modified, replaced or
+// comes back after being removed, until ctx is done. It polls the
+// modification time and size every interval, which also notices editors
+// that save by renaming a new file over the old one.
+func Watch(ctx context.Context, path string, interval time.Duration, changed func()) {
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			// Keep the last version; the file may be in the middle of a save
+			continue
+		}
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			changed()
+		}
+	}
+}
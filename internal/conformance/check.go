@@ -0,0 +1,359 @@
+// Package conformance drives every operation of an API description against
+// a running server and reports where the behavior departs from the document.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"strange-errors-server/internal/openapi"
+)
+
+// Kinds of findings
+const (
+	UndocumentedStatus = "undocumented-status"
+	WrongContentType   = "wrong-content-type"
+	SchemaViolation    = "schema-violation"
+	UndocumentedMethod = "undocumented-method"
+	UnmatchedRoute     = "unmatched-route"
+	RequestFailed      = "request-failed"
+)
+
+// missingID is sent for integer path parameters so that probes do not
+// delete or change real records
+const missingID = "999999"
+
+// Finding is one mismatch between the document and the server
+type Finding struct {
+	Kind      string `json:"kind"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Probe     string `json:"probe"`
+	Status    int    `json:"status,omitempty"`
+	Detail    string `json:"detail"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Report is the outcome of a check
+type Report struct {
+	Document   string    `json:"document"`
+	Target     string    `json:"target"`
+	Operations int       `json:"operations"`
+	Requests   int       `json:"requests"`
+	Findings   []Finding `json:"findings"`
+}
+
+// Counts returns the number of findings per kind
+func (r Report) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, f := range r.Findings {
+		counts[f.Kind]++
+	}
+	return counts
+}
+
+// Checker checks a document against a running server
+type Checker struct {
+	doc      *openapi.Document
+	target   *url.URL
+	client   *http.Client
+	headers  http.Header
+	methods  []string // extra methods to try on every documented path
+	mutating bool     // send example requests that may change the server's state
+}
+
+// NewChecker creates a new Checker instance
+func NewChecker(doc *openapi.Document, target *url.URL, client *http.Client) *Checker {
+	return &Checker{doc: doc, target: target, client: client, headers: make(http.Header)}
+}
+
+// SetHeader sends a header with every request, e.g. Authorization
+func (c *Checker) SetHeader(name, value string) {
+	c.headers.Set(name, value)
+}
+
+// SetProbeMethods makes the checker try these methods on every documented
+// path that does not document them
+func (c *Checker) SetProbeMethods(methods []string) {
+	c.methods = methods
+}
+
+// SetMutating allows requests that may change the server's state: the
+// example requests of operations with unsafe methods, such as POST. Without
+// it those operations only get the malformed probes, which a server should
+// reject before touching anything.
+func (c *Checker) SetMutating(mutating bool) {
+	c.mutating = mutating
+}
+
+// safeMethods do not change the server's state (RFC 9110 §9.2.1)
+var safeMethods = map[string]bool{"GET": true, "HEAD": true, "OPTIONS": true, "TRACE": true}
+
+// probe is one request sent for an operation
+type probe struct {
+	name  string
+	path  string
+	body  []byte
+	query url.Values
+}
+
+// Run sends the probes and collects the findings
+func (c *Checker) Run(ctx context.Context) Report {
+	rep := Report{Target: c.target.String(), Operations: len(c.doc.Operations)}
+
+	documented := make(map[string]map[string]bool) // path -> methods
+	for _, op := range c.doc.Operations {
+		if documented[op.Path] == nil {
+			documented[op.Path] = make(map[string]bool)
+		}
+		documented[op.Path][op.Method] = true
+		if op.Method == "GET" {
+			// Servers support HEAD wherever they support GET (RFC 9110 §9.3.2)
+			documented[op.Path]["HEAD"] = true
+		}
+
+		for _, p := range c.probes(op) {
+			rep.Requests++
+			rep.Findings = append(rep.Findings, c.checkOperation(ctx, op, p)...)
+		}
+	}
+
+	paths := make([]string, 0, len(documented))
+	for path := range documented {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		findings, requests := c.checkMethods(ctx, path, documented[path])
+		rep.Requests += requests
+		rep.Findings = append(rep.Findings, findings...)
+	}
+
+	rep.Requests++
+	rep.Findings = append(rep.Findings, c.checkUnmatched(ctx)...)
+	return rep
+}
+
+// probes builds the requests sent for an operation: one with example
+// values, one with a malformed path parameter and one with a malformed body.
+// The example is left out for unsafe methods unless mutating is set.
+func (c *Checker) probes(op openapi.Operation) []probe {
+	example := probe{name: "example", path: c.fillPath(op, false), query: url.Values{}}
+	for _, param := range op.Parameters {
+		if param.In == "query" && param.Required {
+			example.query.Set(param.Name, fmt.Sprint(c.doc.ExampleOf(param.Schema)))
+		}
+	}
+	if op.RequestBody != nil {
+		example.body, _ = json.Marshal(c.doc.ExampleOf(op.RequestBody))
+	}
+	var probes []probe
+	if c.mutating || safeMethods[op.Method] {
+		probes = append(probes, example)
+	}
+
+	if badPath := c.fillPath(op, true); badPath != example.path {
+		bad := example
+		bad.name, bad.path = "malformed path parameter", badPath
+		probes = append(probes, bad)
+	}
+	if op.RequestBody != nil {
+		bad := example
+		bad.name, bad.body = "malformed body", []byte(`{"unterminated": `)
+		probes = append(probes, bad)
+	}
+	return probes
+}
+
+// fillPath substitutes path parameters with harmless values, or with values
+// of the wrong type when malformed is set
+func (c *Checker) fillPath(op openapi.Operation, malformed bool) string {
+	path := c.doc.BasePath + op.Path
+	for _, param := range op.Parameters {
+		if param.In != "path" {
+			continue
+		}
+		value := fmt.Sprint(c.doc.ExampleOf(param.Schema))
+		schema := c.doc.Resolve(param.Schema)
+		numeric := schema != nil && (schema.Type.Is("integer") || schema.Type.Is("number"))
+		switch {
+		case malformed && numeric:
+			value = "not-a-number"
+		case numeric:
+			value = missingID
+		}
+		path = strings.ReplaceAll(path, "{"+param.Name+"}", url.PathEscape(value))
+	}
+	return path
+}
+
+// send performs one request
+func (c *Checker) send(ctx context.Context, method, path string, query url.Values, body []byte) (*http.Response, []byte, error) {
+	u := *c.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp, data, err
+}
+
+// checkOperation sends one probe and compares the response with the document
+func (c *Checker) checkOperation(ctx context.Context, op openapi.Operation, p probe) []Finding {
+	finding := func(kind string, status int, detail string, id string) Finding {
+		return Finding{Kind: kind, Method: op.Method, Path: op.Path, Probe: p.name, Status: status, Detail: detail, RequestID: id}
+	}
+
+	resp, body, err := c.send(ctx, op.Method, p.path, p.query, p.body)
+	if err != nil {
+		return []Finding{finding(RequestFailed, 0, err.Error(), "")}
+	}
+	id := resp.Header.Get("X-Request-ID")
+
+	documented, ok := op.Response(resp.StatusCode)
+	if !ok {
+		return []Finding{finding(UndocumentedStatus, resp.StatusCode,
+			fmt.Sprintf("%d is not documented (documented: %s)", resp.StatusCode, statusList(op)), id)}
+	}
+	if documented.Schema == nil || len(body) == 0 {
+		return nil
+	}
+
+	var findings []Finding
+	actualType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	wantType, _, _ := mime.ParseMediaType(documented.ContentType)
+	if wantType != "" && actualType != wantType {
+		findings = append(findings, finding(WrongContentType, resp.StatusCode,
+			fmt.Sprintf("got %q, documented %q", actualType, wantType), id))
+	}
+	if !strings.Contains(actualType, "json") {
+		return findings
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return append(findings, finding(SchemaViolation, resp.StatusCode, "body is not valid JSON: "+err.Error(), id))
+	}
+	for _, problem := range c.doc.Validate(documented.Schema, value) {
+		findings = append(findings, finding(SchemaViolation, resp.StatusCode, problem, id))
+	}
+	return findings
+}
+
+// checkMethods looks for methods a path answers to but the document does
+// not list. A 405 tells through its Allow header; the probe methods are
+// tried directly.
+func (c *Checker) checkMethods(ctx context.Context, path string, documented map[string]bool) ([]Finding, int) {
+	op := openapi.Operation{Path: path}
+	for _, probeOp := range c.doc.Operations {
+		if probeOp.Path == path {
+			op = probeOp
+			break
+		}
+	}
+	filled := c.fillPath(op, false)
+
+	var findings []Finding
+	requests := 0
+	seen := make(map[string]bool)
+	report := func(method, probeName string, status int, detail, id string) {
+		if seen[method] {
+			return
+		}
+		seen[method] = true
+		findings = append(findings, Finding{Kind: UndocumentedMethod, Method: method, Path: path, Probe: probeName, Status: status, Detail: detail, RequestID: id})
+	}
+
+	// An undocumented standard method usually answers 405 with an Allow header
+	requests++
+	resp, _, err := c.send(ctx, "OPTIONS", filled, nil, nil)
+	if err == nil {
+		if !documented["OPTIONS"] && resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented && resp.StatusCode < 400 {
+			report("OPTIONS", "OPTIONS request", resp.StatusCode, fmt.Sprintf("answered %d", resp.StatusCode), resp.Header.Get("X-Request-ID"))
+		}
+		for _, method := range splitAllow(resp.Header.Get("Allow")) {
+			if !documented[method] {
+				report(method, "Allow header", resp.StatusCode, "listed in the Allow header of a 405", resp.Header.Get("X-Request-ID"))
+			}
+		}
+	}
+
+	for _, method := range c.methods {
+		if documented[method] || seen[method] {
+			continue
+		}
+		requests++
+		resp, _, err := c.send(ctx, method, filled, nil, nil)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			report(method, method+" request", resp.StatusCode, fmt.Sprintf("answered %d instead of 405", resp.StatusCode), resp.Header.Get("X-Request-ID"))
+		}
+	}
+	return findings, requests
+}
+
+// checkUnmatched requests a path no document would contain; anything but a
+// 404 is a finding
+func (c *Checker) checkUnmatched(ctx context.Context) []Finding {
+	const path = "/conformance-check/no-such-route"
+	resp, _, err := c.send(ctx, "GET", c.doc.BasePath+path, nil, nil)
+	if err != nil {
+		return []Finding{{Kind: RequestFailed, Method: "GET", Path: path, Probe: "unknown route", Detail: err.Error()}}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return []Finding{{
+		Kind: UnmatchedRoute, Method: "GET", Path: path, Probe: "unknown route", Status: resp.StatusCode,
+		Detail:    fmt.Sprintf("an unknown route answered %d instead of 404", resp.StatusCode),
+		RequestID: resp.Header.Get("X-Request-ID"),
+	}}
+}
+
+// splitAllow parses an Allow header
+func splitAllow(header string) []string {
+	var methods []string
+	for _, method := range strings.Split(header, ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			methods = append(methods, strings.ToUpper(method))
+		}
+	}
+	return methods
+}
+
+// statusList lists the documented status codes of an operation
+func statusList(op openapi.Operation) string {
+	codes := make([]string, 0, len(op.Responses))
+	for _, resp := range op.Responses {
+		codes = append(codes, resp.Status)
+	}
+	return strings.Join(codes, ", ")
+}
@@ -0,0 +1,72 @@
+package conformance
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"strange-errors-server/internal/openapi"
+)
+
+// TestChecksLeaveTheServerAlone makes sure a default check sends nothing
+// that could change the server's state, and -mutating does
+func TestChecksLeaveTheServerAlone(t *testing.T) {
+	doc, err := openapi.Parse([]byte(`{
+		"openapi": "3.0.0",
+		"info": {"title": "t", "version": "1"},
+		"paths": {"/things": {
+			"get": {"responses": {"200": {"description": "list"}}},
+			"post": {
+				"requestBody": {"content": {"application/json": {"schema": {"type": "object", "properties": {"name": {"type": "string"}}}}}},
+				"responses": {"201": {"description": "created"}, "400": {"description": "invalid"}}
+			}
+		}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var changes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method == "GET":
+			w.WriteHeader(200)
+		case r.Method == "POST" && !strings.Contains(string(body), "unterminated"):
+			mu.Lock()
+			changes = append(changes, r.Method)
+			mu.Unlock()
+			w.WriteHeader(201)
+		case r.Method == "GOAT":
+			mu.Lock()
+			changes = append(changes, r.Method)
+			mu.Unlock()
+			w.WriteHeader(200)
+		default:
+			w.WriteHeader(400)
+		}
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+
+	run := func(mutating bool, methods ...string) []string {
+		changes = nil
+		checker := NewChecker(doc, target, server.Client())
+		checker.SetMutating(mutating)
+		checker.SetProbeMethods(methods)
+		checker.Run(context.Background())
+		return changes
+	}
+	if got := run(false); len(got) != 0 {
+		t.Errorf("default check changed the server with %v", got)
+	}
+	if got := run(true, "GOAT"); len(got) != 2 {
+		t.Errorf("mutating check sent %v, want the POST example and GOAT", got)
+	}
+}
@@ -0,0 +1,39 @@
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// WriteText writes a report as a summary followed by a table of findings
+func WriteText(w io.Writer, r Report) {
+	fmt.Fprintf(w, "Checked %d operations of %s against %s with %d requests\n\n", r.Operations, r.Document, r.Target, r.Requests)
+	if len(r.Findings) == 0 {
+		fmt.Fprintln(w, "No mismatches found.")
+		return
+	}
+
+	counts := r.Counts()
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "%-22s %d\n", kind, counts[kind])
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tOPERATION\tPROBE\tSTATUS\tDETAIL\tREQUEST ID")
+	for _, f := range r.Findings {
+		status := "-"
+		if f.Status != 0 {
+			status = fmt.Sprint(f.Status)
+		}
+		fmt.Fprintf(tw, "%s\t%s %s\t%s\t%s\t%s\t%s\n", f.Kind, f.Method, f.Path, f.Probe, status, f.Detail, f.RequestID)
+	}
+	tw.Flush()
+}
@@ -1,14 +1,16 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 
 	"strange-errors-server/internal/models"
 )
 
 // GetArticles retrieves all articles from the database
-func (db *DB) GetArticles() ([]models.Article, error) {
-	rows, err := db.conn.Query("SELECT id, title, content FROM articles")
+func (db *DB) GetArticles(ctx context.Context) ([]models.Article, error) {
+	rows, err := db.query(ctx, "SELECT id, title, content, owner_id FROM articles")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query articles: %w", err)
 	}
@@ -17,7 +19,7 @@ func (db *DB) GetArticles() ([]models.Article, error) {
 	var articles []models.Article
 	for rows.Next() {
 		var article models.Article
-		err := rows.Scan(&article.ID, &article.Title, &article.Content)
+		err := rows.Scan(&article.ID, &article.Title, &article.Content, &article.OwnerID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan article: %w", err)
 		}
@@ -31,18 +33,31 @@ func (db *DB) GetArticles() ([]models.Article, error) {
 	return articles, nil
 }
 
-// CreateArticle creates a new article in the database
-func (db *DB) CreateArticle(title, content string) error {
-	_, err := db.conn.Exec("INSERT INTO articles (title, content) VALUES (?, ?)", title, content)
+// CreateArticle creates a new article in the database. ownerID is 0 for anonymous articles.
+func (db *DB) CreateArticle(ctx context.Context, title, content string, ownerID int) error {
+	_, err := db.exec(ctx, "INSERT INTO articles (title, content, owner_id) VALUES (?, ?, ?)", title, content, ownerID)
 	if err != nil {
 		return fmt.Errorf("failed to create article: %w", err)
 	}
 	return nil
 }
 
+// GetArticleOwner returns the ID of the user owning an article, or 0 if nobody owns it
+func (db *DB) GetArticleOwner(ctx context.Context, id int) (int, error) {
+	var ownerID int
+	err := db.queryRow(ctx, "SELECT owner_id FROM articles WHERE id = ?", id).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("article with id %d not found", id)
+		}
+		return 0, fmt.Errorf("failed to get article owner: %w", err)
+	}
+	return ownerID, nil
+}
+
 // DeleteArticle deletes an article by ID from the database
-func (db *DB) DeleteArticle(id int) (int64, error) {
-	result, err := db.conn.Exec("DELETE FROM articles WHERE id = ?", id)
+func (db *DB) DeleteArticle(ctx context.Context, id int) (int64, error) {
+	result, err := db.exec(ctx, "DELETE FROM articles WHERE id = ?", id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete article: %w", err)
 	}
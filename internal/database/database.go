@@ -1,9 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -20,6 +22,12 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// Every connection to ":memory:" opens a database of its own, so an
+	// in-memory database has to live on a single connection
+	if IsMemory(dbPath) {
+		conn.SetMaxOpenConns(1)
+	}
+
 	db := &DB{conn: conn}
 	
 	// Initialize the database
@@ -66,8 +74,32 @@ func (db *DB) init() error {
 		return fmt.Errorf("failed to create users table: %w", err)
 	}
 
+	// Credentials were added after the first release, migrate older databases
+	if err := db.addColumn("users", "password_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumn("users", "api_key_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumn("users", "role", "TEXT NOT NULL DEFAULT 'reader'"); err != nil {
+		return err
+	}
+	if err := db.addColumn("articles", "owner_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
 	// Insert test data
-	_, err = db.conn.Exec(`
+	if err := db.insertTestData(context.Background()); err != nil {
+		return err
+	}
+
+	slog.Info("database initialized")
+	return nil
+}
+
+// insertTestData inserts the two articles every fresh database starts with
+func (db *DB) insertTestData(ctx context.Context) error {
+	_, err := db.conn.ExecContext(ctx, `
 		INSERT OR IGNORE INTO articles (id, title, content) VALUES 
 		(1, 'The Absence of Errors', 'Initial article content.'),
 		(2, 'The Double Fallacy', 'Another crucial piece of the puzzle.')
@@ -75,7 +107,74 @@ func (db *DB) init() error {
 	if err != nil {
 		return fmt.Errorf("failed to insert test data: %w", err)
 	}
+	return nil
+}
+
+// Clear deletes every article and user and restarts the IDs at 1
+func (db *DB) Clear(ctx context.Context) error {
+	for _, table := range []string{"articles", "users"} {
+		if _, err := db.exec(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	if _, err := db.exec(ctx, "DELETE FROM sqlite_sequence"); err != nil {
+		return fmt.Errorf("failed to reset IDs: %w", err)
+	}
+	return nil
+}
+
+// Reset brings the database back to its initial state: no users and the
+// two test articles
+func (db *DB) Reset(ctx context.Context) error {
+	if err := db.Clear(ctx); err != nil {
+		return err
+	}
+	return db.insertTestData(ctx)
+}
+
+// Snapshot writes a consistent copy of the database to a new file at path
+func (db *DB) Snapshot(ctx context.Context, path string) error {
+	if _, err := db.exec(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return nil
+}
+
+// IsMemory reports whether a path names an in-memory database
+func IsMemory(dbPath string) bool {
+	return dbPath == ":memory:" || strings.Contains(dbPath, "mode=memory")
+}
 
-	log.Println("✅ Database initialized successfully")
+// addColumn adds a column to an existing table unless it is already there
+func (db *DB) addColumn(table, column, definition string) error {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid                 int
+			name, colType       string
+			notNull, primaryKey int
+			defaultValue        sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return fmt.Errorf("failed to scan %s columns: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s columns: %w", table, err)
+	}
+	rows.Close()
+
+	_, err = db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add %s.%s column: %w", table, column, err)
+	}
 	return nil
 }
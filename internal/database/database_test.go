@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"strange-errors-server/internal/models"
+)
+
+// newTestDB opens a fresh in-memory database that is closed when the test ends
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestNewInsertsTestData(t *testing.T) {
+	db := newTestDB(t)
+
+	articles, err := db.GetArticles(context.Background())
+	if err != nil {
+		t.Fatalf("GetArticles: %v", err)
+	}
+	want := []string{"The Absence of Errors", "The Double Fallacy"}
+	if len(articles) != len(want) {
+		t.Fatalf("got %d articles, want %d", len(articles), len(want))
+	}
+	for i, title := range want {
+		if articles[i].ID != i+1 || articles[i].Title != title {
+			t.Errorf("article %d = %d %q, want %d %q", i, articles[i].ID, articles[i].Title, i+1, title)
+		}
+	}
+}
+
+func TestNewIsIdempotentOnFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	for i := 0; i < 2; i++ {
+		db, err := New(path)
+		if err != nil {
+			t.Fatalf("New #%d: %v", i+1, err)
+		}
+		articles, err := db.GetArticles(context.Background())
+		db.Close()
+		if err != nil {
+			t.Fatalf("GetArticles #%d: %v", i+1, err)
+		}
+		if len(articles) != 2 {
+			t.Errorf("open #%d: got %d articles, want 2", i+1, len(articles))
+		}
+	}
+}
+
+func TestArticles(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	if err := db.CreateArticle(ctx, "Title", "Content", 7); err != nil {
+		t.Fatalf("CreateArticle: %v", err)
+	}
+	owner, err := db.GetArticleOwner(ctx, 3)
+	if err != nil || owner != 7 {
+		t.Errorf("GetArticleOwner(3) = %d, %v, want 7, nil", owner, err)
+	}
+	if _, err := db.GetArticleOwner(ctx, 99); err == nil {
+		t.Error("GetArticleOwner(99) succeeded for a missing article")
+	}
+
+	tests := []struct {
+		id   int
+		want int64
+	}{
+		{3, 1},
+		{3, 0},
+		{99, 0},
+		{1, 1},
+	}
+	for _, tt := range tests {
+		got, err := db.DeleteArticle(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("DeleteArticle(%d): %v", tt.id, err)
+		}
+		if got != tt.want {
+			t.Errorf("DeleteArticle(%d) = %d rows, want %d", tt.id, got, tt.want)
+		}
+	}
+
+	articles, _ := db.GetArticles(ctx)
+	if len(articles) != 1 || articles[0].ID != 2 {
+		t.Errorf("remaining articles = %+v, want only article 2", articles)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	tests := []struct {
+		name    string
+		user    string
+		email   string
+		wantErr string
+	}{
+		{"valid", "alice", "alice@example.com", ""},
+		{"duplicate name", "alice", "other@example.com", "user with name 'alice' already exists"},
+		{"no at sign", "bob", "bob.example.com", "internal server error"},
+		{"too short", "bob", "a@b", "internal server error"},
+		{"two at signs", "bob", "bob@@example.com", "internal server error"},
+		{"no dot after at", "bob", "bob@example", "internal server error"},
+		{"second user", "bob", "bob@example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := db.CreateUser(ctx, tt.user, tt.email, models.RoleReader, Credentials{})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("CreateUser error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			if user.Name != tt.user || user.Email != tt.email || user.Role != models.RoleReader {
+				t.Errorf("CreateUser = %+v", user)
+			}
+		})
+	}
+}
+
+func TestUserLookups(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	created, err := db.CreateUser(ctx, "carol", "carol@example.com", models.RoleEditor, Credentials{
+		PasswordHash: "password-hash",
+		APIKeyHash:   "key-hash",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	byName, err := db.GetUserByName(ctx, "carol")
+	if err != nil || byName.ID != created.ID || byName.Role != models.RoleEditor {
+		t.Errorf("GetUserByName = %+v, %v", byName, err)
+	}
+	byID, err := db.GetUserByID(ctx, created.ID)
+	if err != nil || byID.Name != "carol" {
+		t.Errorf("GetUserByID = %+v, %v", byID, err)
+	}
+	byKey, err := db.GetUserByAPIKey(ctx, "key-hash")
+	if err != nil || byKey.ID != created.ID {
+		t.Errorf("GetUserByAPIKey = %+v, %v", byKey, err)
+	}
+	if _, err := db.GetUserByAPIKey(ctx, ""); err == nil {
+		t.Error("GetUserByAPIKey matched an empty key")
+	}
+	user, hash, err := db.GetUserCredentials(ctx, "carol")
+	if err != nil || user.ID != created.ID || hash != "password-hash" {
+		t.Errorf("GetUserCredentials = %+v, %q, %v", user, hash, err)
+	}
+
+	if err := db.SetUserRole(ctx, "carol", models.RoleAdmin); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	if user, _ := db.GetUserByID(ctx, created.ID); user.Role != models.RoleAdmin {
+		t.Errorf("role after SetUserRole = %q, want admin", user.Role)
+	}
+
+	if err := db.ResetUser(ctx, "carol", models.RoleEditor, Credentials{PasswordHash: "new-hash"}); err != nil {
+		t.Fatalf("ResetUser: %v", err)
+	}
+	if user, hash, _ := db.GetUserCredentials(ctx, "carol"); user.Role != models.RoleEditor || hash != "new-hash" {
+		t.Errorf("after ResetUser: role %q, password hash %q", user.Role, hash)
+	}
+	if _, err := db.GetUserByAPIKey(ctx, "key-hash"); err == nil {
+		t.Error("the API key still works after ResetUser")
+	}
+	if err := db.ResetUser(ctx, "nobody", models.RoleAdmin, Credentials{}); err == nil {
+		t.Error("ResetUser succeeded for a missing user")
+	}
+
+	users, err := db.GetAllUsers(ctx)
+	if err != nil || len(users) != 1 {
+		t.Errorf("GetAllUsers = %d users, %v, want 1", len(users), err)
+	}
+
+	if n, err := db.DeleteUser(ctx, created.ID); err != nil || n != 1 {
+		t.Errorf("DeleteUser = %d, %v, want 1", n, err)
+	}
+	if n, err := db.DeleteUser(ctx, created.ID); err != nil || n != 0 {
+		t.Errorf("second DeleteUser = %d, %v, want 0", n, err)
+	}
+	if _, err := db.GetUserByName(ctx, "carol"); err == nil {
+		t.Error("GetUserByName found a deleted user")
+	}
+}
+
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	db.CreateArticle(ctx, "Extra", "Article", 0)
+	db.DeleteArticle(ctx, 1)
+	db.CreateUser(ctx, "dave", "dave@example.com", models.RoleReader, Credentials{})
+
+	if err := db.Reset(ctx); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	articles, _ := db.GetArticles(ctx)
+	if len(articles) != 2 || articles[0].ID != 1 || articles[1].ID != 2 {
+		t.Errorf("articles after Reset = %+v, want the two test articles", articles)
+	}
+	if users, _ := db.GetAllUsers(ctx); len(users) != 0 {
+		t.Errorf("%d users after Reset, want 0", len(users))
+	}
+
+	// IDs start over
+	db.CreateArticle(ctx, "Next", "Article", 0)
+	if owner, err := db.GetArticleOwner(ctx, 3); err != nil || owner != 0 {
+		t.Errorf("new article did not get ID 3: %v", err)
+	}
+	user, err := db.CreateUser(ctx, "dave", "dave@example.com", models.RoleReader, Credentials{})
+	if err != nil || user.ID != 1 {
+		t.Errorf("new user = %+v, %v, want ID 1", user, err)
+	}
+}
+
+// TestCreateUserConcurrent creates the same user from many goroutines:
+// exactly one of them must win and the others must be told the user exists
+func TestCreateUserConcurrent(t *testing.T) {
+	dbs := map[string]string{
+		"memory": ":memory:",
+		"file":   filepath.Join(t.TempDir(), "concurrent.db"),
+	}
+	for name, path := range dbs {
+		t.Run(name, func(t *testing.T) {
+			db, err := New(path)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer db.Close()
+
+			const workers = 20
+			var wg sync.WaitGroup
+			errs := make(chan error, workers)
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := db.CreateUser(context.Background(), "eve", "eve@example.com", models.RoleReader, Credentials{})
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			created := 0
+			for err := range errs {
+				switch {
+				case err == nil:
+					created++
+				case !strings.Contains(err.Error(), "already exists"):
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			if created != 1 {
+				t.Errorf("%d goroutines created the user, want 1", created)
+			}
+		})
+	}
+}
+
+// TestCreateUserConcurrentDistinct creates different users in parallel: all
+// of them must end up in the database with distinct IDs
+func TestCreateUserConcurrentDistinct(t *testing.T) {
+	db := newTestDB(t)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("user%d", i)
+			if _, err := db.CreateUser(context.Background(), name, name+"@example.com", models.RoleReader, Credentials{}); err != nil {
+				t.Errorf("CreateUser(%s): %v", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	users, err := db.GetAllUsers(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	ids := make(map[int]bool)
+	for _, u := range users {
+		ids[u.ID] = true
+	}
+	if len(users) != workers || len(ids) != workers {
+		t.Errorf("got %d users with %d distinct IDs, want %d", len(users), len(ids), workers)
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+
+	"strange-errors-server/internal/metrics"
+	"strange-errors-server/internal/tracing"
+)
+
+// exec runs a statement, logging it against the request in ctx
+func (db *DB) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	start := time.Now()
+	result, err := db.conn.ExecContext(ctx, query, args...)
+	logQuery(ctx, query, start, err)
+	finishQuerySpan(span, err)
+	return result, err
+}
+
+// query runs a query returning rows, logging it against the request in ctx
+func (db *DB) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	start := time.Now()
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	logQuery(ctx, query, start, err)
+	finishQuerySpan(span, err)
+	return rows, err
+}
+
+// queryRow runs a query returning a single row, logging it against the request in ctx
+func (db *DB) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	start := time.Now()
+	row := db.conn.QueryRowContext(ctx, query, args...)
+	logQuery(ctx, query, start, row.Err())
+	finishQuerySpan(span, row.Err())
+	return row
+}
+
+// logQuery writes a debug line for a finished query
+func logQuery(ctx context.Context, query string, start time.Time, err error) {
+	duration := time.Since(start)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	metrics.ObserveQuery(query, duration, err)
+	if err != nil {
+		slog.DebugContext(ctx, "query failed", "query", query, "duration", duration, "error", err)
+		return
+	}
+	slog.DebugContext(ctx, "query", "query", query, "duration", duration)
+}
+
+// startQuerySpan opens a client span for a query
+func startQuerySpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	return tracing.Start(ctx, "db "+strings.ToLower(operation), tracing.KindClient,
+		tracing.String("db.system", "sqlite"),
+		tracing.String("db.operation.name", operation),
+		tracing.String("db.query.text", query))
+}
+
+// finishQuerySpan records the query outcome and ends the span
+func finishQuerySpan(span *tracing.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+	}
+	span.Finish()
+}
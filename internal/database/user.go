@@ -1,14 +1,25 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
+	"github.com/mattn/go-sqlite3"
+
 	"strange-errors-server/internal/models"
 )
 
+// Credentials holds the hashed secrets a user can authenticate with.
+// Both may be empty for users that cannot log in.
+type Credentials struct {
+	PasswordHash string
+	APIKeyHash   string
+}
+
 // CreateUser creates a new user if the name doesn't already exist (idempotent behavior)
-func (db *DB) CreateUser(name, email string) (*models.User, error) {
+func (db *DB) CreateUser(ctx context.Context, name, email, role string, creds Credentials) (*models.User, error) {
 	// Validate email format (simple validation)
 	if !isValidEmail(email) {
 		// Return internal server error for invalid email (wrong status code for demonstration)
@@ -17,7 +28,7 @@ func (db *DB) CreateUser(name, email string) (*models.User, error) {
 	
 	// First check if user already exists
 	var existingUser models.User
-	err := db.conn.QueryRow("SELECT id, name, email FROM users WHERE name = ?", name).Scan(&existingUser.ID, &existingUser.Name, &existingUser.Email)
+	err := db.queryRow(ctx, "SELECT id, name, email FROM users WHERE name = ?", name).Scan(&existingUser.ID, &existingUser.Name, &existingUser.Email)
 	
 	if err == nil {
 		// User already exists, return error for idempotent behavior
@@ -30,8 +41,13 @@ func (db *DB) CreateUser(name, email string) (*models.User, error) {
 	}
 	
 	// User doesn't exist, create new one
-	result, err := db.conn.Exec("INSERT INTO users (name, email) VALUES (?, ?)", name, email)
+	result, err := db.exec(ctx, "INSERT INTO users (name, email, role, password_hash, api_key_hash) VALUES (?, ?, ?, ?, ?)", name, email, role, creds.PasswordHash, creds.APIKeyHash)
 	if err != nil {
+		// A concurrent request created the same user since the check above
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return nil, fmt.Errorf("user with name '%s' already exists", name)
+		}
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 	
@@ -44,6 +60,7 @@ func (db *DB) CreateUser(name, email string) (*models.User, error) {
 		ID:    int(id),
 		Name:  name,
 		Email: email,
+		Role:  role,
 	}, nil
 }
 
@@ -72,9 +89,9 @@ func isValidEmail(email string) bool {
 }
 
 // GetUserByName retrieves a user by name
-func (db *DB) GetUserByName(name string) (*models.User, error) {
+func (db *DB) GetUserByName(ctx context.Context, name string) (*models.User, error) {
 	var user models.User
-	err := db.conn.QueryRow("SELECT id, name, email FROM users WHERE name = ?", name).Scan(&user.ID, &user.Name, &user.Email)
+	err := db.queryRow(ctx, "SELECT id, name, email, role FROM users WHERE name = ?", name).Scan(&user.ID, &user.Name, &user.Email, &user.Role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user with name '%s' not found", name)
@@ -85,9 +102,56 @@ func (db *DB) GetUserByName(name string) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUserByID retrieves a user by ID
+func (db *DB) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	var user models.User
+	err := db.queryRow(ctx, "SELECT id, name, email, role FROM users WHERE id = ?", id).Scan(&user.ID, &user.Name, &user.Email, &user.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user with id %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByAPIKey retrieves the user owning an API key, looked up by its hash
+func (db *DB) GetUserByAPIKey(ctx context.Context, keyHash string) (*models.User, error) {
+	if keyHash == "" {
+		return nil, fmt.Errorf("empty API key")
+	}
+
+	var user models.User
+	err := db.queryRow(ctx, "SELECT id, name, email, role FROM users WHERE api_key_hash = ?", keyHash).Scan(&user.ID, &user.Name, &user.Email, &user.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown API key")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserCredentials retrieves a user by name together with their password hash
+func (db *DB) GetUserCredentials(ctx context.Context, name string) (*models.User, string, error) {
+	var user models.User
+	var passwordHash string
+	err := db.queryRow(ctx, "SELECT id, name, email, role, password_hash FROM users WHERE name = ?", name).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", fmt.Errorf("user with name '%s' not found", name)
+		}
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, passwordHash, nil
+}
+
 // GetAllUsers retrieves all users from the database
-func (db *DB) GetAllUsers() ([]models.User, error) {
-	rows, err := db.conn.Query("SELECT id, name, email FROM users")
+func (db *DB) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	rows, err := db.query(ctx, "SELECT id, name, email, role FROM users")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -96,7 +160,7 @@ func (db *DB) GetAllUsers() ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		err := rows.Scan(&user.ID, &user.Name, &user.Email)
+		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Role)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
@@ -109,3 +173,40 @@ func (db *DB) GetAllUsers() ([]models.User, error) {
 
 	return users, nil
 }
+
+// DeleteUser deletes a user by ID from the database
+func (db *DB) DeleteUser(ctx context.Context, id int) (int64, error) {
+	result, err := db.exec(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// SetUserRole changes the role of an existing user
+func (db *DB) SetUserRole(ctx context.Context, name, role string) error {
+	_, err := db.exec(ctx, "UPDATE users SET role = ? WHERE name = ?", role, name)
+	if err != nil {
+		return fmt.Errorf("failed to set user role: %w", err)
+	}
+	return nil
+}
+
+// ResetUser gives an existing user a new role and replaces its credentials,
+// so that whatever the user could log in with before stops working
+func (db *DB) ResetUser(ctx context.Context, name, role string, creds Credentials) error {
+	result, err := db.exec(ctx, "UPDATE users SET role = ?, password_hash = ?, api_key_hash = ? WHERE name = ?", role, creds.PasswordHash, creds.APIKeyHash, name)
+	if err != nil {
+		return fmt.Errorf("failed to reset user: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("user with name '%s' not found", name)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/database"
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/models"
+)
+
+// AuthHandler handles logging in and guards protected routes
+type AuthHandler struct {
+	db             *database.DB
+	authenticator  *auth.Authenticator
+	required       bool
+	checkOwnership atomic.Bool
+}
+
+// NewAuthHandler creates a new AuthHandler instance. When required is false
+// protected routes stay open and only the login endpoint is active.
+func NewAuthHandler(db *database.DB, authenticator *auth.Authenticator, required bool) *AuthHandler {
+	ah := &AuthHandler{
+		db:            db,
+		authenticator: authenticator,
+		required:      required,
+	}
+	ah.checkOwnership.Store(true)
+	return ah
+}
+
+// SetOwnershipChecks turns the article ownership check on or off. Turning it
+// off plants a classic IDOR bug: editors can delete anybody's articles. It
+// can be called while the server is running.
+func (ah *AuthHandler) SetOwnershipChecks(enabled bool) {
+	ah.checkOwnership.Store(enabled)
+}
+
+// Protect wraps a handler so that it requires credentials, and one of roles
+// if any are given, when auth is enabled
+func (ah *AuthHandler) Protect(handler http.HandlerFunc, roles ...string) http.HandlerFunc {
+	if !ah.required {
+		return handler
+	}
+	return ah.authenticator.Require(noteUser(handler), roles...)
+}
+
+// Identify wraps a handler so that the caller, if they sent credentials, is
+// known to it. Anonymous requests still go through.
+func (ah *AuthHandler) Identify(handler http.HandlerFunc) http.HandlerFunc {
+	return ah.authenticator.Identify(noteUser(handler))
+}
+
+// noteUser wraps a handler so that the authenticated user shows up in the request log
+func noteUser(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := auth.UserFromContext(r.Context()); ok {
+			middleware.SetUser(r.Context(), user.Name)
+		}
+		handler(w, r)
+	}
+}
+
+// ProtectArticleOwner wraps DELETE /api/article/{id} so that editors can only
+// delete their own articles while admins can delete any of them
+func (ah *AuthHandler) ProtectArticleOwner(handler http.HandlerFunc) http.HandlerFunc {
+	if !ah.required {
+		return handler
+	}
+	owned := func(w http.ResponseWriter, r *http.Request) {
+		user, _ := auth.UserFromContext(r.Context())
+		if user.Role == models.RoleAdmin || !ah.checkOwnership.Load() {
+			handler(w, r)
+			return
+		}
+
+		// Let the handler deal with bad IDs and missing articles in its own way
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			handler(w, r)
+			return
+		}
+		ownerID, err := ah.db.GetArticleOwner(r.Context(), id)
+		if err != nil {
+			handler(w, r)
+			return
+		}
+
+		if ownerID != user.ID {
+			ah.authenticator.Deny(w, r, http.StatusForbidden, fmt.Sprintf("Article %d belongs to somebody else", id))
+			return
+		}
+		handler(w, r)
+	}
+	return ah.Protect(owned, models.RoleEditor, models.RoleAdmin)
+}
+
+// LoginHandler handles POST /api/login - issues a bearer token
+// @Summary Log in
+// @Description Exchanges a user name and password for an HMAC-signed bearer token.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body models.LoginRequest true "User name and password"
+// @Success 200 {object} models.LoginResponse "Token issued"
+// @Failure 400 {object} models.APIResponse "Invalid request data"
+// @Failure 401 {object} models.APIResponse "Invalid credentials"
+// @Router /api/login [post]
+func (ah *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, 405, models.APIResponse{
+			Error:  "Method not allowed",
+			Status: "METHOD_NOT_ALLOWED",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.Password == "" {
+		writeError(w, r, 400, models.APIResponse{
+			Error:  "User name and password are required",
+			Status: "BAD_REQUEST",
+		})
+		return
+	}
+
+	user, passwordHash, err := ah.db.GetUserCredentials(r.Context(), req.Name)
+	if err != nil || !auth.CheckPassword(passwordHash, req.Password) {
+		ah.authenticator.Deny(w, r, http.StatusUnauthorized, "Invalid user name or password")
+		return
+	}
+
+	token, expiresAt, err := ah.authenticator.Issuer().Issue(user.ID, user.Name)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to issue token", "error", err)
+		writeError(w, r, 500, models.APIResponse{
+			Error:  "Internal server error",
+			Status: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(models.LoginResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/challenge"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/traffic"
+)
+
+// ChallengeHandler serves challenge mode: the defect catalog, submissions
+// and scores. Unlike the API under test, it answers honestly.
+type ChallengeHandler struct {
+	board *challenge.Board
+}
+
+// NewChallengeHandler creates a new ChallengeHandler instance
+func NewChallengeHandler(board *challenge.Board) *ChallengeHandler {
+	return &ChallengeHandler{board: board}
+}
+
+// DefectsHandler handles GET /api/challenge/defects - the catalog to hunt through
+// @Summary List the challenge catalog
+// @Description Lists the behaviors that may hide a planted defect: wrong status codes, idempotency violations and GOAT side effects. Some entries are honeypots, correct behavior that costs points when reported.
+// @Tags challenge
+// @Produce json
+// @Success 200 {array} challenge.Defect "Catalog entries"
+// @Router /api/challenge/defects [get]
+func (ch *ChallengeHandler) DefectsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ch.board.Defects())
+}
+
+// SubmitHandler handles POST /api/challenge/submissions - report a finding
+// @Summary Report a defect
+// @Description Reports a defect by catalog ID or free description, citing the X-Request-ID of the exchanges that show it. The report is verified against the recorded traffic. Logged-in users are scored under their user name, anonymous ones under the trainee field or the X-Trainee header. Only requests recorded under the same name count as evidence. Anonymous names are taken on trust, so in a workshop where that matters, give trainees accounts and have them log in.
+// @Tags challenge
+// @Accept json
+// @Produce json
+// @Param submission body challenge.Submission true "Finding with evidence request IDs"
+// @Param X-Trainee header string false "Trainee name when there is none in the body"
+// @Success 200 {object} challenge.Verdict "Verdict, accepted or not"
+// @Failure 400 {object} models.APIResponse "Malformed submission"
+// @Router /api/challenge/submissions [post]
+func (ch *ChallengeHandler) SubmitHandler(w http.ResponseWriter, r *http.Request) {
+	var submission challenge.Submission
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.APIResponse{
+			Error:  "Invalid JSON: " + err.Error(),
+			Status: "BAD_REQUEST",
+		})
+		return
+	}
+	// Without a login the name is taken on trust, from the body or the header
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		submission.Trainee = user.Name
+	} else if submission.Trainee == "" {
+		submission.Trainee = r.Header.Get(traffic.TraineeHeader)
+	}
+
+	verdict, err := ch.board.Submit(submission)
+	if errors.Is(err, challenge.ErrInvalid) {
+		writeError(w, r, http.StatusBadRequest, models.APIResponse{
+			Error:  err.Error(),
+			Status: "BAD_REQUEST",
+		})
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.APIResponse{
+			Error:  "Internal server error",
+			Status: "INTERNAL_ERROR",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verdict)
+}
+
+// ScoresHandler handles GET /api/challenge/scores - the leaderboard
+// @Summary Challenge leaderboard
+// @Description Lists every trainee's points, best first, without revealing what they found.
+// @Tags challenge
+// @Produce json
+// @Success 200 {array} challenge.Score "Scores"
+// @Router /api/challenge/scores [get]
+func (ch *ChallengeHandler) ScoresHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ch.board.Scores())
+}
+
+// TraineeHandler handles GET /api/challenge/scores/{trainee} - one trainee's progress
+// @Summary Trainee progress
+// @Description Returns a trainee's points together with the defects they found and the honeypots they fell for.
+// @Tags challenge
+// @Produce json
+// @Param trainee path string true "Trainee name"
+// @Success 200 {object} challenge.Score "Progress"
+// @Failure 404 {object} models.APIResponse "No submissions from this trainee"
+// @Router /api/challenge/scores/{trainee} [get]
+func (ch *ChallengeHandler) TraineeHandler(w http.ResponseWriter, r *http.Request) {
+	score, ok := ch.board.Score(r.PathValue("trainee"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, models.APIResponse{
+			Error:  "No submissions from " + r.PathValue("trainee") + " yet",
+			Status: "NOT_FOUND",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(score)
+}
+
+// ResetHandler handles DELETE /api/challenge/scores - start a new round
+// @Summary Reset the challenge
+// @Description Forgets every score and every cited request ID.
+// @Tags challenge
+// @Produce json
+// @Success 200 {object} models.APIResponse "Scores cleared"
+// @Security BearerAuth
+// @Router /api/challenge/scores [delete]
+func (ch *ChallengeHandler) ResetHandler(w http.ResponseWriter, r *http.Request) {
+	ch.board.Reset()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.APIResponse{Message: "Scores cleared", Status: "OK"})
+}
+
+// Routes returns the challenge mode routes. Resetting the scores
+// takes an admin when authentication is required.
+func (ch *ChallengeHandler) Routes(authHandler *AuthHandler) []Route {
+	return []Route{
+		{"GET", "/api/challenge/defects", ch.DefectsHandler},
+		{"POST", "/api/challenge/submissions", authHandler.Identify(ch.SubmitHandler)},
+		{"GET", "/api/challenge/scores", ch.ScoresHandler},
+		{"GET", "/api/challenge/scores/{trainee}", ch.TraineeHandler},
+		{"DELETE", "/api/challenge/scores", authHandler.Protect(ch.ResetHandler, models.RoleAdmin)},
+	}
+}
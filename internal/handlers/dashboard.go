@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"strange-errors-server/internal/challenge"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/traffic"
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+// dashboardTemplate renders the whole page and, as "standings", the part
+// that is pushed again on every change
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"clock": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("15:04:05")
+	},
+	"inc": func(i int) int { return i + 1 },
+}).Parse(dashboardHTML))
+
+// goatStages names what the GOAT answers on each call, first call first
+var goatStages = []string{"OK", "Annoyed", "Upset", "Enraged", "Fatal"}
+
+// Dashboard is what the instructor's dashboard shows
+type Dashboard struct {
+	Generated time.Time      `json:"generated"`
+	GoatCalls int            `json:"goat_calls"`
+	GoatStage string         `json:"goat_stage"`
+	Requests  int            `json:"requests"` // exchanges in the traffic log
+	Defects   int            `json:"defects"`  // catalog entries that are not honeypots
+	Trainees  []TraineeBoard `json:"trainees"`
+}
+
+// TraineeBoard is a trainee's row on the dashboard
+type TraineeBoard struct {
+	challenge.Score
+	Requests    int       `json:"requests"`
+	LastRequest time.Time `json:"last_request"`
+	GoatStage   string    `json:"goat_stage,omitempty"` // last GOAT answer the trainee got
+}
+
+// DashboardHandler serves a page for the instructor to project during a
+// workshop: every trainee's requests, GOAT stage, findings and score,
+// updated live with Server-Sent Events
+type DashboardHandler struct {
+	board     *challenge.Board
+	log       *traffic.Log
+	goat      *GoatHandler
+	throttle  time.Duration // minimum time between two pushed updates
+	heartbeat time.Duration // keeps proxies from closing an idle stream
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDashboardHandler creates a new DashboardHandler instance
+func NewDashboardHandler(board *challenge.Board, log *traffic.Log, goat *GoatHandler) *DashboardHandler {
+	return &DashboardHandler{
+		board:     board,
+		log:       log,
+		goat:      goat,
+		throttle:  250 * time.Millisecond,
+		heartbeat: 15 * time.Second,
+		done:      make(chan struct{}),
+	}
+}
+
+// Close ends the open event streams, which would otherwise hold up a
+// graceful shutdown. Pass it to http.Server.RegisterOnShutdown.
+func (dh *DashboardHandler) Close() {
+	dh.closeOnce.Do(func() { close(dh.done) })
+}
+
+// Snapshot collects what the dashboard shows right now. Requests count
+// towards the logged-in user or, for anonymous ones, the X-Trainee header.
+func (dh *DashboardHandler) Snapshot() Dashboard {
+	standings := dh.board.Standings()
+	exchanges := dh.log.Exchanges()
+	defects := 0
+	for _, d := range dh.board.Defects() {
+		if !d.Honeypot() {
+			defects++
+		}
+	}
+
+	rows := make(map[string]*TraineeBoard, len(standings))
+	var order []string
+	for _, score := range standings {
+		rows[score.Trainee] = &TraineeBoard{Score: score}
+		order = append(order, score.Trainee)
+	}
+	var newcomers []string
+	for _, e := range exchanges {
+		if e.Trainee == "" {
+			continue
+		}
+		row, ok := rows[e.Trainee]
+		if !ok {
+			row = &TraineeBoard{Score: challenge.Score{Trainee: e.Trainee, Remaining: defects}}
+			rows[e.Trainee] = row
+			newcomers = append(newcomers, e.Trainee)
+		}
+		row.Requests++
+		row.LastRequest = e.StartedAt
+		if e.Method == "GOAT" {
+			var goat models.GoatResponse
+			if json.Unmarshal(e.ResponseBody, &goat) == nil && goat.Status != "" {
+				row.GoatStage = goat.Status
+			}
+		}
+	}
+	// Trainees who have not submitted anything yet go last
+	sort.Strings(newcomers)
+	order = append(order, newcomers...)
+
+	calls := dh.goat.Calls()
+	dashboard := Dashboard{
+		Generated: time.Now(),
+		GoatCalls: calls,
+		GoatStage: goatStage(calls),
+		Requests:  len(exchanges),
+		Defects:   defects,
+		Trainees:  make([]TraineeBoard, 0, len(order)),
+	}
+	for _, trainee := range order {
+		dashboard.Trainees = append(dashboard.Trainees, *rows[trainee])
+	}
+	return dashboard
+}
+
+// goatStage names the mood the GOAT is in after calls calls
+func goatStage(calls int) string {
+	switch {
+	case calls == 0:
+		return "Sleeping"
+	case calls <= len(goatStages):
+		return goatStages[calls-1]
+	}
+	return "Overloaded"
+}
+
+// PageHandler handles GET /api/challenge/dashboard - the instructor's dashboard
+// @Summary Instructor dashboard
+// @Description An HTML page with every trainee's requests, GOAT stage, discovered defects and score. It updates itself from /api/challenge/dashboard/events and needs nothing but the server. Add format=json for the same data as JSON.
+// @Tags challenge
+// @Produce html
+// @Produce json
+// @Param format query string false "Set to json for the data behind the page"
+// @Success 200 {object} Dashboard "Dashboard"
+// @Router /api/challenge/dashboard [get]
+func (dh *DashboardHandler) PageHandler(w http.ResponseWriter, r *http.Request) {
+	dashboard := dh.Snapshot()
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dashboard)
+		return
+	}
+
+	var page bytes.Buffer
+	if err := dashboardTemplate.Execute(&page, dashboard); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render dashboard", "error", err)
+		writeError(w, r, http.StatusInternalServerError, models.APIResponse{
+			Error:  "Internal server error",
+			Status: "INTERNAL_ERROR",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(page.Bytes())
+}
+
+// EventsHandler handles GET /api/challenge/dashboard/events - live updates
+// @Summary Dashboard updates
+// @Description A Server-Sent Events stream. Every "standings" event carries the rendered trainee table, sent on connect and whenever traffic is recorded or a submission comes in.
+// @Tags challenge
+// @Produce text/event-stream
+// @Success 200 {string} string "Event stream"
+// @Router /api/challenge/dashboard/events [get]
+func (dh *DashboardHandler) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); errors.Is(err, http.ErrNotSupported) {
+		slog.WarnContext(r.Context(), "dashboard events may be cut off by the write timeout", "error", err)
+	}
+
+	trafficChanges, stopTraffic := dh.log.Watch()
+	defer stopTraffic()
+	boardChanges, stopBoard := dh.board.Watch()
+	defer stopBoard()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func() error {
+		var standings strings.Builder
+		if err := dashboardTemplate.ExecuteTemplate(&standings, "standings", dh.Snapshot()); err != nil {
+			return err
+		}
+		var event strings.Builder
+		event.WriteString("event: standings\n")
+		for line := range strings.SplitSeq(standings.String(), "\n") {
+			event.WriteString("data: " + line + "\n")
+		}
+		event.WriteString("\n")
+		if _, err := w.Write([]byte(event.String())); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := send(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(dh.heartbeat)
+	defer heartbeat.Stop()
+	// Bursts of traffic are pushed as one update at most every dh.throttle
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-dh.done:
+			return
+		case <-trafficChanges:
+			if pending == nil {
+				pending = time.After(dh.throttle)
+			}
+		case <-boardChanges:
+			if pending == nil {
+				pending = time.After(dh.throttle)
+			}
+		case <-pending:
+			pending = nil
+			if err := send(); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Routes returns the dashboard routes
+func (dh *DashboardHandler) Routes() []Route {
+	return []Route{
+		{"GET", "/api/challenge/dashboard", dh.PageHandler},
+		{"GET", "/api/challenge/dashboard/events", dh.EventsHandler},
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"strange-errors-server/internal/challenge"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/traffic"
+)
+
+// newTestDashboard returns a dashboard over an empty traffic log
+func newTestDashboard(t *testing.T) (*DashboardHandler, *traffic.Log, *challenge.Board) {
+	t.Helper()
+	log := traffic.NewLog(100)
+	board := challenge.NewBoard(log, challenge.Catalog())
+	dh := NewDashboardHandler(board, log, NewGoatHandler())
+	dh.throttle = time.Millisecond
+	return dh, log, board
+}
+
+func TestDashboardSnapshot(t *testing.T) {
+	dh, log, board := newTestDashboard(t)
+	log.Add(traffic.Exchange{
+		RequestID: "list", Method: "GET", Path: "/api/articles", Status: 777, Trainee: "ana",
+		Quirks: []quirks.Applied{{Name: "articles.list.success", Intended: 200, Actual: 777}},
+	})
+	log.Add(traffic.Exchange{RequestID: "goat-1", Method: "GOAT", Path: "/api/health-check", Status: 200, Trainee: "bo", ResponseBody: []byte(`{"status":"OK"}`)})
+	log.Add(traffic.Exchange{RequestID: "goat-2", Method: "GOAT", Path: "/api/health-check", Status: 400, Trainee: "bo", ResponseBody: []byte(`{"status":"Annoyed"}`)})
+	log.Add(traffic.Exchange{RequestID: "anonymous", Method: "GET", Path: "/api/articles", Status: 777})
+	if _, err := board.Submit(challenge.Submission{Trainee: "ana", DefectID: "articles.list.success", Evidence: []string{"list"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	dashboard := dh.Snapshot()
+	if dashboard.Requests != 4 || dashboard.GoatStage != "Sleeping" {
+		t.Errorf("dashboard = %+v, want 4 requests and a sleeping GOAT", dashboard)
+	}
+	if len(dashboard.Trainees) != 2 {
+		t.Fatalf("trainees = %+v, want ana and bo", dashboard.Trainees)
+	}
+	ana, bo := dashboard.Trainees[0], dashboard.Trainees[1]
+	if ana.Trainee != "ana" || ana.Points != 10 || ana.Requests != 1 || len(ana.Findings) != 1 {
+		t.Errorf("ana = %+v, want 10 points from 1 request", ana)
+	}
+	if bo.Trainee != "bo" || bo.Requests != 2 || bo.GoatStage != "Annoyed" {
+		t.Errorf("bo = %+v, want 2 requests and an annoyed GOAT", bo)
+	}
+}
+
+func TestDashboardPageEscapes(t *testing.T) {
+	dh, log, _ := newTestDashboard(t)
+	log.Add(traffic.Exchange{RequestID: "1", Method: "GET", Path: "/api/articles", Status: 777, Trainee: "<script>alert(1)</script>"})
+
+	rec := httptest.NewRecorder()
+	dh.PageHandler(rec, httptest.NewRequest("GET", "/api/challenge/dashboard", nil))
+	if rec.Code != 200 || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "<script>alert(1)") || !strings.Contains(body, "&lt;script&gt;alert(1)") {
+		t.Error("trainee name is not escaped")
+	}
+	if strings.Contains(body, "src=\"http") || strings.Contains(body, "href=\"http") {
+		t.Error("page loads external assets")
+	}
+}
+
+func TestDashboardEvents(t *testing.T) {
+	dh, log, _ := newTestDashboard(t)
+	server := httptest.NewServer(http.HandlerFunc(dh.EventsHandler))
+	defer server.Close()
+	defer dh.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("content type = %q", got)
+	}
+
+	events := bufio.NewScanner(resp.Body)
+	// next returns the data of the next event
+	next := func() string {
+		t.Helper()
+		var data strings.Builder
+		for events.Scan() {
+			line := events.Text()
+			if line == "" && data.Len() > 0 {
+				return data.String()
+			}
+			if rest, ok := strings.CutPrefix(line, "data: "); ok {
+				data.WriteString(rest + "\n")
+			}
+		}
+		t.Fatalf("stream ended: %v", events.Err())
+		return ""
+	}
+
+	if first := next(); !strings.Contains(first, "No trainees yet") {
+		t.Errorf("first event = %q, want the empty standings", first)
+	}
+	log.Add(traffic.Exchange{RequestID: "1", Method: "GET", Path: "/api/articles", Status: 777, Trainee: "ana"})
+	if update := next(); !strings.Contains(update, "ana") {
+		t.Errorf("update = %q, want ana's row", update)
+	}
+}
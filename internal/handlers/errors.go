@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/models"
+)
+
+// writeError writes a JSON error body tagged with the request ID, so a
+// response can be matched with its log lines
+func writeError(w http.ResponseWriter, r *http.Request, status int, response models.APIResponse) {
+	response.RequestID = middleware.RequestIDFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,44 +2,87 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	"strange-errors-server/internal/metrics"
+	"strange-errors-server/internal/middleware"
 	"strange-errors-server/internal/models"
 )
 
 // GoatHandler handles the GOAT method - the annoying server behavior
 type GoatHandler struct {
+	mu        sync.Mutex
 	callCount int
+	shutdown  func()
+	dbPath    string       // the file the enraged GOAT deletes
+	destroy   func() error // replaces deleting dbPath when set
 }
 
 // NewGoatHandler creates a new GoatHandler instance
 func NewGoatHandler() *GoatHandler {
-	return &GoatHandler{callCount: 0}
+	return &GoatHandler{
+		callCount: 0,
+		shutdown:  func() { os.Exit(1) },
+		dbPath:    "./database.db",
+	}
+}
+
+// SetDatabasePath sets the file the enraged GOAT deletes. With an empty
+// path it only pretends to.
+func (gh *GoatHandler) SetDatabasePath(path string) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	gh.dbPath = path
+}
+
+// SetDestroyFunc sets what the enraged GOAT does to the database instead of
+// deleting the file, such as emptying a sandbox that lives in memory
+func (gh *GoatHandler) SetDestroyFunc(destroy func() error) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	gh.destroy = destroy
+}
+
+// Calls returns how many times the GOAT has been called
+func (gh *GoatHandler) Calls() int {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	return gh.callCount
 }
 
-// Handle handles the GOAT method with progressive annoyance
-// @Summary GOAT method (Custom HTTP Method)
-// @Description Demonstrates progressive server behavior with a custom GOAT HTTP method. Use: curl -X GOAT http://localhost:3000/api/health-check
-// @Tags health
-// @Accept json
-// @Produce json
-// @Success 200 {object} models.GoatResponse "First call - Happy GOAT"
-// @Success 400 {object} models.GoatResponse "Second/Third call - Annoyed/Upset GOAT"
-// @Success 500 {object} models.GoatResponse "Fourth call - Enraged GOAT"
-// @Success 503 {object} models.GoatResponse "Fifth call - Fatal GOAT"
-// @Router /api/health-check [post]
+// SetCalls makes the GOAT believe it has been called n times already, so
+// that the next call gets the response of call n+1. SetCalls(0) calms it down.
+func (gh *GoatHandler) SetCalls(n int) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	gh.callCount = max(n, 0)
+}
+
+// SetShutdownFunc sets what the GOAT does when it takes the server down.
+// By default it kills the process on the spot.
+func (gh *GoatHandler) SetShutdownFunc(shutdown func()) {
+	gh.shutdown = shutdown
+}
+
+// Handle handles the GOAT method with progressive annoyance. Swagger 2.0
+// only knows the standard methods, so the GOAT has no swag annotations;
+// /openapi.json documents it under x-additionalOperations.
 func (gh *GoatHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	gh.mu.Lock()
 	gh.callCount++
-	log.Printf("🐐 GOAT call #%d", gh.callCount)
-	
+	call, dbPath, destroy := gh.callCount, gh.dbPath, gh.destroy
+	gh.mu.Unlock()
+	slog.InfoContext(r.Context(), "GOAT called", "call", call)
+
 	w.Header().Set("Content-Type", "application/json")
 
 	var response models.GoatResponse
 
-	switch gh.callCount {
+	switch call {
 	case 1:
 		w.WriteHeader(200)
 		response = models.GoatResponse{
@@ -60,24 +103,29 @@ func (gh *GoatHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 	case 4:
 		// Delete the database!
-		log.Println("💥 GOAT is enraged! Attempting to delete database...")
-		err := os.Remove("./database.db")
+		slog.WarnContext(r.Context(), "GOAT is enraged, attempting to delete database")
+		err := os.ErrNotExist
+		if destroy != nil {
+			err = destroy()
+		} else if dbPath != "" {
+			err = os.Remove(dbPath)
+		}
 		w.WriteHeader(500)
 		if err != nil {
-			log.Printf("❌ Failed to delete database: %v", err)
+			slog.ErrorContext(r.Context(), "GOAT failed to delete database", "error", err)
 			response = models.GoatResponse{
 				Status:  "Failed",
 				Message: "I tried to delete the database, but it was already gone.",
 			}
 		} else {
-			log.Println("💀 Database deleted successfully!")
+			slog.WarnContext(r.Context(), "GOAT deleted the database")
 			response = models.GoatResponse{
 				Status:  "Enraged",
 				Message: "That is it! I have deleted the database. Good luck now.",
 			}
 		}
 	case 5:
-		log.Println("💀 GOAT is fatal! Server will shutdown in 1 second...")
+		slog.WarnContext(r.Context(), "GOAT is fatal, server will shut down in 1 second")
 		w.WriteHeader(503)
 		response = models.GoatResponse{
 			Status:  "Fatal",
@@ -86,11 +134,11 @@ func (gh *GoatHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		// Shutdown server after 1 second
 		go func() {
 			time.Sleep(1 * time.Second)
-			log.Println("🔴 Server shutting down...")
-			os.Exit(1)
+			slog.Warn("GOAT is shutting the server down")
+			gh.shutdown()
 		}()
 	default:
-		log.Println("💥 GOAT is overloaded! Server will shutdown in 1 second...")
+		slog.WarnContext(r.Context(), "GOAT is overloaded, server will shut down in 1 second")
 		w.WriteHeader(500)
 		response = models.GoatResponse{
 			Status:  "Overloaded",
@@ -98,10 +146,14 @@ func (gh *GoatHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 		go func() {
 			time.Sleep(1 * time.Second)
-			log.Println("🔴 Server shutting down...")
-			os.Exit(1)
+			slog.Warn("GOAT is shutting the server down")
+			gh.shutdown()
 		}()
 	}
 
+	metrics.GoatStages.Inc(response.Status)
+	if response.Status != "OK" {
+		response.RequestID = middleware.RequestIDFromContext(r.Context())
+	}
 	json.NewEncoder(w).Encode(response)
 }
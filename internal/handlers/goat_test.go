@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+)
+
+// callGoat sends one GOAT request straight to the handler
+func callGoat(gh *GoatHandler) (int, models.GoatResponse) {
+	rec := httptest.NewRecorder()
+	gh.Handle(rec, httptest.NewRequest("GOAT", "/api/health-check", nil))
+	var resp models.GoatResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp
+}
+
+func TestGoatProgression(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "database.db")
+	if err := os.WriteFile(dbPath, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	shutdown := make(chan struct{})
+	var once sync.Once
+
+	gh := NewGoatHandler()
+	gh.SetDatabasePath(dbPath)
+	gh.SetShutdownFunc(func() { once.Do(func() { close(shutdown) }) })
+
+	tests := []struct {
+		status int
+		mood   string
+	}{
+		{200, "OK"},
+		{400, "Annoyed"},
+		{400, "Upset"},
+		{500, "Enraged"},
+		{503, "Fatal"},
+		{500, "Overloaded"},
+		{500, "Overloaded"},
+	}
+	for i, tt := range tests {
+		status, resp := callGoat(gh)
+		if status != tt.status || resp.Status != tt.mood {
+			t.Errorf("call %d = %d %q, want %d %q", i+1, status, resp.Status, tt.status, tt.mood)
+		}
+		if gh.Calls() != i+1 {
+			t.Errorf("after call %d Calls() = %d", i+1, gh.Calls())
+		}
+		if i == 3 {
+			if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+				t.Errorf("the enraged GOAT did not delete the database: %v", err)
+			}
+		}
+	}
+
+	select {
+	case <-shutdown:
+	case <-time.After(3 * time.Second):
+		t.Error("the fatal GOAT did not shut the server down")
+	}
+}
+
+func TestGoatDatabaseAlreadyGone(t *testing.T) {
+	gh := NewGoatHandler()
+	gh.SetShutdownFunc(func() {})
+	gh.SetDatabasePath(filepath.Join(t.TempDir(), "missing.db"))
+	gh.SetCalls(3)
+
+	status, resp := callGoat(gh)
+	if status != 500 || resp.Status != "Failed" {
+		t.Errorf("enraged call without a database = %d %q, want 500 Failed", status, resp.Status)
+	}
+}
+
+func TestGoatSetCalls(t *testing.T) {
+	gh := NewGoatHandler()
+	gh.SetShutdownFunc(func() {})
+	gh.SetDatabasePath("")
+
+	tests := []struct {
+		calls  int
+		status int
+	}{
+		{0, 200},
+		{1, 400},
+		{2, 400},
+		{3, 500},
+		{-5, 200},
+	}
+	for _, tt := range tests {
+		gh.SetCalls(tt.calls)
+		if status, _ := callGoat(gh); status != tt.status {
+			t.Errorf("SetCalls(%d): next call = %d, want %d", tt.calls, status, tt.status)
+		}
+	}
+}
+
+// TestGoatConcurrent calls the GOAT from many goroutines: every call must
+// be counted once and every stage must be handed out exactly once
+func TestGoatConcurrent(t *testing.T) {
+	var shutdowns atomic.Int32
+	gh := NewGoatHandler()
+	gh.SetShutdownFunc(func() { shutdowns.Add(1) })
+	gh.SetDatabasePath("")
+
+	const workers = 50
+	moods := make(chan string, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, resp := callGoat(gh)
+			moods <- resp.Status
+		}()
+	}
+	wg.Wait()
+	close(moods)
+
+	counts := make(map[string]int)
+	for mood := range moods {
+		counts[mood]++
+	}
+	want := map[string]int{"OK": 1, "Annoyed": 1, "Upset": 1, "Failed": 1, "Fatal": 1, "Overloaded": workers - 5}
+	for mood, n := range want {
+		if counts[mood] != n {
+			t.Errorf("%d %s responses, want %d (all: %v)", counts[mood], mood, n, counts)
+		}
+	}
+	if gh.Calls() != workers {
+		t.Errorf("Calls() = %d, want %d", gh.Calls(), workers)
+	}
+}
+
+// TestGoatThroughRouter checks the custom method end to end
+func TestGoatThroughRouter(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, false)
+	for i, want := range []int{200, 400, 400, 500} {
+		rec := ts.do("GOAT", "/api/health-check", "")
+		if rec.Code != want {
+			t.Errorf("call %d = %d, want %d", i+1, rec.Code, want)
+		}
+		if i > 0 {
+			var resp models.GoatResponse
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if resp.RequestID == "" || resp.RequestID != rec.Header().Get("X-Request-ID") {
+				t.Errorf("call %d: request ID %q in body, %q in header", i+1, resp.RequestID, rec.Header().Get("X-Request-ID"))
+			}
+		}
+	}
+	if ts.goat.Calls() != 4 {
+		t.Errorf("Calls() = %d, want 4", ts.goat.Calls())
+	}
+}
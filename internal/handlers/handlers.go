@@ -1,24 +1,93 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"strange-errors-server/internal/auth"
 	"strange-errors-server/internal/database"
 	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
 )
 
+// delayedDelete is how long the expert level waits before really deleting
+// an article it has confirmed as deleted
+const delayedDelete = 2 * time.Second
+
 // Handler holds dependencies for HTTP handlers
 type Handler struct {
 	db *database.DB
+
+	mu      sync.Mutex
+	rng     *rand.Rand               // shuffles articles for the expert level
+	pending map[*time.Timer]struct{} // delayed deletes not done yet
+	deletes sync.WaitGroup
+	closed  bool
 }
 
 // New creates a new Handler instance
 func New(db *database.DB) *Handler {
-	return &Handler{db: db}
+	return &Handler{
+		db:      db,
+		rng:     rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+		pending: make(map[*time.Timer]struct{}),
+	}
+}
+
+// SetRand sets the random source of the quirks, e.g. a seeded one to make
+// the order of shuffled articles reproducible
+func (h *Handler) SetRand(rng *rand.Rand) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rng = rng
+}
+
+// Close cancels the delayed deletes that have not started and waits for the
+// others. Call it before closing the database.
+func (h *Handler) Close() {
+	h.mu.Lock()
+	h.closed = true
+	for timer := range h.pending {
+		if timer.Stop() {
+			h.deletes.Done()
+		}
+		delete(h.pending, timer)
+	}
+	h.mu.Unlock()
+	h.deletes.Wait()
+}
+
+// deleteLater deletes an article after delayedDelete, reporting false if the
+// handler is closed
+func (h *Handler) deleteLater(ctx context.Context, id int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	// The request is over by the time the article goes, but its ID still
+	// belongs in the log
+	ctx = context.WithoutCancel(ctx)
+	h.deletes.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(delayedDelete, func() {
+		defer h.deletes.Done()
+		h.mu.Lock()
+		delete(h.pending, timer)
+		h.mu.Unlock()
+		if _, err := h.db.DeleteArticle(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "delayed delete failed", "article_id", id, "error", err)
+		}
+	})
+	h.pending[timer] = struct{}{}
+	return true
 }
 
 // GetArticlesHandler handles GET /api/articles - with wrong status code (777 instead of 200)
@@ -31,19 +100,42 @@ func New(db *database.DB) *Handler {
 // @Failure 500 {string} string "Database error"
 // @Router /api/articles [get]
 func (h *Handler) GetArticlesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", 405)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeError(w, r, 405, models.APIResponse{
+			Error:  "Method not allowed",
+			Status: "METHOD_NOT_ALLOWED",
+		})
 		return
 	}
 
-	articles, err := h.db.GetArticles()
+	articles, err := h.db.GetArticles(r.Context())
 	if err != nil {
-		http.Error(w, "Database error", 500)
+		writeError(w, r, 500, models.APIResponse{
+			Error:  "Database error",
+			Status: "DATABASE_ERROR",
+		})
 		return
 	}
 
+	// Expert level: the newest article goes missing and the order changes
+	// on every call, while the status code is right
+	if len(articles) > 0 && quirks.Hide(r.Context(), "articles.list.newest-missing") {
+		newest := 0
+		for i, article := range articles {
+			if article.ID > articles[newest].ID {
+				newest = i
+			}
+		}
+		articles = append(articles[:newest], articles[newest+1:]...)
+	}
+	if len(articles) > 1 && quirks.Hide(r.Context(), "articles.list.shuffled") {
+		h.mu.Lock()
+		h.rng.Shuffle(len(articles), func(i, j int) { articles[i], articles[j] = articles[j], articles[i] })
+		h.mu.Unlock()
+	}
+
 	// Wrong status code - should be 200, but we use 777
-	w.WriteHeader(777)
+	w.WriteHeader(quirks.Apply(r.Context(), "articles.list.success"))
 	response := models.APIResponse{
 		Message: "Data successfully retrieved!",
 		Data:    articles,
@@ -61,10 +153,14 @@ func (h *Handler) GetArticlesHandler(w http.ResponseWriter, r *http.Request) {
 // @Success 888 {object} models.APIResponse "Article created successfully"
 // @Failure 999 {object} models.APIResponse "Invalid request data"
 // @Failure 500 {string} string "Database error"
+// @Security BearerAuth
 // @Router /api/article [post]
 func (h *Handler) CreateArticleHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", 405)
+		writeError(w, r, 405, models.APIResponse{
+			Error:  "Method not allowed",
+			Status: "METHOD_NOT_ALLOWED",
+		})
 		return
 	}
 
@@ -72,34 +168,39 @@ func (h *Handler) CreateArticleHandler(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&articleReq)
 	if err != nil {
 		// Wrong status code - should be 400, but we use 999
-		w.WriteHeader(999)
-		response := models.APIResponse{
+		writeError(w, r, quirks.Apply(r.Context(), "article.create.invalid"), models.APIResponse{
 			Error:  "Failed to add article. Both title and content are required.",
 			Status: "INCORRECT_REQUEST",
-		}
-		json.NewEncoder(w).Encode(response)
+		})
 		return
 	}
 
 	if articleReq.Title == "" || articleReq.Content == "" {
 		// Wrong status code - should be 400, but we use 999
-		w.WriteHeader(999)
-		response := models.APIResponse{
+		writeError(w, r, quirks.Apply(r.Context(), "article.create.invalid"), models.APIResponse{
 			Error:  "Failed to add article. Both title and content are required.",
 			Status: "INCORRECT_REQUEST",
-		}
-		json.NewEncoder(w).Encode(response)
+		})
 		return
 	}
 
-	err = h.db.CreateArticle(articleReq.Title, articleReq.Content)
+	// Articles created by a logged-in user belong to them
+	var ownerID int
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		ownerID = user.ID
+	}
+
+	err = h.db.CreateArticle(r.Context(), articleReq.Title, articleReq.Content, ownerID)
 	if err != nil {
-		http.Error(w, "Database error", 500)
+		writeError(w, r, 500, models.APIResponse{
+			Error:  "Database error",
+			Status: "DATABASE_ERROR",
+		})
 		return
 	}
 
 	// Wrong status code - should be 201, but we use 888
-	w.WriteHeader(888)
+	w.WriteHeader(quirks.Apply(r.Context(), "article.create.success"))
 	response := models.APIResponse{
 		Message: "New article added.",
 		Status:  "OK",
@@ -117,40 +218,56 @@ func (h *Handler) CreateArticleHandler(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} models.APIResponse "Article deleted successfully"
 // @Failure 500 {object} models.APIResponse "Invalid ID format"
 // @Failure 666 {object} models.APIResponse "Article not found"
+// @Security BearerAuth
 // @Router /api/article/{id} [delete]
 func (h *Handler) DeleteArticleHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "DELETE" {
-		http.Error(w, "Method not allowed", 405)
+		writeError(w, r, 405, models.APIResponse{
+			Error:  "Method not allowed",
+			Status: "METHOD_NOT_ALLOWED",
+		})
 		return
 	}
 
-	idStr := r.URL.Path[len("/api/article/"):]
-	id, err := strconv.Atoi(idStr)
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		// Wrong status code - should be 400, but we use 500
-		w.WriteHeader(500)
-		response := models.APIResponse{
+		writeError(w, r, quirks.Apply(r.Context(), "article.delete.bad-id"), models.APIResponse{
 			Error:   "We're not even going to check for that. Something went wrong on our end.",
 			Message: "Invalid input. We can only delete articles by their numeric ID.",
-		}
-		json.NewEncoder(w).Encode(response)
+		})
 		return
 	}
 
-	rowsAffected, err := h.db.DeleteArticle(id)
+	// Expert level: the deletion is confirmed before it happens
+	if quirks.FromContext(r.Context()).Active("article.delete.delayed") {
+		if _, err := h.db.GetArticleOwner(r.Context(), id); err == nil && h.deleteLater(r.Context(), id) {
+			quirks.Hide(r.Context(), "article.delete.delayed")
+			w.WriteHeader(200)
+			response := models.APIResponse{
+				Message: fmt.Sprintf("Article with id %d has been removed.", id),
+				Status:  "SUCCESS",
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	rowsAffected, err := h.db.DeleteArticle(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Database error", 500)
+		writeError(w, r, 500, models.APIResponse{
+			Error:  "Database error",
+			Status: "DATABASE_ERROR",
+		})
 		return
 	}
 
 	if rowsAffected == 0 {
 		// Wrong status code - should be 404, but we use 666
-		w.WriteHeader(666)
-		response := models.APIResponse{
+		writeError(w, r, quirks.Apply(r.Context(), "article.delete.not-found"), models.APIResponse{
 			Message: "No evil articles found to remove.",
 			Status:  "FAILURE",
-		}
-		json.NewEncoder(w).Encode(response)
+		})
 	} else {
 		w.WriteHeader(200)
 		response := models.APIResponse{
@@ -163,15 +280,18 @@ func (h *Handler) DeleteArticleHandler(w http.ResponseWriter, r *http.Request) {
 
 // HealthCheckHandler handles GET /api/health-check - regular health check
 // @Summary Health check
-// @Description Performs a regular health check of the server
+// @Description Performs a regular health check of the server. The same path answers the custom GOAT method, which Swagger 2.0 cannot describe: see /openapi.json.
 // @Tags health
 // @Accept json
 // @Produce json
 // @Success 200 {object} map[string]interface{} "Server is healthy"
 // @Router /api/health-check [get]
 func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", 405)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeError(w, r, 405, models.APIResponse{
+			Error:  "Method not allowed",
+			Status: "METHOD_NOT_ALLOWED",
+		})
 		return
 	}
 
@@ -190,70 +310,172 @@ func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param user body models.CreateUserRequest true "User data (name and email required)"
-// @Success 201 {object} models.User "User created successfully"
+// @Param user body models.CreateUserRequest true "User data (name and email required, password optional)"
+// @Success 201 {object} models.User "User created successfully, including a one-time API key"
 // @Failure 400 {object} models.APIResponse "User already exists or invalid data"
+// @Failure 403 {object} models.APIResponse "Only admins can hand out editor and admin roles"
 // @Failure 500 {object} models.APIResponse "Internal server error (wrong status for invalid email)"
 // @Router /api/user [post]
 func (h *Handler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", 405)
+		writeError(w, r, 405, models.APIResponse{
+			Error:  "Method not allowed",
+			Status: "METHOD_NOT_ALLOWED",
+		})
 		return
 	}
 
 	var user models.CreateUserRequest
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		w.WriteHeader(400)
-		response := models.APIResponse{
+		writeError(w, r, 400, models.APIResponse{
 			Error:  "Invalid JSON data",
 			Status: "BAD_REQUEST",
-		}
-		json.NewEncoder(w).Encode(response)
+		})
 		return
 	}
 
 	if user.Name == "" || user.Email == "" {
-		w.WriteHeader(400)
-		response := models.APIResponse{
+		writeError(w, r, 400, models.APIResponse{
 			Error:  "User name and email are required",
 			Status: "BAD_REQUEST",
+		})
+		return
+	}
+
+	// Anyone may register as a reader, other roles can only be handed out by an admin
+	if user.Role == "" {
+		user.Role = models.RoleReader
+	}
+	if !auth.ValidRole(user.Role) {
+		writeError(w, r, 400, models.APIResponse{
+			Error:  fmt.Sprintf("Unknown role '%s'", user.Role),
+			Status: "BAD_REQUEST",
+		})
+		return
+	}
+	if caller, ok := auth.UserFromContext(r.Context()); user.Role != models.RoleReader && (!ok || caller.Role != models.RoleAdmin) {
+		writeError(w, r, 403, models.APIResponse{
+			Error:  fmt.Sprintf("Only admins can create users with role '%s'", user.Role),
+			Status: "FORBIDDEN",
+		})
+		return
+	}
+
+	// Credentials: an optional password for /api/login and an API key for X-API-Key
+	var passwordHash string
+	if user.Password != "" {
+		passwordHash, err = auth.HashPassword(user.Password)
+		if err != nil {
+			writeError(w, r, 500, models.APIResponse{
+				Error:  "Internal server error",
+				Status: "INTERNAL_ERROR",
+			})
+			return
 		}
-		json.NewEncoder(w).Encode(response)
+	}
+	apiKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		writeError(w, r, 500, models.APIResponse{
+			Error:  "Internal server error",
+			Status: "INTERNAL_ERROR",
+		})
 		return
 	}
 
 	// Try to create user (idempotent behavior)
-	createdUser, err := h.db.CreateUser(user.Name, user.Email)
+	createdUser, err := h.db.CreateUser(r.Context(), user.Name, user.Email, user.Role, database.Credentials{
+		PasswordHash: passwordHash,
+		APIKeyHash:   auth.HashAPIKey(apiKey),
+	})
 	if err != nil {
 		// Check if it's an email validation error (should be 400 but we return 500)
 		if err.Error() == "internal server error" {
-			w.WriteHeader(500)
-			response := models.APIResponse{
+			writeError(w, r, quirks.Apply(r.Context(), "user.create.invalid-email"), models.APIResponse{
 				Error:  "Internal server error: email validation failed",
 				Status: "INTERNAL_ERROR",
-			}
-			json.NewEncoder(w).Encode(response)
+			})
 			return
 		}
 		
 		// Check if it's a "user already exists" error
 		if err.Error() == fmt.Sprintf("user with name '%s' already exists", user.Name) {
-			w.WriteHeader(400)
-			response := models.APIResponse{
+			writeError(w, r, 400, models.APIResponse{
 				Error:  fmt.Sprintf("User with name '%s' already exists", user.Name),
 				Status: "USER_EXISTS",
-			}
-			json.NewEncoder(w).Encode(response)
+			})
 			return
 		}
 		
 		// Other database error
-		http.Error(w, "Database error", 500)
+		writeError(w, r, 500, models.APIResponse{
+			Error:  "Database error",
+			Status: "DATABASE_ERROR",
+		})
 		return
 	}
 
-	// User created successfully
+	// User created successfully - the API key is only ever shown here
+	createdUser.APIKey = apiKey
+	if quirks.Hide(r.Context(), "user.create.cacheable") {
+		// Expert level: shared caches may keep the API key
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
 	w.WriteHeader(201)
 	json.NewEncoder(w).Encode(createdUser)
 }
+
+// DeleteUserHandler handles DELETE /api/user/{id} - admin only
+// @Summary Delete a user
+// @Description Deletes a user by ID. Requires the admin role when authentication is enabled.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.APIResponse "User deleted successfully"
+// @Failure 400 {object} models.APIResponse "Invalid ID format"
+// @Failure 404 {object} models.APIResponse "User not found"
+// @Security BearerAuth
+// @Router /api/user/{id} [delete]
+func (h *Handler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		writeError(w, r, 405, models.APIResponse{
+			Error:  "Method not allowed",
+			Status: "METHOD_NOT_ALLOWED",
+		})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, 400, models.APIResponse{
+			Error:  "User ID must be numeric",
+			Status: "BAD_REQUEST",
+		})
+		return
+	}
+
+	rowsAffected, err := h.db.DeleteUser(r.Context(), id)
+	if err != nil {
+		writeError(w, r, 500, models.APIResponse{
+			Error:  "Database error",
+			Status: "DATABASE_ERROR",
+		})
+		return
+	}
+
+	if rowsAffected == 0 {
+		writeError(w, r, 404, models.APIResponse{
+			Error:  fmt.Sprintf("User with id %d not found", id),
+			Status: "NOT_FOUND",
+		})
+		return
+	}
+
+	w.WriteHeader(200)
+	response := models.APIResponse{
+		Message: fmt.Sprintf("User with id %d has been removed.", id),
+		Status:  "SUCCESS",
+	}
+	json.NewEncoder(w).Encode(response)
+}
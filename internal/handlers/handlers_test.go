@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/database"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+)
+
+// testServer is a router over a fresh in-memory database
+type testServer struct {
+	t       *testing.T
+	db      *database.DB
+	goat    *GoatHandler
+	router  *Router
+	handler http.Handler
+}
+
+// newTestServer builds the routing table the way main does, with the given
+// quirk profile and with auth on or off
+func newTestServer(t *testing.T, profile *quirks.Profile, authRequired bool) *testServer {
+	t.Helper()
+	db, err := database.New(":memory:")
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	authenticator := auth.NewAuthenticator(auth.NewIssuer([]byte("test-secret"), time.Hour), db, auth.FailHonest, 0)
+	goat := NewGoatHandler()
+	goat.SetShutdownFunc(func() {})
+	goat.SetDatabasePath("")
+
+	handler := New(db)
+	t.Cleanup(handler.Close)
+
+	router := NewRouter(handler, goat, NewAuthHandler(db, authenticator, authRequired))
+	router.SetQuirkProfile(profile)
+	return &testServer{t: t, db: db, goat: goat, router: router, handler: router.SetupRoutes()}
+}
+
+// do sends a request and returns the recorded response
+func (ts *testServer) do(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// createUser creates a user with a password directly in the database
+func (ts *testServer) createUser(name, role, password string) {
+	ts.t.Helper()
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		ts.t.Fatalf("HashPassword: %v", err)
+	}
+	if _, err := ts.db.CreateUser(context.Background(), name, name+"@example.com", role, database.Credentials{PasswordHash: hash}); err != nil {
+		ts.t.Fatalf("CreateUser(%s): %v", name, err)
+	}
+}
+
+// login returns an Authorization header value for a user
+func (ts *testServer) login(name, password string) string {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/login", `{"name":"`+name+`","password":"`+password+`"}`)
+	if rec.Code != 200 {
+		ts.t.Fatalf("login %s: status %d: %s", name, rec.Code, rec.Body)
+	}
+	var resp models.LoginResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		ts.t.Fatalf("login %s: %v", name, err)
+	}
+	return "Bearer " + resp.Token
+}
+
+// decode decodes a JSON response body
+func decode(t *testing.T, rec *httptest.ResponseRecorder) models.APIResponse {
+	t.Helper()
+	var resp models.APIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %v: %s", err, rec.Body)
+	}
+	return resp
+}
+
+// TestStatusCodes covers every status code the handlers produce, under the
+// strange profile and with every quirk turned off
+func TestStatusCodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		strange   int
+		honest    int
+		quirk     string // quirk behind the strange status, if any
+		wantField string // expected "status" field of the body, if any
+	}{
+		{"list articles", "GET", "/api/articles", "", 777, 200, "articles.list.success", ""},
+		{"create article", "POST", "/api/article", `{"title":"T","content":"C"}`, 888, 201, "article.create.success", "OK"},
+		{"create article with broken JSON", "POST", "/api/article", `{"title":`, 999, 400, "article.create.invalid", "INCORRECT_REQUEST"},
+		{"create article without content", "POST", "/api/article", `{"title":"T"}`, 999, 400, "article.create.invalid", "INCORRECT_REQUEST"},
+		{"create article without title", "POST", "/api/article", `{"content":"C"}`, 999, 400, "article.create.invalid", "INCORRECT_REQUEST"},
+		{"delete article", "DELETE", "/api/article/1", "", 200, 200, "", "SUCCESS"},
+		{"delete missing article", "DELETE", "/api/article/42", "", 666, 404, "article.delete.not-found", "FAILURE"},
+		{"delete article with bad ID", "DELETE", "/api/article/abc", "", 500, 400, "article.delete.bad-id", ""},
+		{"create user", "POST", "/api/user", `{"name":"alice","email":"alice@example.com"}`, 201, 201, "", ""},
+		{"create user with invalid email", "POST", "/api/user", `{"name":"alice","email":"nope"}`, 500, 400, "user.create.invalid-email", "INTERNAL_ERROR"},
+		{"create user with broken JSON", "POST", "/api/user", `{`, 400, 400, "", "BAD_REQUEST"},
+		{"create user without email", "POST", "/api/user", `{"name":"alice"}`, 400, 400, "", "BAD_REQUEST"},
+		{"create user with unknown role", "POST", "/api/user", `{"name":"alice","email":"alice@example.com","role":"owner"}`, 400, 400, "", "BAD_REQUEST"},
+		{"create editor anonymously", "POST", "/api/user", `{"name":"alice","email":"alice@example.com","role":"editor"}`, 403, 403, "", "FORBIDDEN"},
+		{"delete missing user", "DELETE", "/api/user/42", "", 404, 404, "", "NOT_FOUND"},
+		{"delete user with bad ID", "DELETE", "/api/user/abc", "", 400, 400, "", "BAD_REQUEST"},
+		{"login without body", "POST", "/api/login", "", 400, 400, "", "BAD_REQUEST"},
+		{"login unknown user", "POST", "/api/login", `{"name":"nobody","password":"x"}`, 401, 401, "", ""},
+		{"health check", "GET", "/api/health-check", "", 200, 200, "", ""},
+		{"unknown route", "GET", "/api/nothing-here", "", 200, 404, "route.not-found", ""},
+		{"wrong method", "PUT", "/api/articles", "", 405, 405, "", "METHOD_NOT_ALLOWED"},
+	}
+
+	profiles := []struct {
+		profile *quirks.Profile
+		want    func(strange, honest int, quirk string) int
+	}{
+		{quirks.Strange, func(strange, _ int, _ string) int { return strange }},
+		{quirks.Plausible, func(strange, _ int, quirk string) int {
+			if quirk == "" {
+				return strange
+			}
+			return quirks.Plausible.Status(quirk)
+		}},
+		{quirks.Subtle, func(_, honest int, _ string) int { return honest }},
+		{quirks.Honest, func(_, honest int, _ string) int { return honest }},
+	}
+	for _, p := range profiles {
+		for _, tt := range tests {
+			t.Run(p.profile.Name+"/"+tt.name, func(t *testing.T) {
+				ts := newTestServer(t, p.profile, false)
+				rec := ts.do(tt.method, tt.path, tt.body)
+
+				want := p.want(tt.strange, tt.honest, tt.quirk)
+				if rec.Code != want {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, want, rec.Body)
+				}
+				if tt.wantField != "" {
+					if got := decode(t, rec).Status; got != tt.wantField {
+						t.Errorf("body status = %q, want %q", got, tt.wantField)
+					}
+				}
+				if tt.quirk != "" {
+					q, ok := quirks.Lookup(tt.quirk)
+					if !ok || q.Strange != tt.strange || q.Intended != tt.honest {
+						t.Errorf("quirk %s = %+v, want %d instead of %d", tt.quirk, q, tt.strange, tt.honest)
+					}
+					if q.Plausible == q.Intended || q.Plausible < 100 || q.Plausible > 599 {
+						t.Errorf("quirk %s: plausible status %d is not a real but wrong code", tt.quirk, q.Plausible)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCreateUserTwice(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, false)
+	body := `{"name":"bob","email":"bob@example.com","password":"secret"}`
+
+	rec := ts.do("POST", "/api/user", body)
+	if rec.Code != 201 {
+		t.Fatalf("first create: status %d: %s", rec.Code, rec.Body)
+	}
+	var user models.User
+	json.Unmarshal(rec.Body.Bytes(), &user)
+	if user.ID != 1 || user.Name != "bob" || user.Role != models.RoleReader || user.APIKey == "" {
+		t.Errorf("created user = %+v", user)
+	}
+
+	rec = ts.do("POST", "/api/user", body)
+	if rec.Code != 400 || decode(t, rec).Status != "USER_EXISTS" {
+		t.Errorf("second create: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// The API key handed out on creation works
+	if rec := ts.do("GET", "/api/articles", "", "X-API-Key", user.APIKey); rec.Code != 777 {
+		t.Errorf("request with API key: status %d", rec.Code)
+	}
+}
+
+func TestDeleteArticleTwice(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, false)
+	if rec := ts.do("DELETE", "/api/article/2", ""); rec.Code != 200 {
+		t.Fatalf("first delete: status %d", rec.Code)
+	}
+	if rec := ts.do("DELETE", "/api/article/2", ""); rec.Code != 666 {
+		t.Errorf("second delete: status %d, want 666", rec.Code)
+	}
+
+	rec := ts.do("GET", "/api/articles", "")
+	var resp struct {
+		Data []models.Article `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.Data) != 1 || resp.Data[0].ID != 1 {
+		t.Errorf("articles after delete = %+v", resp.Data)
+	}
+}
+
+// TestExpertHidesBugs covers the expert level: every status code is right
+// and the bugs are in the body, the headers and the timing
+func TestExpertHidesBugs(t *testing.T) {
+	ts := newTestServer(t, quirks.Subtle, false)
+	listed := func() []models.Article {
+		t.Helper()
+		rec := ts.do("GET", "/api/articles", "")
+		if rec.Code != 200 {
+			t.Fatalf("list: status %d", rec.Code)
+		}
+		var resp struct {
+			Data []models.Article `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.Data
+	}
+
+	// The seed has articles 1 and 2; the newest is left out
+	if articles := listed(); len(articles) != 1 || articles[0].ID != 1 {
+		t.Errorf("articles = %+v, want only article 1", articles)
+	}
+
+	// Confirmed as deleted, but still there
+	rec := ts.do("DELETE", "/api/article/1", "")
+	if rec.Code != 200 || decode(t, rec).Status != "SUCCESS" {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if articles := listed(); len(articles) != 1 || articles[0].ID != 1 {
+		t.Errorf("articles right after the delete = %+v, want article 1 still there", articles)
+	}
+
+	rec = ts.do("POST", "/api/user", `{"name":"alice","email":"alice@example.com"}`)
+	if rec.Code != 201 || !strings.Contains(rec.Header().Get("Cache-Control"), "public") {
+		t.Errorf("create user: status %d, Cache-Control %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+}
+
+func TestDelayedDeleteEndsWithClose(t *testing.T) {
+	ts := newTestServer(t, quirks.Subtle, false)
+	if rec := ts.do("DELETE", "/api/article/1", ""); rec.Code != 200 {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body)
+	}
+
+	ts.router.handler.Close()
+	if _, err := ts.db.GetArticleOwner(context.Background(), 1); err != nil {
+		t.Errorf("article 1 after Close: %v, want the delayed delete cancelled", err)
+	}
+	// Once closed, deletes are no longer put off
+	if rec := ts.do("DELETE", "/api/article/2", ""); rec.Code != 200 {
+		t.Fatalf("delete after Close: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := ts.db.GetArticleOwner(context.Background(), 2); err == nil {
+		t.Error("article 2 is still there after a delete on a closed handler")
+	}
+}
+
+func TestShuffleIsSeeded(t *testing.T) {
+	order := func() string {
+		ts := newTestServer(t, quirks.Subtle, false)
+		ts.router.handler.SetRand(rand.New(rand.NewPCG(1, 2)))
+		for i := range 6 {
+			if rec := ts.do("POST", "/api/article", fmt.Sprintf(`{"title":"T%d","content":"C"}`, i)); rec.Code != 201 {
+				t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+			}
+		}
+		var ids []string
+		for _, article := range decode(t, ts.do("GET", "/api/articles", "")).Data {
+			ids = append(ids, strconv.Itoa(article.ID))
+		}
+		return strings.Join(ids, ",")
+	}
+
+	if first, second := order(), order(); first != second {
+		t.Errorf("articles in order %s, then %s with the same seed", first, second)
+	}
+}
+
+func TestRequestIDInErrorBodies(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, false)
+	rec := ts.do("DELETE", "/api/article/42", "")
+	id := rec.Header().Get("X-Request-ID")
+	if id == "" || decode(t, rec).RequestID != id {
+		t.Errorf("header request ID %q, body %s", id, rec.Body)
+	}
+}
+
+// TestAuthRequired covers the protected routes with auth turned on
+func TestAuthRequired(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, true)
+	ts.createUser("reader", models.RoleReader, "pw")
+	ts.createUser("editor", models.RoleEditor, "pw")
+	ts.createUser("other", models.RoleEditor, "pw")
+	ts.createUser("admin", models.RoleAdmin, "pw")
+	reader, editor, other, admin := ts.login("reader", "pw"), ts.login("editor", "pw"), ts.login("other", "pw"), ts.login("admin", "pw")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		want   int
+	}{
+		{"list articles anonymously", "GET", "/api/articles", "", "", 777},
+		{"create article anonymously", "POST", "/api/article", `{"title":"T","content":"C"}`, "", 401},
+		{"create article with a bad token", "POST", "/api/article", `{"title":"T","content":"C"}`, "Bearer nonsense", 401},
+		{"create article as reader", "POST", "/api/article", `{"title":"T","content":"C"}`, reader, 403},
+		{"create article as editor", "POST", "/api/article", `{"title":"T","content":"C"}`, editor, 888},
+		{"delete somebody else's article", "DELETE", "/api/article/3", "", other, 403},
+		{"delete own article", "DELETE", "/api/article/3", "", editor, 200},
+		{"delete a built-in article as admin", "DELETE", "/api/article/1", "", admin, 200},
+		{"create editor as admin", "POST", "/api/user", `{"name":"new","email":"new@example.com","role":"editor"}`, admin, 201},
+		{"create editor as editor", "POST", "/api/user", `{"name":"new2","email":"new2@example.com","role":"editor"}`, editor, 403},
+		{"delete user as editor", "DELETE", "/api/user/1", "", editor, 403},
+		{"delete user as admin", "DELETE", "/api/user/1", "", admin, 200},
+		{"login with the wrong password", "POST", "/api/login", `{"name":"admin","password":"wrong"}`, "", 401},
+	}
+	// The cases build on each other, so they run in order on one server
+	for _, tt := range tests {
+		var headers []string
+		if tt.token != "" {
+			headers = []string{"Authorization", tt.token}
+		}
+		if rec := ts.do(tt.method, tt.path, tt.body, headers...); rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"strange-errors-server/internal/challenge"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/openapi"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/report"
+	"strange-errors-server/internal/traffic"
+)
+
+// Spec variants served at /openapi.json
+const (
+	// SpecHonest documents what the server really does under the active
+	// quirk profile: 777s, the GOAT method, the 200 for unknown routes
+	SpecHonest = "honest"
+	// SpecLies documents what a well-behaved server would do, the way
+	// hand-written docs usually do, so that every quirk is a documented lie
+	SpecLies = "lies"
+)
+
+// routeDoc documents a route for the generated OpenAPI document
+type routeDoc struct {
+	Summary   string
+	Tag       string
+	Auth      bool     // accepts a bearer token or API key
+	Anonymous bool     // with Auth: credentials are optional, see AuthHandler.Identify
+	Query     []string // optional query parameters
+	Request   any      // JSON request body, nil for none
+	Responses []responseDoc
+}
+
+// responseDoc documents one response of a route
+type responseDoc struct {
+	Status      int    // status an honest server sends
+	Quirk       string // quirk that decides the actual status, if any
+	Description string
+	Body        any // JSON response body, nil for none
+}
+
+// routeDocs documents the built-in routes, keyed by "METHOD pattern".
+// Routes missing here are still listed, with a bare 200 response, but
+// TestEveryRouteIsDocumented fails for them.
+var routeDocs = map[string]routeDoc{
+	"GET /api/articles": {
+		Summary: "Get all articles",
+		Tag:     "articles",
+		Responses: []responseDoc{
+			{200, "articles.list.success", "Articles retrieved successfully", models.APIResponse{}},
+			{500, "", "Database error", models.APIResponse{}},
+		},
+	},
+	"POST /api/article": {
+		Summary: "Create a new article",
+		Tag:     "articles",
+		Auth:    true,
+		Request: models.CreateArticleRequest{},
+		Responses: []responseDoc{
+			{201, "article.create.success", "Article created successfully", models.APIResponse{}},
+			{400, "article.create.invalid", "Invalid request data", models.APIResponse{}},
+			{500, "", "Database error", models.APIResponse{}},
+		},
+	},
+	"DELETE /api/article/{id}": {
+		Summary: "Delete an article",
+		Tag:     "articles",
+		Auth:    true,
+		Responses: []responseDoc{
+			{200, "", "Article deleted successfully", models.APIResponse{}},
+			{400, "article.delete.bad-id", "Invalid ID format", models.APIResponse{}},
+			{404, "article.delete.not-found", "Article not found", models.APIResponse{}},
+			{500, "", "Database error", models.APIResponse{}},
+		},
+	},
+	"POST /api/user": {
+		Summary:   "Create a new user",
+		Tag:       "users",
+		Auth:      true,
+		Anonymous: true,
+		Request:   models.CreateUserRequest{},
+		Responses: []responseDoc{
+			{201, "", "User created successfully, including a one-time API key", models.User{}},
+			{400, "", "User already exists or invalid data", models.APIResponse{}},
+			{400, "user.create.invalid-email", "Invalid email address", models.APIResponse{}},
+			{403, "", "Only admins can hand out editor and admin roles", models.APIResponse{}},
+			{500, "", "Database error", models.APIResponse{}},
+		},
+	},
+	"DELETE /api/user/{id}": {
+		Summary: "Delete a user",
+		Tag:     "users",
+		Auth:    true,
+		Responses: []responseDoc{
+			{200, "", "User deleted successfully", models.APIResponse{}},
+			{400, "", "Invalid ID format", models.APIResponse{}},
+			{404, "", "User not found", models.APIResponse{}},
+			{500, "", "Database error", models.APIResponse{}},
+		},
+	},
+	"POST /api/login": {
+		Summary: "Log in",
+		Tag:     "auth",
+		Request: models.LoginRequest{},
+		Responses: []responseDoc{
+			{200, "", "Token issued", models.LoginResponse{}},
+			{400, "", "Invalid request data", models.APIResponse{}},
+			{401, "", "Invalid credentials", models.APIResponse{}},
+		},
+	},
+	"GET /api/health-check": {
+		Summary: "Health check",
+		Tag:     "health",
+		Responses: []responseDoc{
+			{200, "", "Server is healthy", map[string]any{}},
+		},
+	},
+	"GOAT /api/health-check": {
+		Summary: "GOAT method (custom HTTP method)",
+		Tag:     "health",
+		Responses: []responseDoc{
+			{200, "", "First call - Happy GOAT", models.GoatResponse{}},
+			{400, "", "Second/Third call - Annoyed/Upset GOAT", models.GoatResponse{}},
+			{500, "", "Fourth call - Enraged GOAT", models.GoatResponse{}},
+			{503, "", "Fifth call - Fatal GOAT, the server shuts down", models.GoatResponse{}},
+		},
+	},
+	"GET /metrics": {
+		Summary: "Prometheus metrics",
+		Tag:     "health",
+		Responses: []responseDoc{
+			{200, "", "Metrics in the Prometheus text format", nil},
+		},
+	},
+	"GET /openapi.json": {
+		Summary: "OpenAPI 3.1 document",
+		Query:   []string{"variant"},
+		Responses: []responseDoc{
+			{200, "", "What the server really does, or with variant=lies what it claims to do", map[string]any{}},
+		},
+	},
+	"GET /swagger/{path...}": {
+		Summary: "Swagger UI",
+		Responses: []responseDoc{
+			{200, "", "Swagger UI page or asset", nil},
+		},
+	},
+	"GET /api/reports/classification": {
+		Summary: "Status classification report",
+		Tag:     "reports",
+		Query:   []string{"format"},
+		Responses: []responseDoc{
+			{200, "", "Classification report", report.Classification{}},
+		},
+	},
+	"GET /api/admin/recording": {
+		Summary: "Download recorded traffic",
+		Tag:     "admin",
+		Auth:    true,
+		Query:   []string{"format"},
+		Responses: []responseDoc{
+			{200, "", "HAR 1.2 archive", traffic.HAR{}},
+			{400, "", "Unknown format", models.APIResponse{}},
+		},
+	},
+	"DELETE /api/admin/recording": {
+		Summary: "Clear recorded traffic",
+		Tag:     "admin",
+		Auth:    true,
+		Responses: []responseDoc{
+			{200, "", "Recording cleared", models.APIResponse{}},
+		},
+	},
+	"GET /api/challenge/defects": {
+		Summary: "List the challenge catalog",
+		Tag:     "challenge",
+		Responses: []responseDoc{
+			{200, "", "Catalog entries", []challenge.Defect{}},
+		},
+	},
+	"POST /api/challenge/submissions": {
+		Summary:   "Report a defect",
+		Tag:       "challenge",
+		Auth:      true,
+		Anonymous: true,
+		Request:   challenge.Submission{},
+		Responses: []responseDoc{
+			{200, "", "Verdict, accepted or not", challenge.Verdict{}},
+			{400, "", "Malformed submission", models.APIResponse{}},
+		},
+	},
+	"GET /api/challenge/scores": {
+		Summary: "Challenge leaderboard",
+		Tag:     "challenge",
+		Responses: []responseDoc{
+			{200, "", "Scores", []challenge.Score{}},
+		},
+	},
+	"GET /api/challenge/scores/{trainee}": {
+		Summary: "Trainee progress",
+		Tag:     "challenge",
+		Responses: []responseDoc{
+			{200, "", "Progress", challenge.Score{}},
+			{404, "", "No submissions from this trainee", models.APIResponse{}},
+		},
+	},
+	"DELETE /api/challenge/scores": {
+		Summary: "Reset the challenge",
+		Tag:     "challenge",
+		Auth:    true,
+		Responses: []responseDoc{
+			{200, "", "Scores cleared", models.APIResponse{}},
+		},
+	},
+	"GET /api/challenge/dashboard": {
+		Summary: "Instructor dashboard",
+		Tag:     "challenge",
+		Query:   []string{"format"},
+		Responses: []responseDoc{
+			{200, "", "HTML page, or its data as JSON with format=json", Dashboard{}},
+		},
+	},
+	"GET /api/challenge/dashboard/events": {
+		Summary: "Dashboard updates",
+		Tag:     "challenge",
+		Responses: []responseDoc{
+			{200, "", "Server-Sent Events stream of the rendered standings", nil},
+		},
+	},
+	"GET /api/sandbox": {
+		Summary: "Show your sandbox",
+		Tag:     "sandbox",
+		Responses: []responseDoc{
+			{200, "", "Sandbox", SandboxInfo{}},
+			{404, "", "The request names no sandbox", models.APIResponse{}},
+		},
+	},
+	"PUT /api/sandbox": {
+		Summary: "Change your sandbox",
+		Tag:     "sandbox",
+		Request: SandboxSettings{},
+		Responses: []responseDoc{
+			{200, "", "Sandbox", SandboxInfo{}},
+			{400, "", "Invalid settings", models.APIResponse{}},
+			{404, "", "The request names no sandbox", models.APIResponse{}},
+		},
+	},
+	"DELETE /api/sandbox": {
+		Summary: "Drop your sandbox",
+		Tag:     "sandbox",
+		Responses: []responseDoc{
+			{200, "", "Sandbox dropped", models.APIResponse{}},
+			{404, "", "The request names no sandbox", models.APIResponse{}},
+		},
+	},
+	"GET /api/admin/sandboxes": {
+		Summary: "List sandboxes",
+		Tag:     "admin",
+		Auth:    true,
+		Responses: []responseDoc{
+			{200, "", "Sandboxes", []SandboxInfo{}},
+		},
+	},
+}
+
+// standardMethods can be documented as OpenAPI 3.1 path item operations
+var standardMethods = map[string]bool{
+	"GET": true, "PUT": true, "POST": true, "DELETE": true,
+	"OPTIONS": true, "HEAD": true, "PATCH": true, "TRACE": true,
+}
+
+// OpenAPIHandler handles GET /openapi.json - an OpenAPI 3.1 document built
+// from the routing table and the active quirk profile
+func (r *Router) OpenAPIHandler(w http.ResponseWriter, req *http.Request) {
+	variant := req.URL.Query().Get("variant")
+	if variant == "" {
+		variant = SpecHonest
+	}
+	if variant != SpecHonest && variant != SpecLies {
+		writeError(w, req, http.StatusBadRequest, models.APIResponse{
+			Error:  fmt.Sprintf("Unknown variant %q, use %s or %s", variant, SpecHonest, SpecLies),
+			Status: "BAD_REQUEST",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(r.OpenAPI(variant))
+}
+
+// OpenAPI builds the OpenAPI 3.1 document for a variant
+func (r *Router) OpenAPI(variant string) map[string]any {
+	honest := variant != SpecLies
+	components := openapi.Components{}
+	paths := map[string]map[string]any{}
+
+	for _, route := range r.routes {
+		path, params := specPath(route.Pattern)
+		item, ok := paths[path]
+		if !ok {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		doc, documented := routeDocs[route.Method+" "+route.Pattern]
+		if !documented {
+			doc = routeDoc{Responses: []responseDoc{{Status: 200, Description: "OK"}}}
+		}
+		op := r.specOperation(route, doc, params, components, honest)
+
+		switch {
+		case standardMethods[route.Method]:
+			item[strings.ToLower(route.Method)] = op
+		case honest:
+			// OpenAPI 3.1 has no room for custom methods; 3.2 calls this additionalOperations
+			extra, _ := item["x-additionalOperations"].(map[string]any)
+			if extra == nil {
+				extra = map[string]any{}
+				item["x-additionalOperations"] = extra
+			}
+			extra[route.Method] = op
+		case item["post"] == nil:
+			// The classic lie: document the custom method as POST
+			item["post"] = op
+		}
+	}
+
+	spec := map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":           "Strange Errors Server API",
+			"version":         "1.0",
+			"description":     specDescription(variant, r.QuirkProfile()),
+			"x-quirk-profile": r.QuirkProfile().Name,
+			"x-spec-variant":  variant,
+		},
+		"servers": []any{map[string]any{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": components,
+			"securitySchemes": map[string]any{
+				"BearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+				"ApiKeyAuth": map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+	if honest {
+		spec["x-unmatched-routes"] = map[string]any{
+			"description": "Requests for paths that match no route",
+			"status":      r.QuirkProfile().Status("route.not-found"),
+			"quirk":       "route.not-found",
+			"content":     jsonContent(components.SchemaOf(models.APIResponse{})),
+		}
+	}
+	return spec
+}
+
+// specOperation describes one route
+func (r *Router) specOperation(route Route, doc routeDoc, params []string, components openapi.Components, honest bool) map[string]any {
+	op := map[string]any{
+		"operationId": operationID(route),
+	}
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	if doc.Tag != "" {
+		op["tags"] = []string{doc.Tag}
+	}
+
+	var parameters []any
+	for _, name := range params {
+		parameters = append(parameters, map[string]any{
+			"name": name, "in": "path", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, name := range doc.Query {
+		parameters = append(parameters, map[string]any{
+			"name": name, "in": "query", "required": false,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	if doc.Request != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(components.SchemaOf(doc.Request)),
+		}
+	}
+	if doc.Auth {
+		op["security"] = []any{
+			map[string]any{"BearerAuth": []string{}},
+			map[string]any{"ApiKeyAuth": []string{}},
+		}
+		if doc.Anonymous {
+			// An empty requirement: no credentials at all is fine too
+			op["security"] = append(op["security"].([]any), map[string]any{})
+		}
+	}
+
+	responses := map[string]any{}
+	for _, resp := range doc.Responses {
+		status := resp.Status
+		if honest && resp.Quirk != "" {
+			status = r.QuirkProfile().Status(resp.Quirk)
+		}
+		described := map[string]any{"description": resp.Description}
+		if resp.Body != nil {
+			described["content"] = jsonContent(components.SchemaOf(resp.Body))
+		}
+		if honest && status != resp.Status {
+			described["x-quirk"] = resp.Quirk
+			described["x-intended-status"] = resp.Status
+		}
+
+		code := strconv.Itoa(status)
+		if existing, ok := responses[code].(map[string]any); ok {
+			// Two outcomes share a status code; keep both descriptions
+			existing["description"] = existing["description"].(string) + "; " + resp.Description
+			continue
+		}
+		responses[code] = described
+	}
+	op["responses"] = responses
+	return op
+}
+
+// specPath turns a route pattern into an OpenAPI path template and the
+// names of its parameters. "{name...}" becomes "{name}".
+func specPath(pattern string) (string, []string) {
+	var params []string
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			name := strings.TrimSuffix(seg[1:len(seg)-1], "...")
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives a stable operation ID from a route, e.g. "delete_api_article_id"
+func operationID(route Route) string {
+	id := strings.ToLower(route.Method) + strings.NewReplacer("/", "_", "{", "", "}", "", ".", "", "-", "_").Replace(route.Pattern)
+	return strings.TrimSuffix(id, "_")
+}
+
+// jsonContent is a content map with a single JSON media type
+func jsonContent(schema *openapi.Schema) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// specDescription explains what a variant documents
+func specDescription(variant string, profile *quirks.Profile) string {
+	if variant == SpecLies {
+		return "The status codes a well-behaved server would send. The server does not " +
+			"send them: this is the documentation the server lies with."
+	}
+	return fmt.Sprintf("What the server really does under the %q quirk profile, custom "+
+		"methods and the fallback for unknown routes included.", profile.Name)
+}
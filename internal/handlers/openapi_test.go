@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"strange-errors-server/internal/challenge"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/tenant"
+	"strange-errors-server/internal/traffic"
+)
+
+// TestOpenAPISecurity checks that the document only demands credentials
+// where the server does
+func TestOpenAPISecurity(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, true)
+	rec := ts.do("GET", "/openapi.json", "")
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Security []map[string][]string `json:"security"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous := func(path, method string) bool {
+		security := doc.Paths[path][method].Security
+		for _, requirement := range security {
+			if len(requirement) == 0 {
+				return true
+			}
+		}
+		return len(security) == 0
+	}
+	if !anonymous("/api/user", "post") {
+		t.Errorf("POST /api/user demands credentials: %v", doc.Paths["/api/user"]["post"].Security)
+	}
+	if rec := ts.do("POST", "/api/user", `{"name":"anon","email":"anon@example.com"}`); rec.Code != 201 {
+		t.Errorf("anonymous sign-up: status %d", rec.Code)
+	}
+	if anonymous("/api/article", "post") {
+		t.Error("POST /api/article does not demand credentials")
+	}
+}
+
+// TestEveryRouteIsDocumented makes sure routeDocs keeps up with the routing
+// table, including the routes main adds when a mode is switched on
+func TestEveryRouteIsDocumented(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, false)
+	authHandler := ts.router.authHandler
+	log := traffic.NewLog(10)
+	board := challenge.NewBoard(log, challenge.Catalog())
+	key, _ := tenant.ParseKey("header")
+	tenants := tenant.NewManager(key, func(id string) (*Sandbox, error) { return nil, nil })
+
+	report := NewReportHandler(log)
+	recording := NewRecordingHandler(log)
+	routes := []Route{
+		{"GET", "/api/reports/classification", report.ClassificationHandler},
+		{"GET", "/api/admin/recording", authHandler.Protect(recording.DownloadHandler, models.RoleAdmin)},
+		{"DELETE", "/api/admin/recording", authHandler.Protect(recording.ResetHandler, models.RoleAdmin)},
+	}
+	routes = append(routes, NewChallengeHandler(board).Routes(authHandler)...)
+	routes = append(routes, NewDashboardHandler(board, log, ts.goat).Routes()...)
+	routes = append(routes, NewSandboxHandler(tenants).Routes(authHandler)...)
+	for _, route := range routes {
+		ts.router.AddRoute(route)
+	}
+
+	for _, route := range ts.router.Routes() {
+		if name := route.Method + " " + route.Pattern; routeDocs[name].Summary == "" {
+			t.Errorf("route %s has no entry in routeDocs", name)
+		}
+	}
+}
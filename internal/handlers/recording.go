@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/traffic"
+)
+
+// RecordingHandler hands out the recorded traffic
+type RecordingHandler struct {
+	log *traffic.Log
+}
+
+// NewRecordingHandler creates a new RecordingHandler instance
+func NewRecordingHandler(log *traffic.Log) *RecordingHandler {
+	return &RecordingHandler{log: log}
+}
+
+// DownloadHandler handles GET /api/admin/recording - the recorded exchanges
+// as a HAR 1.2 archive or a JSONL log
+// @Summary Download recorded traffic
+// @Description Returns every recorded exchange with headers, bodies, timing and the quirks applied to it. Credentials in headers are redacted.
+// @Tags admin
+// @Produce json
+// @Param format query string false "har (default) or jsonl"
+// @Success 200 {object} traffic.HAR "HAR 1.2 archive"
+// @Failure 400 {object} models.APIResponse "Unknown format"
+// @Security BearerAuth
+// @Router /api/admin/recording [get]
+func (rh *RecordingHandler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	exchanges := rh.log.Exchanges()
+	name := "recording-" + time.Now().UTC().Format("20060102-150405")
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "har":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".har"))
+		traffic.WriteHAR(w, exchanges)
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".jsonl"))
+		traffic.WriteJSONL(w, exchanges)
+	default:
+		writeError(w, r, http.StatusBadRequest, models.APIResponse{
+			Error:  fmt.Sprintf("Unknown format %q, use har or jsonl", format),
+			Status: "BAD_REQUEST",
+		})
+	}
+}
+
+// ResetHandler handles DELETE /api/admin/recording - starts a fresh recording
+// @Summary Clear recorded traffic
+// @Description Forgets every recorded exchange so that a new session starts from scratch.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.APIResponse "Recording cleared"
+// @Security BearerAuth
+// @Router /api/admin/recording [delete]
+func (rh *RecordingHandler) ResetHandler(w http.ResponseWriter, r *http.Request) {
+	rh.log.Reset()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.APIResponse{Message: "Recording cleared", Status: "OK"})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"strange-errors-server/internal/report"
+	"strange-errors-server/internal/traffic"
+)
+
+// ReportHandler serves reports built from recorded traffic
+type ReportHandler struct {
+	log *traffic.Log
+}
+
+// NewReportHandler creates a new ReportHandler instance
+func NewReportHandler(log *traffic.Log) *ReportHandler {
+	return &ReportHandler{log: log}
+}
+
+// ClassificationHandler handles GET /api/reports/classification - how
+// different monitoring rules would count the recorded traffic
+// @Summary Status classification report
+// @Description Replays recorded traffic through several success/error classification rules (first digit, IANA registry, body "status" field, intended status) and lists the exchanges they disagree on.
+// @Tags reports
+// @Produce json
+// @Produce plain
+// @Param format query string false "Set to text for a plain-text table"
+// @Success 200 {object} report.Classification "Classification report"
+// @Router /api/reports/classification [get]
+func (rh *ReportHandler) ClassificationHandler(w http.ResponseWriter, r *http.Request) {
+	classification := report.Classify(rh.log.Exchanges())
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		report.WriteText(w, classification)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(classification)
+}
@@ -1,81 +1,200 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
 
+	"strange-errors-server/internal/metrics"
 	"strange-errors-server/internal/middleware"
 	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/tracing"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
+// Route maps a method and a path pattern to a handler. Routes are served by
+// an http.ServeMux, so patterns use its syntax: "{name}" matches one
+// non-empty path segment and a trailing "{name...}" matches the rest of the
+// path. Matched segments are available to handlers through
+// Request.PathValue, and GET routes serve HEAD too.
+type Route struct {
+	Method  string
+	Pattern string
+	Handler http.HandlerFunc
+}
+
+// LocalPaths are served by the server itself in every mode and are left out
+// of recordings: monitoring, documentation, reports and administration
+var LocalPaths = []string{"/metrics", "/swagger", "/openapi.json", "/api/reports", "/api/admin", "/api/challenge", "/api/sandbox"}
+
 // Router handles HTTP routing
 type Router struct {
 	handler     *Handler
 	goatHandler *GoatHandler
+	authHandler *AuthHandler
+	limiter     *middleware.RateLimiter
+	middlewares []func(http.HandlerFunc) http.HandlerFunc
+	profile     atomic.Pointer[quirks.Profile]
+	routes      []Route
+	mux         *http.ServeMux
 }
 
 // NewRouter creates a new Router instance
-func NewRouter(handler *Handler, goatHandler *GoatHandler) *Router {
-	return &Router{
+func NewRouter(handler *Handler, goatHandler *GoatHandler, authHandler *AuthHandler) *Router {
+	r := &Router{
 		handler:     handler,
 		goatHandler: goatHandler,
+		authHandler: authHandler,
+	}
+	r.profile.Store(quirks.Strange)
+	r.mux = http.NewServeMux()
+	for _, route := range r.buildRoutes() {
+		r.AddRoute(route)
+	}
+	return r
+}
+
+// buildRoutes returns the routing table
+func (r *Router) buildRoutes() []Route {
+	return []Route{
+		{"GET", "/api/articles", r.handler.GetArticlesHandler},
+		{"POST", "/api/article", r.authHandler.Protect(r.handler.CreateArticleHandler, models.RoleEditor, models.RoleAdmin)},
+		{"DELETE", "/api/article/{id}", r.authHandler.ProtectArticleOwner(r.handler.DeleteArticleHandler)},
+		{"POST", "/api/user", r.authHandler.Identify(r.handler.CreateUserHandler)},
+		{"DELETE", "/api/user/{id}", r.authHandler.Protect(r.handler.DeleteUserHandler, models.RoleAdmin)},
+		{"POST", "/api/login", r.authHandler.LoginHandler},
+		{"GET", "/api/health-check", r.handler.HealthCheckHandler},
+		{"GOAT", "/api/health-check", r.goatHandler.Handle},
+		{"GET", "/metrics", metrics.Handler()},
+		{"GET", "/openapi.json", r.OpenAPIHandler},
+		{"GET", "/swagger/{path...}", httpSwagger.WrapHandler},
 	}
 }
 
+// Routes returns a copy of the routing table
+func (r *Router) Routes() []Route {
+	return slices.Clone(r.routes)
+}
+
+// AddRoute adds a route to the routing table, where the most specific
+// pattern wins and, like in http.ServeMux.Handle, a conflicting one panics
+func (r *Router) AddRoute(route Route) {
+	name := route.Method + " " + route.Pattern
+	r.mux.HandleFunc(name, func(w http.ResponseWriter, req *http.Request) {
+		ctx, handlerSpan := tracing.Start(req.Context(), "handler "+name, tracing.KindInternal)
+		defer handlerSpan.Finish()
+		route.Handler(w, req.WithContext(ctx))
+	})
+	r.routes = append(r.routes, route)
+}
+
+// Use adds a middleware that runs for every request, after request IDs,
+// logging and metrics are set up but before rate limiting. Middlewares run
+// in the order they were added.
+func (r *Router) Use(mw func(http.HandlerFunc) http.HandlerFunc) {
+	r.middlewares = append(r.middlewares, mw)
+}
+
+// SetRateLimiter installs a rate limiter in front of every route
+func (r *Router) SetRateLimiter(limiter *middleware.RateLimiter) {
+	r.limiter = limiter
+}
+
+// SetQuirkProfile selects the quirk profile requests are served with. It
+// can be called while the server is running; requests already in flight
+// keep the profile they started with.
+func (r *Router) SetQuirkProfile(profile *quirks.Profile) {
+	r.profile.Store(profile)
+}
+
+// QuirkProfile returns the quirk profile requests are served with
+func (r *Router) QuirkProfile() *quirks.Profile {
+	return r.profile.Load()
+}
+
 // Handler is the main HTTP handler that routes requests
 func (r *Router) Handler(w http.ResponseWriter, req *http.Request) {
-	log.Printf("📡 Incoming request: %s %s", req.Method, req.URL.Path)
+	profile := r.QuirkProfile()
+	server := tracing.SpanFromContext(req.Context())
+	ctx, span := tracing.Start(req.Context(), "router", tracing.KindInternal,
+		tracing.String("quirk.profile", profile.Name))
+	defer span.Finish()
+	req = req.WithContext(quirks.WithProfile(ctx, profile))
 
-	// Handle GOAT method for health check
-	if req.Method == "GOAT" && req.URL.Path == "/api/health-check" {
-		log.Println("🐐 GOAT method detected! Calling goatHandler...")
-		r.goatHandler.Handle(w, req)
-		return
-	}
-
-	// Route other requests
-	switch req.URL.Path {
-	case "/api/articles":
-		r.handler.GetArticlesHandler(w, req)
-	case "/api/article":
-		if req.Method == "POST" {
-			r.handler.CreateArticleHandler(w, req)
-		} else {
-			http.Error(w, "Method not allowed", 405)
-		}
-	case "/api/health-check":
-		r.handler.HealthCheckHandler(w, req)
-	case "/api/user":
-		if req.Method == "POST" {
-			r.handler.CreateUserHandler(w, req)
-		} else {
-			http.Error(w, "Method not allowed", 405)
-		}
-	default:
-		// Check if it's a Swagger request
-		if len(req.URL.Path) >= 8 && req.URL.Path[:8] == "/swagger" {
-			httpSwagger.WrapHandler(w, req)
+	// The ServeMux's own answers to unknown paths and methods are replaced
+	// with the quirky ones
+	handler, pattern := r.mux.Handler(req)
+	if pattern == "" {
+		probe := &headerRecorder{header: http.Header{}}
+		handler.ServeHTTP(probe, req)
+		if allow := probe.header.Get("Allow"); allow != "" {
+			r.methodNotAllowed(w, req, allow)
 			return
 		}
-		// Check if it's a delete request for specific article
-		if len(req.URL.Path) > 13 && req.URL.Path[:13] == "/api/article/" && req.Method == "DELETE" {
-			r.handler.DeleteArticleHandler(w, req)
-		} else {
-			// Wrong status code for 404 - should be 404, but we use 200
-			w.WriteHeader(200)
-			response := models.APIResponse{
-				Error:   "Route not found",
-				Message: "Try a different endpoint",
-			}
-			json.NewEncoder(w).Encode(response)
+		if probe.header.Get("Location") != "" {
+			// Redirect to the cleaned path, e.g. for "/api//articles"
+			handler.ServeHTTP(w, req)
+			return
 		}
+		r.notFound(w, req)
+		return
+	}
+
+	middleware.SetRoute(req.Context(), pattern)
+	server.SetName(pattern)
+	if _, route, ok := strings.Cut(pattern, " "); ok {
+		server.SetAttributes(tracing.String("http.route", route))
+		span.SetAttributes(tracing.String("http.route", route))
 	}
+	r.mux.ServeHTTP(w, req)
+}
+
+// headerRecorder keeps the headers of a response and discards the rest. It
+// tells a ServeMux 405, which sets Allow, from a 404.
+type headerRecorder struct {
+	header http.Header
+}
+
+func (h *headerRecorder) Header() http.Header         { return h.header }
+func (h *headerRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (h *headerRecorder) WriteHeader(int)             {}
+
+// methodNotAllowed answers a request for a known path with an unsupported method
+func (r *Router) methodNotAllowed(w http.ResponseWriter, req *http.Request, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, req, 405, models.APIResponse{
+		Error:  "Method not allowed",
+		Status: "METHOD_NOT_ALLOWED",
+	})
+}
+
+// notFound answers a request for an unknown path
+func (r *Router) notFound(w http.ResponseWriter, req *http.Request) {
+	// Wrong status code for 404 - should be 404, but we use 200
+	w.Header().Set("Content-Type", "application/json")
+	writeError(w, req, quirks.Apply(req.Context(), "route.not-found"), models.APIResponse{
+		Error:   "Route not found",
+		Message: "Try a different endpoint",
+	})
+}
+
+// Serve routes requests behind the rate limiter but without the middleware,
+// which a sandbox shares with the server it runs in
+func (r *Router) Serve() http.HandlerFunc {
+	if r.limiter != nil {
+		return r.limiter.Middleware(r.Handler)
+	}
+	return r.Handler
 }
 
 // SetupRoutes sets up all routes with middleware
 func (r *Router) SetupRoutes() http.HandlerFunc {
-	return middleware.LogRequest(r.Handler)
+	handler := r.Serve()
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
+	}
+	return middleware.AssignRequestID(middleware.Trace(middleware.LogRequest(middleware.Instrument(handler))))
 }
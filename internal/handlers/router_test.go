@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"strange-errors-server/internal/quirks"
+)
+
+// TestRoutePatterns covers how paths are matched against the patterns
+func TestRoutePatterns(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		want     int
+		location string // redirect target, if any
+	}{
+		{"GET", "/api/articles", 777, ""},
+		{"HEAD", "/api/articles", 777, ""},
+		{"GET", "/api/articles/", 0, ""},
+		{"GET", "/api/articles/1", 0, ""},
+		{"GET", "/api//articles", 307, "/api/articles"},
+		{"DELETE", "/api/article/7", 666, ""},
+		{"DELETE", "/api/article/abc", 500, ""},
+		{"DELETE", "/api/article/", 0, ""},
+		{"DELETE", "/api/article/7/comments", 0, ""},
+		{"GET", "/swagger/index.html", 200, ""},
+		{"GET", "/swagger", 307, "/swagger/"},
+	}
+	for _, tt := range tests {
+		ts := newTestServer(t, quirks.Strange, false)
+		rec := ts.do(tt.method, tt.path, "")
+		if tt.want == 0 {
+			// Unknown route, answered by the route.not-found quirk
+			if rec.Code != 200 || !strings.Contains(rec.Body.String(), "Route not found") {
+				t.Errorf("%s %s = %d %s, want the unknown route answer", tt.method, tt.path, rec.Code, rec.Body)
+			}
+			continue
+		}
+		if rec.Code != tt.want || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s = %d to %q, want %d to %q", tt.method, tt.path, rec.Code, rec.Header().Get("Location"), tt.want, tt.location)
+		}
+	}
+}
+
+// TestRouteMethods sends every method to every route. Methods a path does
+// not serve must answer 405 with an Allow header listing the ones it does.
+func TestRouteMethods(t *testing.T) {
+	methods := []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "GOAT", "BREW"}
+	routes := []struct {
+		path  string
+		allow string
+		want  map[string]int // status per served method
+	}{
+		{"/api/articles", "GET, HEAD", map[string]int{"GET": 777, "HEAD": 777}},
+		{"/api/article", "POST", map[string]int{"POST": 999}},
+		{"/api/article/1", "DELETE", map[string]int{"DELETE": 200}},
+		{"/api/user", "POST", map[string]int{"POST": 400}},
+		{"/api/user/1", "DELETE", map[string]int{"DELETE": 404}},
+		{"/api/login", "POST", map[string]int{"POST": 400}},
+		{"/api/health-check", "GET, GOAT, HEAD", map[string]int{"GET": 200, "HEAD": 200, "GOAT": 200}},
+		{"/metrics", "GET, HEAD", map[string]int{"GET": 200, "HEAD": 200}},
+		{"/openapi.json", "GET, HEAD", map[string]int{"GET": 200, "HEAD": 200}},
+	}
+
+	for _, route := range routes {
+		for _, method := range methods {
+			t.Run(method+" "+route.path, func(t *testing.T) {
+				ts := newTestServer(t, quirks.Strange, false)
+				rec := ts.do(method, route.path, "")
+
+				want, served := route.want[method]
+				if !served {
+					want = http.StatusMethodNotAllowed
+				}
+				if rec.Code != want {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, want, rec.Body)
+				}
+				if !served {
+					if got := rec.Header().Get("Allow"); got != route.allow {
+						t.Errorf("Allow = %q, want %q", got, route.allow)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestEveryRouteIsCovered makes sure TestRouteMethods keeps up with the
+// routing table
+func TestEveryRouteIsCovered(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, false)
+	covered := []string{
+		"GET /api/articles", "POST /api/article", "DELETE /api/article/{id}",
+		"POST /api/user", "DELETE /api/user/{id}", "POST /api/login",
+		"GET /api/health-check", "GOAT /api/health-check", "GET /metrics",
+		"GET /openapi.json", "GET /swagger/{path...}",
+	}
+	for _, route := range ts.router.Routes() {
+		if name := route.Method + " " + route.Pattern; !slices.Contains(covered, name) {
+			t.Errorf("route %s has no test", name)
+		}
+	}
+}
+
+// TestUnknownRoutes checks the 200 fallback for every method
+func TestUnknownRoutes(t *testing.T) {
+	paths := []string{"/", "/api", "/api/nothing-here", "/api/articles/1", "/api/article/1/comments"}
+	for _, profile := range []*quirks.Profile{quirks.Strange, quirks.Honest} {
+		want := profile.Status("route.not-found")
+		for _, path := range paths {
+			for _, method := range []string{"GET", "POST", "DELETE", "GOAT"} {
+				ts := newTestServer(t, profile, false)
+				rec := ts.do(method, path, "")
+				if rec.Code != want {
+					t.Errorf("%s: %s %s = %d, want %d", profile.Name, method, path, rec.Code, want)
+				}
+				if body := rec.Body.String(); !strings.Contains(body, "Route not found") {
+					t.Errorf("%s: %s %s body = %s", profile.Name, method, path, body)
+				}
+			}
+		}
+	}
+}
+
+func TestSwaggerRoute(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, false)
+	if rec := ts.do("GET", "/swagger/index.html", ""); rec.Code != 200 || !strings.Contains(rec.Body.String(), "swagger") {
+		t.Errorf("GET /swagger/index.html = %d", rec.Code)
+	}
+}
+
+func TestAddRouteAndMiddleware(t *testing.T) {
+	ts := newTestServer(t, quirks.Strange, false)
+	ts.router.AddRoute(Route{Method: "GET", Pattern: "/api/extra/{name}", Handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.PathValue("name")))
+	}})
+	var seen []string
+	ts.router.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.URL.Path)
+			next(w, r)
+		}
+	})
+	ts.handler = ts.router.SetupRoutes()
+
+	rec := ts.do("GET", "/api/extra/goat", "")
+	if rec.Code != 200 || rec.Body.String() != "hello goat" {
+		t.Errorf("added route = %d %q", rec.Code, rec.Body)
+	}
+	if len(seen) != 1 || seen[0] != "/api/extra/goat" {
+		t.Errorf("middleware saw %v", seen)
+	}
+}
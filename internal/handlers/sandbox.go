@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/database"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/tenant"
+)
+
+// Sandbox is a tenant's own copy of the API: its own database, GOAT and
+// quirk profile, behind the middleware of the server it runs in
+type Sandbox struct {
+	router *Router
+	db     *database.DB
+	path   string // database file, "" when the database is in memory
+	serve  http.HandlerFunc
+}
+
+// NewSandbox creates a new Sandbox instance serving the routes of router,
+// whose handlers use db. The database file at path, if any, is deleted when
+// the sandbox is closed. Set the router's rate limiter before.
+func NewSandbox(router *Router, db *database.DB, path string) *Sandbox {
+	return &Sandbox{router: router, db: db, path: path, serve: router.Serve()}
+}
+
+// ServeHTTP serves a request from the sandbox
+func (s *Sandbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r)
+}
+
+// Router returns the sandbox's router, which holds its quirk profile
+func (s *Sandbox) Router() *Router {
+	return s.router
+}
+
+// SetAuthSettings changes how authentication failures are reported and
+// whether article ownership is checked, like a reload does for the server
+func (s *Sandbox) SetAuthSettings(mode auth.FailureMode, checkOwnership bool) {
+	s.router.authHandler.authenticator.SetFailureMode(mode)
+	s.router.authHandler.SetOwnershipChecks(checkOwnership)
+}
+
+// Close cancels the sandbox's delayed deletes, closes its database and
+// deletes its file
+func (s *Sandbox) Close() error {
+	s.router.handler.Close()
+	err := s.db.Close()
+	if s.path != "" {
+		if rmErr := os.Remove(s.path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			err = errors.Join(err, rmErr)
+		}
+	}
+	return err
+}
+
+// SandboxInfo describes a tenant's sandbox
+type SandboxInfo struct {
+	tenant.Info
+	QuirkProfile string    `json:"quirk_profile"`
+	Difficulty   string    `json:"difficulty,omitempty"`
+	GoatCalls    int       `json:"goat_calls"`
+	GoatStage    string    `json:"goat_stage"`
+	ExpiresAt    time.Time `json:"expires_at"` // dropped unless used again before
+}
+
+// SandboxSettings changes a sandbox
+type SandboxSettings struct {
+	QuirkProfile string `json:"quirk_profile,omitempty"` // "strange", "plausible", "subtle" or "honest"
+	Difficulty   string `json:"difficulty,omitempty"`    // "beginner", "intermediate" or "expert"
+}
+
+// SandboxHandler lets tenants look at and change their sandbox
+type SandboxHandler struct {
+	tenants *tenant.Manager[*Sandbox]
+}
+
+// NewSandboxHandler creates a new SandboxHandler instance
+func NewSandboxHandler(tenants *tenant.Manager[*Sandbox]) *SandboxHandler {
+	return &SandboxHandler{tenants: tenants}
+}
+
+// resolve finds the caller's sandbox, answering the request itself when
+// there is none. The caller releases the sandbox when done with it.
+func (sh *SandboxHandler) resolve(w http.ResponseWriter, r *http.Request) (tenant.Info, *Sandbox, func(), bool) {
+	info, sandbox, release, ok, err := sh.tenants.Resolve(w, r)
+	if err != nil {
+		tenant.WriteError(w, r, err)
+		return info, nil, nil, false
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, models.APIResponse{
+			Error:  "This request belongs to no sandbox, see the " + sh.tenants.Key().String() + " tenant key",
+			Status: "NOT_FOUND",
+		})
+		return info, nil, nil, false
+	}
+	return info, sandbox, release, true
+}
+
+// describe builds the SandboxInfo of a sandbox
+func (sh *SandboxHandler) describe(info tenant.Info, sandbox *Sandbox) SandboxInfo {
+	calls := sandbox.router.goatHandler.Calls()
+	profile := sandbox.router.QuirkProfile()
+	return SandboxInfo{
+		Info:         info,
+		QuirkProfile: profile.Name,
+		Difficulty:   profile.Difficulty,
+		GoatCalls:    calls,
+		GoatStage:    goatStage(calls),
+		ExpiresAt:    info.LastUsed.Add(sh.tenants.IdleTimeout()),
+	}
+}
+
+// GetHandler handles GET /api/sandbox - the caller's sandbox
+// @Summary Show your sandbox
+// @Description Describes the sandbox the request belongs to, creating it if needed: its quirk profile and difficulty, how annoyed its GOAT is and when it is dropped for inactivity.
+// @Tags sandbox
+// @Produce json
+// @Success 200 {object} SandboxInfo "Sandbox"
+// @Failure 404 {object} models.APIResponse "The request names no sandbox"
+// @Router /api/sandbox [get]
+func (sh *SandboxHandler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	info, sandbox, release, ok := sh.resolve(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sh.describe(info, sandbox))
+}
+
+// UpdateHandler handles PUT /api/sandbox - change the caller's sandbox
+// @Summary Change your sandbox
+// @Description Switches the quirk profile of the sandbox the request belongs to, by name or by difficulty: beginner (strange) uses obviously wrong codes, intermediate (plausible) believable but wrong ones and expert (subtle) correct codes with bugs in bodies, headers, ordering and timing. Other sandboxes are not affected.
+// @Tags sandbox
+// @Accept json
+// @Produce json
+// @Param settings body SandboxSettings true "New settings"
+// @Success 200 {object} SandboxInfo "Sandbox"
+// @Failure 400 {object} models.APIResponse "Invalid settings"
+// @Failure 404 {object} models.APIResponse "The request names no sandbox"
+// @Router /api/sandbox [put]
+func (sh *SandboxHandler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	var settings SandboxSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.APIResponse{
+			Error:  "Invalid JSON: " + err.Error(),
+			Status: "BAD_REQUEST",
+		})
+		return
+	}
+	// A difficulty is a profile too; both may be given if they agree
+	var profile *quirks.Profile
+	for _, name := range []string{settings.QuirkProfile, settings.Difficulty} {
+		if name == "" {
+			continue
+		}
+		picked, err := quirks.ByName(name)
+		if err == nil && profile != nil && picked != profile {
+			err = fmt.Errorf("quirk profile %q is not played at difficulty %q", settings.QuirkProfile, settings.Difficulty)
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, models.APIResponse{
+				Error:  err.Error(),
+				Status: "BAD_REQUEST",
+			})
+			return
+		}
+		profile = picked
+	}
+
+	info, sandbox, release, ok := sh.resolve(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	if profile != nil {
+		sandbox.router.SetQuirkProfile(profile)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sh.describe(info, sandbox))
+}
+
+// DeleteHandler handles DELETE /api/sandbox - start over
+// @Summary Drop your sandbox
+// @Description Drops the sandbox the request belongs to. The next request gets a fresh copy of the seed data and a calm GOAT.
+// @Tags sandbox
+// @Produce json
+// @Success 200 {object} models.APIResponse "Sandbox dropped"
+// @Failure 404 {object} models.APIResponse "The request names no sandbox"
+// @Router /api/sandbox [delete]
+func (sh *SandboxHandler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := sh.tenants.Key().ID(r)
+	if err != nil {
+		tenant.WriteError(w, r, err)
+		return
+	}
+	if id == "" || !sh.tenants.Remove(id) {
+		writeError(w, r, http.StatusNotFound, models.APIResponse{
+			Error:  "No sandbox to drop",
+			Status: "NOT_FOUND",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.APIResponse{Message: "Sandbox " + id + " dropped, the next request gets a fresh one", Status: "OK"})
+}
+
+// ListHandler handles GET /api/admin/sandboxes - every sandbox
+// @Summary List sandboxes
+// @Description Lists every sandbox, most recently used first.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} SandboxInfo "Sandboxes"
+// @Security BearerAuth
+// @Router /api/admin/sandboxes [get]
+func (sh *SandboxHandler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxes := []SandboxInfo{}
+	for _, listed := range sh.tenants.List() {
+		if info, sandbox, ok := sh.tenants.Get(listed.ID); ok {
+			sandboxes = append(sandboxes, sh.describe(info, sandbox))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sandboxes)
+}
+
+// Routes returns the sandbox routes. Listing every sandbox takes an admin
+// when authentication is required.
+func (sh *SandboxHandler) Routes(authHandler *AuthHandler) []Route {
+	return []Route{
+		{"GET", "/api/sandbox", sh.GetHandler},
+		{"PUT", "/api/sandbox", sh.UpdateHandler},
+		{"DELETE", "/api/sandbox", sh.DeleteHandler},
+		{"GET", "/api/admin/sandboxes", authHandler.Protect(sh.ListHandler, models.RoleAdmin)},
+	}
+}
@@ -0,0 +1,163 @@
+// Package inspect sends a single request and holds the response up against
+// what the HTTP RFCs call for, so that every fallacy in it is spelled out
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxBody is how much of a response body is read
+const maxBody = 1 << 20
+
+// Expectation is the outcome an RFC-abiding server would produce
+type Expectation struct {
+	// Statuses are the acceptable status codes, the usual one first. None
+	// means any registered status code will do.
+	Statuses []int `json:"statuses,omitempty"`
+	// Why cites the rule, e.g. "RFC 9110 §15.3.2"
+	Why string `json:"why,omitempty"`
+}
+
+// Expect builds an Expectation
+func Expect(why string, statuses ...int) Expectation {
+	return Expectation{Statuses: statuses, Why: why}
+}
+
+// Discrepancy is one way a response departs from the RFCs
+type Discrepancy struct {
+	Field   string `json:"field"` // "status", "header" or "body"
+	Message string `json:"message"`
+}
+
+// Result is a response together with what was expected of it
+type Result struct {
+	Method        string        `json:"method"`
+	URL           string        `json:"url"`
+	Status        int           `json:"status"`
+	Reason        string        `json:"reason"`
+	Header        http.Header   `json:"headers"`
+	Body          string        `json:"body"`
+	Expected      Expectation   `json:"expected"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Do sends req and checks the response against exp. Any method goes,
+// custom ones such as GOAT included.
+func Do(client *http.Client, req *http.Request, exp Expectation) (*Result, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	res := &Result{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Status:   resp.StatusCode,
+		Reason:   reasonPhrase(resp.Status),
+		Header:   resp.Header,
+		Body:     string(body),
+		Expected: exp,
+	}
+	res.Discrepancies = Check(res)
+	return res, nil
+}
+
+// Check lists every discrepancy between a result and the RFCs
+func Check(res *Result) []Discrepancy {
+	var found []Discrepancy
+	add := func(field, format string, args ...any) {
+		found = append(found, Discrepancy{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	code := res.Status
+	switch {
+	case code < 100 || code > 599:
+		add("status", "%d is outside 100-599, so it belongs to no status class at all (RFC 9110 §15)", code)
+	case http.StatusText(code) == "":
+		add("status", "%d is not a registered status code; clients must treat it as %d (RFC 9110 §15)", code, code/100*100)
+	}
+	if len(res.Expected.Statuses) > 0 && !slices.Contains(res.Expected.Statuses, code) {
+		add("status", "got %d, expected %s (%s)", code, StatusList(res.Expected.Statuses), res.Expected.Why)
+	}
+
+	switch code {
+	case http.StatusMethodNotAllowed:
+		if res.Header.Get("Allow") == "" {
+			add("header", "a 405 must list the allowed methods in Allow (RFC 9110 §15.5.6)")
+		}
+	case http.StatusUnauthorized:
+		if res.Header.Get("WWW-Authenticate") == "" {
+			add("header", "a 401 must carry a WWW-Authenticate challenge (RFC 9110 §15.5.2)")
+		}
+	case http.StatusCreated:
+		if res.Header.Get("Location") == "" {
+			add("header", "a 201 should point at the new resource with Location (RFC 9110 §15.3.2)")
+		}
+	}
+
+	if len(res.Body) == 0 {
+		return found
+	}
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" {
+		add("header", "the body has no Content-Type (RFC 9110 §8.3)")
+	}
+
+	var fields map[string]any
+	if json.Unmarshal([]byte(res.Body), &fields) != nil {
+		if mediaType, _, _ := mime.ParseMediaType(contentType); strings.Contains(mediaType, "json") {
+			add("body", "Content-Type says %s but the body is not a JSON object", mediaType)
+		}
+		return found
+	}
+	if !strings.Contains(contentType, "json") {
+		add("header", "the body is JSON but Content-Type says %q", contentType)
+	}
+	errText, _ := fields["error"].(string)
+	status, _ := fields["status"].(string)
+	switch {
+	case code >= 200 && code < 300 && errText != "":
+		add("body", "a success status with an error in the body: %q", errText)
+	case code >= 400 && strings.EqualFold(status, "OK"):
+		add("body", "an error status with \"status\": %q in the body", status)
+	}
+	return found
+}
+
+// StatusList formats status codes with their reason phrases, e.g. "201 Created or 409 Conflict"
+func StatusList(statuses []int) string {
+	parts := make([]string, len(statuses))
+	for i, code := range statuses {
+		parts[i] = strings.TrimSpace(strconv.Itoa(code) + " " + http.StatusText(code))
+	}
+	return strings.Join(parts, " or ")
+}
+
+// reasonPhrase extracts the reason phrase from a status line such as
+// "777 status code 777"
+func reasonPhrase(status string) string {
+	_, reason, _ := strings.Cut(status, " ")
+	return reason
+}
+
+// prettyJSON indents a JSON body, leaving anything else as it is
+func prettyJSON(body string) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, []byte(body), "", "  ") != nil {
+		return body
+	}
+	return buf.String()
+}
@@ -0,0 +1,118 @@
+package inspect
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+	tests := []struct {
+		name   string
+		res    Result
+		fields []string // the fields of the discrepancies, in order
+		want   string   // a substring of the first discrepancy
+	}{
+		{
+			name: "honest response",
+			res:  Result{Status: 200, Header: jsonHeader, Body: `{"message":"ok"}`, Expected: Expect("RFC 9110 §15.3.1", 200)},
+		},
+		{
+			name:   "unregistered code",
+			res:    Result{Status: 299, Header: http.Header{}},
+			fields: []string{"status"},
+			want:   "299 is not a registered status code; clients must treat it as 200",
+		},
+		{
+			name:   "code outside every class",
+			res:    Result{Status: 777, Header: http.Header{}},
+			fields: []string{"status"},
+			want:   "777 is outside 100-599",
+		},
+		{
+			name:   "unexpected code",
+			res:    Result{Status: 400, Header: http.Header{}, Expected: Expect("RFC 6585 §4", 200, 429)},
+			fields: []string{"status"},
+			want:   "got 400, expected 200 OK or 429 Too Many Requests (RFC 6585 §4)",
+		},
+		{
+			name:   "405 without Allow",
+			res:    Result{Status: 405, Header: http.Header{}},
+			fields: []string{"header"},
+			want:   "a 405 must list the allowed methods in Allow",
+		},
+		{
+			name: "405 with Allow",
+			res:  Result{Status: 405, Header: http.Header{"Allow": {"GET, HEAD"}}},
+		},
+		{
+			name:   "401 without WWW-Authenticate",
+			res:    Result{Status: 401, Header: http.Header{}},
+			fields: []string{"header"},
+			want:   "a 401 must carry a WWW-Authenticate challenge",
+		},
+		{
+			name: "401 with WWW-Authenticate",
+			res:  Result{Status: 401, Header: http.Header{"Www-Authenticate": {`Bearer realm="api"`}}},
+		},
+		{
+			name:   "201 without Location",
+			res:    Result{Status: 201, Header: jsonHeader, Body: `{"status":"OK"}`},
+			fields: []string{"header"},
+			want:   "a 201 should point at the new resource with Location",
+		},
+		{
+			name:   "JSON body with the wrong Content-Type",
+			res:    Result{Status: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: `{"message":"ok"}`},
+			fields: []string{"header"},
+			want:   `the body is JSON but Content-Type says "text/plain"`,
+		},
+		{
+			name:   "body without Content-Type",
+			res:    Result{Status: 200, Header: http.Header{}, Body: "hello"},
+			fields: []string{"header"},
+			want:   "the body has no Content-Type",
+		},
+		{
+			name:   "JSON Content-Type on a body that is not JSON",
+			res:    Result{Status: 200, Header: jsonHeader, Body: "hello"},
+			fields: []string{"body"},
+			want:   "Content-Type says application/json but the body is not a JSON object",
+		},
+		{
+			name:   "error status with status OK in the body",
+			res:    Result{Status: 500, Header: jsonHeader, Body: `{"status":"OK"}`},
+			fields: []string{"body"},
+			want:   `an error status with "status": "OK" in the body`,
+		},
+		{
+			name:   "success status with an error in the body",
+			res:    Result{Status: 200, Header: jsonHeader, Body: `{"error":"it broke"}`},
+			fields: []string{"body"},
+			want:   `a success status with an error in the body: "it broke"`,
+		},
+		{
+			name:   "everything at once",
+			res:    Result{Status: 777, Header: http.Header{"Content-Type": {"text/html"}}, Body: `{"status":"ok"}`, Expected: Expect("RFC 9110 §15.3.1", 200)},
+			fields: []string{"status", "status", "header", "body"},
+			want:   "777 is outside 100-599",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := Check(&tt.res)
+			var fields []string
+			for _, d := range found {
+				fields = append(fields, d.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Fatalf("discrepancies %+v, want fields %v", found, tt.fields)
+			}
+			if tt.want != "" && !strings.Contains(found[0].Message, tt.want) {
+				t.Errorf("message %q, want it to contain %q", found[0].Message, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ANSI escape sequences used when color is on
+const (
+	red    = "\033[31m"
+	green  = "\033[32m"
+	yellow = "\033[33m"
+	bold   = "\033[1m"
+	reset  = "\033[0m"
+)
+
+// columnWidth is the width of the "actual" column
+const columnWidth = 34
+
+// WriteText writes a result as the actual outcome side by side with the
+// expected one, then the headers, the body and the discrepancies
+func WriteText(w io.Writer, res *Result, color bool) {
+	paint := func(style, s string) string {
+		if !color {
+			return s
+		}
+		return style + s + reset
+	}
+
+	fmt.Fprintln(w, paint(bold, res.Method+" "+res.URL))
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-14s%-*s     %s\n", "", columnWidth, "ACTUAL", "EXPECTED PER RFC")
+
+	row := func(label, actual, expected string, ok bool) {
+		mark, style := "✓", green
+		if !ok {
+			mark, style = "✗", red
+		}
+		fmt.Fprintf(w, "%-14s%s  %s  %s\n", label, paint(style, pad(actual, columnWidth)), paint(style, mark), expected)
+	}
+
+	expected := res.Expected.Statuses
+	statusOK := len(expected) == 0 || slices.Contains(expected, res.Status)
+	wantStatus := "any registered status code"
+	if len(expected) > 0 {
+		wantStatus = StatusList(expected)
+		if res.Expected.Why != "" {
+			wantStatus += " (" + res.Expected.Why + ")"
+		}
+	}
+	row("status", strconv.Itoa(res.Status), wantStatus, statusOK && http.StatusText(res.Status) != "")
+
+	wantReason := http.StatusText(res.Status)
+	if !statusOK {
+		wantReason = http.StatusText(expected[0])
+	}
+	if wantReason == "" {
+		wantReason = "a registered reason phrase"
+	}
+	row("reason", orNone(res.Reason), wantReason, res.Reason == http.StatusText(res.Status) && wantReason == res.Reason)
+
+	if len(res.Body) > 0 {
+		contentType := res.Header.Get("Content-Type")
+		row("content-type", orNone(contentType), "a Content-Type matching the body", !hasField(res.Discrepancies, "header", "Content-Type"))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, paint(bold, "Headers"))
+	names := make([]string, 0, len(res.Header))
+	for name := range res.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range res.Header[name] {
+			fmt.Fprintf(w, "  %s: %s\n", name, value)
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, paint(bold, "Body"))
+	if len(res.Body) == 0 {
+		fmt.Fprintln(w, "  (empty)")
+	}
+	for _, line := range strings.Split(strings.TrimRight(prettyJSON(res.Body), "\n"), "\n") {
+		if line != "" {
+			fmt.Fprintln(w, "  "+line)
+		}
+	}
+
+	fmt.Fprintln(w)
+	if len(res.Discrepancies) == 0 {
+		fmt.Fprintln(w, paint(green, "✓ No discrepancies"))
+		return
+	}
+	noun := "discrepancies"
+	if len(res.Discrepancies) == 1 {
+		noun = "discrepancy"
+	}
+	fmt.Fprintln(w, paint(red+bold, fmt.Sprintf("✗ %d %s", len(res.Discrepancies), noun)))
+	for _, d := range res.Discrepancies {
+		fmt.Fprintf(w, "  %s %s\n", paint(yellow, pad(d.Field, 7)), d.Message)
+	}
+}
+
+// pad pads or truncates s to width runes
+func pad(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
+
+// orNone shows empty values
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// hasField reports whether a discrepancy of field mentions text
+func hasField(found []Discrepancy, field, text string) bool {
+	for _, d := range found {
+		if d.Field == field && strings.Contains(d.Message, text) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector is a metric family that can write itself in the Prometheus text format
+type Collector interface {
+	Write(w io.Writer)
+}
+
+// Registry holds the collectors exposed at /metrics
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates a new Registry instance
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds collectors to the registry
+func (reg *Registry) Register(collectors ...Collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.collectors = append(reg.collectors, collectors...)
+}
+
+// WriteText writes every registered metric in the Prometheus text format
+func (reg *Registry) WriteText(w io.Writer) {
+	reg.mu.Lock()
+	collectors := append([]Collector(nil), reg.collectors...)
+	reg.mu.Unlock()
+
+	for _, c := range collectors {
+		c.Write(w)
+	}
+}
+
+// Handler returns an http.HandlerFunc serving the registry
+func (reg *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.WriteText(w)
+	}
+}
+
+// labelSet renders label names and values as {a="x",b="y"}
+func labelSet(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", name, escape(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", extra[i], extra[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escape prepares a label value for %q, which handles quotes and backslashes
+// itself; only characters %q would turn into Go-specific escapes are replaced
+func escape(value string) string {
+	return strings.Map(func(r rune) rune {
+		if (r < ' ' && r != '\n') || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, value)
+}
+
+// formatFloat renders a sample value the way Prometheus expects
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// series is the label values of one member of a vector
+type series struct {
+	values []string
+}
+
+// sortedKeys returns map keys in a stable order for output
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a family of counters partitioned by labels
+type CounterVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+	series map[string]series
+}
+
+// NewCounterVec creates a new CounterVec instance
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+		series: make(map[string]series),
+	}
+}
+
+// Add adds delta to the counter with the given label values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.series[key]; !ok {
+		c.series[key] = series{values: append([]string(nil), values...)}
+	}
+	c.values[key] += delta
+}
+
+// Inc adds one to the counter with the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value returns the current value of the counter with the given label values
+func (c *CounterVec) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(values, "\xff")]
+}
+
+// Write writes the counter family in the Prometheus text format
+func (c *CounterVec) Write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelSet(c.labels, c.series[key].values), formatFloat(c.values[key]))
+	}
+}
+
+// DefaultBuckets are latency buckets in seconds, from 1ms to 10s
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a single labelled histogram
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	hists   map[string]*histogram
+	series  map[string]series
+}
+
+// NewHistogramVec creates a new HistogramVec instance
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		hists:   make(map[string]*histogram),
+		series:  make(map[string]series),
+	}
+}
+
+// Observe records a value in the histogram with the given label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := strings.Join(values, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.hists[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.hists[key] = hist
+		h.series[key] = series{values: append([]string(nil), values...)}
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.counts[i]++
+			break
+		}
+	}
+	hist.sum += v
+	hist.count++
+}
+
+// Count returns how many values were observed with the given label values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hist, ok := h.hists[strings.Join(values, "\xff")]; ok {
+		return hist.count
+	}
+	return 0
+}
+
+// Write writes the histogram family in the Prometheus text format
+func (h *HistogramVec) Write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		values := h.series[key].values
+		hist := h.hists[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(h.labels, values, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(h.labels, values, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelSet(h.labels, values), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelSet(h.labels, values), hist.count)
+	}
+}
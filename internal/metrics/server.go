@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The server's own metrics, all registered with Default
+var (
+	// Default is the registry served at /metrics
+	Default = NewRegistry()
+
+	// HTTPRequests counts requests by route, method and exact status code,
+	// non-standard ones included. "class" is the naive first-digit bucket most
+	// dashboards use, which is exactly where 777 and 888 get lost.
+	HTTPRequests = NewCounterVec("strange_http_requests_total",
+		"HTTP requests by route, method and status code.",
+		"route", "method", "code", "class")
+
+	// HTTPDuration observes request latency by route, method and status code
+	HTTPDuration = NewHistogramVec("strange_http_request_duration_seconds",
+		"HTTP request latency in seconds.", DefaultBuckets,
+		"route", "method", "code")
+
+	// GoatStages counts GOAT calls by the stage the GOAT answered with
+	GoatStages = NewCounterVec("strange_goat_stage_total",
+		"GOAT calls by stage.",
+		"stage")
+
+	// QuirkActivations counts responses changed by each quirk
+	QuirkActivations = NewCounterVec("strange_quirk_activations_total",
+		"Responses changed by a deliberate quirk.",
+		"quirk", "intended", "actual")
+
+	// DBQueryDuration observes database query latency by SQL operation
+	DBQueryDuration = NewHistogramVec("strange_db_query_duration_seconds",
+		"Database query latency in seconds.", DefaultBuckets,
+		"operation", "outcome")
+)
+
+func init() {
+	Default.Register(HTTPRequests, HTTPDuration, GoatStages, QuirkActivations, DBQueryDuration)
+}
+
+// standardMethods are the methods that keep their own label value for
+// unmatched routes; anything else is folded into OTHER to bound cardinality
+var standardMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+// StatusClass returns the naive "Nxx" class of a status code
+func StatusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// ObserveRequest records one finished HTTP request. route is the matched
+// routing table entry, e.g. "GOAT /api/health-check", or "" if none matched.
+func ObserveRequest(route, method string, code int, duration time.Duration) {
+	routeLabel := "unmatched"
+	if route != "" {
+		// The route carries the method it matched, custom ones included
+		method, routeLabel, _ = strings.Cut(route, " ")
+	} else if !standardMethods[method] {
+		method = "OTHER"
+	}
+	codeLabel := strconv.Itoa(code)
+	HTTPRequests.Inc(routeLabel, method, codeLabel, StatusClass(code))
+	HTTPDuration.Observe(duration.Seconds(), routeLabel, method, codeLabel)
+}
+
+// ObserveQuery records one database query
+func ObserveQuery(query string, duration time.Duration, err error) {
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	DBQueryDuration.Observe(duration.Seconds(), strings.ToLower(operation), outcome)
+}
+
+// Handler serves the default registry
+func Handler() http.HandlerFunc {
+	return Default.Handler()
+}
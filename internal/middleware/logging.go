@@ -1,11 +1,113 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+
+	"strange-errors-server/internal/quirks"
 )
 
+// NewLogger creates a structured logger writing to w. level is one of debug,
+// info, warn or error and format is text or json.
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(contextHandler{slog.NewTextHandler(w, opts)}), nil
+	case "json":
+		return slog.New(contextHandler{slog.NewJSONHandler(w, opts)}), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q (want text or json)", format)
+}
+
+// RequestInfo describes a request as it travels through the middleware chain.
+// Inner layers fill in what they learn so that the final log line has it all.
+type RequestInfo struct {
+	mu     sync.Mutex
+	ID     string
+	Client string // remote IP address
+	User   string // authenticated user name, if any
+	Tenant string // sandbox the request was served from, if any
+	Route  string // matched route, e.g. "DELETE /api/article/{id}"
+}
+
+type requestInfoKey struct{}
+
+// InfoFromContext returns the RequestInfo stored in ctx, if any
+func InfoFromContext(ctx context.Context) (*RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info, ok
+}
+
+// SetRoute records the route a request was matched to
+func SetRoute(ctx context.Context, route string) {
+	if info, ok := InfoFromContext(ctx); ok {
+		info.mu.Lock()
+		info.Route = route
+		info.mu.Unlock()
+	}
+}
+
+// MatchedRoute returns the route the request was matched to, or "" if none
+func (info *RequestInfo) MatchedRoute() string {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.Route
+}
+
+// SetUser records the user a request was authenticated as
+func SetUser(ctx context.Context, user string) {
+	if info, ok := InfoFromContext(ctx); ok {
+		info.mu.Lock()
+		info.User = user
+		info.mu.Unlock()
+	}
+}
+
+// SetTenant records the sandbox a request is served from
+func SetTenant(ctx context.Context, tenant string) {
+	if info, ok := InfoFromContext(ctx); ok {
+		info.mu.Lock()
+		info.Tenant = tenant
+		info.mu.Unlock()
+	}
+}
+
+// TenantID returns the sandbox the request was served from, or ""
+func (info *RequestInfo) TenantID() string {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.Tenant
+}
+
+// AuthenticatedUser returns the user the request was authenticated as, or ""
+func (info *RequestInfo) AuthenticatedUser() string {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.User
+}
+
+// clientIP returns the IP address part of the request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // LoggingResponseWriter wraps http.ResponseWriter to capture status code
 type LoggingResponseWriter struct {
 	http.ResponseWriter
@@ -26,18 +128,68 @@ func (lrw *LoggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-// LogRequest is a middleware that logs HTTP requests
+// Unwrap returns the wrapped ResponseWriter for http.ResponseController
+func (lrw *LoggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+// LogRequest is a middleware that logs HTTP requests. Every request gets one
+// line on completion telling which route it hit, which quirks were applied
+// and which status code it should have had.
 func LogRequest(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		log.Printf("🚀 %s %s - Started", r.Method, r.URL.Path)
-		
+
+		// Requests that did not pass AssignRequestID still get an ID to log under
+		ctx := r.Context()
+		id := RequestIDFromContext(ctx)
+		if id == "" {
+			id = newRequestID()
+			ctx = WithRequestID(ctx, id)
+		}
+
+		info := &RequestInfo{
+			ID:     id,
+			Client: clientIP(r),
+		}
+		ctx = context.WithValue(ctx, requestInfoKey{}, info)
+		ctx, rec := quirks.WithRecorder(ctx)
+		r = r.WithContext(ctx)
+
+		slog.DebugContext(ctx, "request started", "method", r.Method, "path", r.URL.Path, "client", info.Client)
+
 		// Create a custom ResponseWriter to capture status code
 		lrw := NewLoggingResponseWriter(w)
-		
+
 		handler(lrw, r)
-		
-		duration := time.Since(start)
-		log.Printf("✅ %s %s - %d - %v", r.Method, r.URL.Path, lrw.statusCode, duration)
+
+		applied := rec.Applied()
+		intended := lrw.statusCode
+		names := make([]string, 0, len(applied))
+		for _, q := range applied {
+			names = append(names, q.Name)
+			intended = q.Intended
+		}
+
+		info.mu.Lock()
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", info.Route,
+			"client", info.Client,
+			"user", info.User,
+			"tenant", info.Tenant,
+			"status", lrw.statusCode,
+			"intended_status", intended,
+			"quirks", strings.Join(names, ","),
+			"duration", time.Since(start),
+		}
+		info.mu.Unlock()
+
+		level := slog.LevelInfo
+		if lrw.statusCode >= 500 && len(applied) == 0 {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "request completed", attrs...)
 	}
 }
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"strange-errors-server/internal/metrics"
+	"strange-errors-server/internal/quirks"
+)
+
+// Instrument is a middleware that records request counts, latencies and
+// quirk activations. It relies on LogRequest further out for the matched
+// route and the applied quirks.
+func Instrument(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lrw := NewLoggingResponseWriter(w)
+
+		handler(lrw, r)
+
+		var route string
+		if info, ok := InfoFromContext(r.Context()); ok {
+			route = info.MatchedRoute()
+		}
+		metrics.ObserveRequest(route, r.Method, lrw.statusCode, time.Since(start))
+
+		if rec, ok := quirks.RecorderFromContext(r.Context()); ok {
+			for _, q := range rec.Applied() {
+				metrics.QuirkActivations.Inc(q.Name, strconv.Itoa(q.Intended), strconv.Itoa(q.Actual))
+			}
+		}
+	}
+}
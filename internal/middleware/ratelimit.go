@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+)
+
+// RejectMode selects how the rate limiter answers a throttled request
+type RejectMode string
+
+const (
+	// RejectHonest answers with 429 Too Many Requests and, when waiting helps, a Retry-After header
+	RejectHonest RejectMode = "honest"
+	// RejectDisguise pretends the server broke: 500 Internal Server Error
+	RejectDisguise RejectMode = "disguise"
+	// RejectOK answers 200 OK with an error hidden in the body
+	RejectOK RejectMode = "ok"
+	// RejectSlow silently waits for a token instead, and only rejects with
+	// 429 once a client would have to wait longer than maxSlowDown
+	RejectSlow RejectMode = "slow"
+)
+
+// maxSlowDown caps how long RejectSlow holds a request before serving it
+const maxSlowDown = 10 * time.Second
+
+// Limit describes a token bucket: Rate tokens per second, up to Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiterConfig configures a RateLimiter
+type RateLimiterConfig struct {
+	Default Limit
+	Routes  map[string]Limit // keyed by path prefix, longest prefix wins
+	KeyBy   string           // "ip" or "api-key", which keys authenticated callers by user
+	Mode    RejectMode
+}
+
+// bucket is a single token bucket. Tokens go negative when RejectSlow
+// reserves tokens that have not been refilled yet.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit // as of the last request, so that prune knows the refill rate
+}
+
+// RateLimiter is a token-bucket rate limiter keyed by client and route
+type RateLimiter struct {
+	mu       sync.Mutex
+	cfg      RateLimiterConfig
+	buckets  map[string]*bucket
+	now      func() time.Time
+	identify func(*http.Request) (string, bool)
+}
+
+// NewRateLimiter creates a new RateLimiter instance
+func NewRateLimiter(cfg RateLimiterConfig) *RateLimiter {
+	if cfg.Mode == "" {
+		cfg.Mode = RejectHonest
+	}
+	return &RateLimiter{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// SetIdentifier sets how callers are told apart when limits are keyed by
+// API key: identify returns who valid credentials belong to. Callers
+// without valid credentials, or all of them until this is set, are keyed
+// by IP, so that made-up keys get nobody a fresh bucket.
+func (rl *RateLimiter) SetIdentifier(identify func(*http.Request) (string, bool)) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.identify = identify
+}
+
+// ParseRejectMode validates a reject mode name
+func ParseRejectMode(s string) (RejectMode, error) {
+	switch mode := RejectMode(strings.ToLower(s)); mode {
+	case RejectHonest, RejectDisguise, RejectOK, RejectSlow:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown rate limit mode %q (want honest, disguise, ok or slow)", s)
+}
+
+// ParseRouteLimits parses per-route limits in the form "/api/article=1:2,/api/user=0.5"
+// where each value is rate[:burst]. A missing burst defaults to 1.
+func ParseRouteLimits(s string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, spec, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid route limit %q (want /path=rate[:burst])", entry)
+		}
+		rateStr, burstStr, hasBurst := strings.Cut(spec, ":")
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate in route limit %q", entry)
+		}
+		burst := 1
+		if hasBurst {
+			burst, err = strconv.Atoi(burstStr)
+			if err != nil || burst < 1 {
+				return nil, fmt.Errorf("invalid burst in route limit %q", entry)
+			}
+		}
+		limits[path] = Limit{Rate: rate, Burst: burst}
+	}
+	return limits, nil
+}
+
+// Reconfigure replaces the limits, key and mode while the server is running.
+// Clients keep their buckets, so a lowered burst applies on the next request
+// and nobody gets a fresh allowance out of a reload.
+func (rl *RateLimiter) Reconfigure(cfg RateLimiterConfig) {
+	if cfg.Mode == "" {
+		cfg.Mode = RejectHonest
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.cfg = cfg
+}
+
+// config returns the current configuration and identifier
+func (rl *RateLimiter) config() (RateLimiterConfig, func(*http.Request) (string, bool)) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.cfg, rl.identify
+}
+
+// limitFor returns the limit that applies to a path and the route key it is tracked under
+func (cfg RateLimiterConfig) limitFor(path string) (string, Limit) {
+	route, limit := "*", cfg.Default
+	for prefix, l := range cfg.Routes {
+		if strings.HasPrefix(path, prefix) && (route == "*" || len(prefix) > len(route)) {
+			route, limit = prefix, l
+		}
+	}
+	return route, limit
+}
+
+// clientKey identifies the caller by authenticated user or by IP address
+func (cfg RateLimiterConfig) clientKey(r *http.Request, identify func(*http.Request) (string, bool)) string {
+	if cfg.KeyBy == "api-key" && identify != nil {
+		if user, ok := identify(r); ok {
+			return "user:" + user
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// take removes one token from the bucket, returning how long to wait if none
+// is left, or 0 if the bucket never refills. With reserve, a client without
+// a token takes the next one to be refilled, as long as that comes within
+// maxSlowDown, and has to wait for it: ok is true and wait says how long.
+func (rl *RateLimiter) take(key string, limit Limit, reserve bool) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		if len(rl.buckets) > 10000 {
+			rl.prune(now)
+		}
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	b.limit = limit
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if limit.Rate <= 0 {
+		return false, 0
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	if reserve && wait <= maxSlowDown {
+		b.tokens--
+		return true, wait
+	}
+	return false, wait
+}
+
+// refund gives back a reserved token the client did not wait for
+func (rl *RateLimiter) refund(key string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if b, ok := rl.buckets[key]; ok {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+1)
+	}
+}
+
+// prune drops buckets that have refilled completely, which are no different
+// from new ones. Buckets that never refill, such as those of a route with
+// rate 0, are kept so that nobody gets a fresh allowance. Caller must hold
+// rl.mu.
+func (rl *RateLimiter) prune(now time.Time) {
+	for key, b := range rl.buckets {
+		if b.limit.Rate > 0 && b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Middleware wraps a handler with the rate limiter
+func (rl *RateLimiter) Middleware(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg, identify := rl.config()
+		route, limit := cfg.limitFor(r.URL.Path)
+		if limit.Rate == 0 && limit.Burst == 0 {
+			handler(w, r)
+			return
+		}
+
+		key := route + "|" + cfg.clientKey(r, identify)
+		ok, wait := rl.take(key, limit, cfg.Mode == RejectSlow)
+		switch {
+		case ok && wait == 0:
+			handler(w, r)
+		case ok:
+			rl.slowDown(w, r, handler, key, wait)
+		default:
+			rl.reject(w, r, cfg.Mode, wait)
+		}
+	}
+}
+
+// slowDown serves a request once the token reserved for it is due
+func (rl *RateLimiter) slowDown(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc, key string, wait time.Duration) {
+	// Silent slow-down - the client only notices that everything got sluggish
+	quirks.Note(r.Context(), "rate-limit.slow", http.StatusTooManyRequests, http.StatusOK)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		handler(w, r)
+	case <-r.Context().Done():
+		rl.refund(key)
+	}
+}
+
+// reject answers a throttled request according to the configured mode.
+// RejectSlow gets here when even waiting would take too long and answers
+// honestly. Retry-After is left out when waiting will not help.
+func (rl *RateLimiter) reject(w http.ResponseWriter, r *http.Request, mode RejectMode, wait time.Duration) {
+	switch mode {
+	case RejectDisguise:
+		// Wrong status code - should be 429, but we pretend the server is broken
+		quirks.Note(r.Context(), "rate-limit.disguise", http.StatusTooManyRequests, 500)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Error:     "Internal Server Error",
+			Status:    "INTERNAL_ERROR",
+			RequestID: RequestIDFromContext(r.Context()),
+		})
+	case RejectOK:
+		// Wrong status code - should be 429, but everything is "fine"
+		quirks.Note(r.Context(), "rate-limit.ok", http.StatusTooManyRequests, 200)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Error:     "Too many requests. Please slow down.",
+			Status:    "RATE_LIMITED",
+			RequestID: RequestIDFromContext(r.Context()),
+		})
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		if wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Error:     "Too many requests. Please slow down.",
+			Status:    "RATE_LIMITED",
+			RequestID: RequestIDFromContext(r.Context()),
+		})
+	}
+}
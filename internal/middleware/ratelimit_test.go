@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a rate limiter on a clock the test moves
+func newTestLimiter(cfg RateLimiterConfig) (*RateLimiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	rl := NewRateLimiter(cfg)
+	rl.now = func() time.Time { return now }
+	return rl, &now
+}
+
+func TestSlowModeReservesTokens(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 1}
+	rl, _ := newTestLimiter(RateLimiterConfig{Default: limit, Mode: RejectSlow})
+
+	if ok, wait := rl.take("c", limit, true); !ok || wait != 0 {
+		t.Fatalf("first request: %v, %v; want served at once", ok, wait)
+	}
+	// A burst queues up behind each other instead of all waiting one second
+	for i := 1; i <= 10; i++ {
+		ok, wait := rl.take("c", limit, true)
+		if !ok || wait != time.Duration(i)*time.Second {
+			t.Fatalf("queued request %d: %v, %v; want a reserved token in %ds", i, ok, wait, i)
+		}
+	}
+	if ok, _ := rl.take("c", limit, true); ok {
+		t.Error("a request that would wait beyond maxSlowDown got a token")
+	}
+
+	rl.refund("c")
+	if ok, wait := rl.take("c", limit, true); !ok || wait != 10*time.Second {
+		t.Errorf("after a refund: %v, %v; want the refunded token in 10s", ok, wait)
+	}
+}
+
+func TestPruneKeepsBucketsThatNeverRefill(t *testing.T) {
+	fixed, refilling := Limit{Rate: 0, Burst: 1}, Limit{Rate: 1, Burst: 1}
+	rl, now := newTestLimiter(RateLimiterConfig{})
+	rl.take("fixed", fixed, false)
+	rl.take("refilling", refilling, false)
+
+	*now = now.Add(time.Hour)
+	rl.mu.Lock()
+	rl.prune(*now)
+	_, kept := rl.buckets["fixed"]
+	_, refilled := rl.buckets["refilling"]
+	rl.mu.Unlock()
+	if !kept || refilled {
+		t.Errorf("after prune: fixed kept %v, refilling kept %v; want only the fixed one", kept, refilled)
+	}
+	if ok, _ := rl.take("fixed", fixed, false); ok {
+		t.Error("a rate 0 route handed out a fresh allowance")
+	}
+}
+
+func TestAPIKeyLimitsFollowTheUser(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 1}
+	rl, _ := newTestLimiter(RateLimiterConfig{Default: limit, KeyBy: "api-key"})
+	rl.SetIdentifier(func(r *http.Request) (string, bool) {
+		key := r.Header.Get("X-API-Key")
+		return "ana", key == "valid-1" || key == "valid-2"
+	})
+	handler := rl.Middleware(func(w http.ResponseWriter, r *http.Request) {})
+	do := func(key, addr string) int {
+		req := httptest.NewRequest("GET", "/api/articles", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	// Made-up keys fall back to the address
+	if code := do("made-up-1", "192.0.2.1:1234"); code != 200 {
+		t.Fatalf("first request: status %d, want 200", code)
+	}
+	if code := do("made-up-2", "192.0.2.1:1234"); code != 429 {
+		t.Errorf("a fresh made-up key: status %d, want 429", code)
+	}
+
+	// The same user is one caller whichever key or address it uses
+	if code := do("valid-1", "192.0.2.1:1234"); code != 200 {
+		t.Errorf("a valid key: status %d, want a bucket of its own", code)
+	}
+	if code := do("valid-2", "192.0.2.2:1234"); code != 429 {
+		t.Errorf("the same user with another key: status %d, want 429", code)
+	}
+}
+
+func TestRateZeroRouteHasNoRetryAfter(t *testing.T) {
+	rl, _ := newTestLimiter(RateLimiterConfig{Default: Limit{Rate: 0, Burst: 1}, Mode: RejectHonest})
+	handler := rl.Middleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/articles", nil))
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/api/articles", nil))
+	if rec.Code != 429 {
+		t.Fatalf("status %d, want 429", rec.Code)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "" {
+		t.Errorf("Retry-After %q for a route that never refills", retry)
+	}
+}
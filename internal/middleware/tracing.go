@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"strange-errors-server/internal/tracing"
+)
+
+// Trace is a middleware that opens a server span for every request. A W3C
+// traceparent header makes the span a child of the caller's trace. The
+// router renames the span after the route once it has matched one.
+func Trace(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !tracing.Enabled() {
+			handler(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if header := r.Header.Get(tracing.TraceparentHeader); header != "" {
+			if remote, err := tracing.ParseTraceparent(header); err == nil {
+				ctx = tracing.ContextWithRemote(ctx, remote)
+			} else {
+				slog.DebugContext(ctx, "ignoring invalid traceparent", "error", err)
+			}
+		}
+
+		ctx, span := tracing.Start(ctx, "HTTP "+r.Method, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("client.address", clientIP(r)),
+			tracing.String("request.id", RequestIDFromContext(ctx)),
+		)
+		defer span.Finish()
+
+		lrw := NewLoggingResponseWriter(w)
+		handler(lrw, r.WithContext(ctx))
+
+		span.SetAttributes(tracing.Int("http.response.status_code", lrw.statusCode))
+		if lrw.statusCode >= 500 {
+			span.SetStatus(tracing.StatusError, strconv.Itoa(lrw.statusCode))
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package mock serves example responses for every operation of an OpenAPI
+// document, distorted by the quirk engine.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/openapi"
+	"strange-errors-server/internal/quirks"
+)
+
+// statusQuirks maps documented status codes to the quirk that distorts them
+var statusQuirks = map[int]string{
+	200: "mock.ok",
+	201: "mock.created",
+	400: "mock.bad-request",
+	404: "mock.not-found",
+	500: "mock.server-error",
+}
+
+// route is an operation with its path split into segments
+type route struct {
+	segments []string
+	params   int
+	op       openapi.Operation
+}
+
+// Mock answers requests with the examples of a document
+type Mock struct {
+	doc     *openapi.Document
+	routes  []route
+	profile atomic.Pointer[quirks.Profile]
+}
+
+// New creates a new Mock instance serving doc with the given quirk profile
+func New(doc *openapi.Document, profile *quirks.Profile) *Mock {
+	if profile == nil {
+		profile = quirks.Strange
+	}
+	m := &Mock{doc: doc}
+	m.profile.Store(profile)
+	for _, op := range doc.Operations {
+		segments := strings.Split(strings.Trim(doc.BasePath+op.Path, "/"), "/")
+		params := 0
+		for _, seg := range segments {
+			if strings.HasPrefix(seg, "{") {
+				params++
+			}
+		}
+		m.routes = append(m.routes, route{segments: segments, params: params, op: op})
+	}
+	// Literal paths win over templated ones, e.g. /users/me over /users/{id}
+	sort.SliceStable(m.routes, func(i, j int) bool { return m.routes[i].params < m.routes[j].params })
+	return m
+}
+
+// Len returns the number of mocked operations
+func (m *Mock) Len() int {
+	return len(m.routes)
+}
+
+// Middleware answers requests for documented operations, except for paths
+// starting with one of skip. Everything else goes on to handler.
+func (m *Mock) Middleware(skip ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range skip {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					handler(w, r)
+					return
+				}
+			}
+			op, ok := m.match(r)
+			if !ok {
+				handler(w, r)
+				return
+			}
+			m.serve(w, r, op)
+		}
+	}
+}
+
+// match finds the operation for a request
+func (m *Mock) match(r *http.Request) (openapi.Operation, bool) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for _, rt := range m.routes {
+		if rt.op.Method == r.Method && matchSegments(rt.segments, path) {
+			return rt.op, true
+		}
+	}
+	return openapi.Operation{}, false
+}
+
+// matchSegments matches a path against template segments like "{id}"
+func matchSegments(template, path []string) bool {
+	if len(template) != len(path) {
+		return false
+	}
+	for i, seg := range template {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if path[i] == "" {
+				return false
+			}
+			continue
+		}
+		if seg != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SetProfile changes the quirk profile while the server is running
+func (m *Mock) SetProfile(profile *quirks.Profile) {
+	m.profile.Store(profile)
+}
+
+// serve writes the example response of an operation
+func (m *Mock) serve(w http.ResponseWriter, r *http.Request, op openapi.Operation) {
+	ctx := quirks.WithProfile(r.Context(), m.profile.Load())
+	middleware.SetRoute(ctx, op.Method+" "+m.doc.BasePath+op.Path)
+
+	resp, ok := chooseResponse(op, r.Header.Get("Prefer"))
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	documented := resp.Code()
+	if documented == 0 {
+		documented = 200
+	}
+	status := documented
+	if name, ok := statusQuirks[documented]; ok {
+		status = quirks.Apply(ctx, name)
+	}
+
+	body, hasBody := m.doc.Example(resp)
+	// An error passed off as success says so in the body too. The example
+	// belongs to the document, so the copy is changed.
+	if object, ok := body.(map[string]any); ok && documented >= 400 && status < 400 {
+		object = clone(object).(map[string]any)
+		object["status"] = "OK"
+		body = object
+	}
+
+	contentType := resp.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	if !hasBody {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if text, ok := body.(string); ok && !strings.Contains(contentType, "json") {
+		fmt.Fprint(w, text)
+		return
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+// clone deep-copies a value decoded from JSON
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for k, item := range v {
+			copied[k] = clone(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, item := range v {
+			copied[i] = clone(item)
+		}
+		return copied
+	}
+	return v
+}
+
+// chooseResponse picks the response asked for with "Prefer: code=404", or
+// else the first documented success, or else the first response that is not
+// an error (documents of strange APIs list successes like 777), or else the
+// first documented response
+func chooseResponse(op openapi.Operation, prefer string) (openapi.Response, bool) {
+	if len(op.Responses) == 0 {
+		return openapi.Response{}, false
+	}
+	for _, pref := range strings.Split(prefer, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+		if key != "code" {
+			continue
+		}
+		if code, err := strconv.Atoi(value); err == nil {
+			for _, resp := range op.Responses {
+				if resp.Code() == code {
+					return resp, true
+				}
+			}
+		}
+	}
+	for _, resp := range op.Responses {
+		if code := resp.Code(); code >= 200 && code < 300 {
+			return resp, true
+		}
+	}
+	for _, resp := range op.Responses {
+		if code := resp.Code(); code > 0 && (code < 400 || code > 599) {
+			return resp, true
+		}
+	}
+	return op.Responses[0], true
+}
@@ -0,0 +1,57 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"strange-errors-server/internal/openapi"
+	"strange-errors-server/internal/quirks"
+)
+
+// newTestMock mocks a document whose only operation fails with 500
+func newTestMock(t *testing.T) *Mock {
+	t.Helper()
+	doc, err := openapi.Parse([]byte(`{
+		"openapi": "3.0.0",
+		"info": {"title": "t", "version": "1"},
+		"paths": {"/things": {"get": {"responses": {"500": {
+			"description": "crash",
+			"content": {"application/json": {"example": {"status": "ERROR", "details": {"code": 1}}}}
+		}}}}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(doc, quirks.Strange)
+}
+
+// get requests /things from the mock
+func get(m *Mock) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	m.Middleware()(http.NotFound)(rec, httptest.NewRequest("GET", "/things", nil))
+	return rec
+}
+
+func TestDisguisedErrorLeavesTheExampleAlone(t *testing.T) {
+	m := newTestMock(t)
+	if rec := get(m); rec.Code != 200 || !strings.Contains(rec.Body.String(), `"status":"OK"`) {
+		t.Fatalf("strange: %d %s, want 200 with status OK", rec.Code, rec.Body)
+	}
+
+	m.SetProfile(quirks.Honest)
+	if rec := get(m); rec.Code != 500 || !strings.Contains(rec.Body.String(), `"status":"ERROR"`) {
+		t.Errorf("honest after strange: %d %s, want the documented example", rec.Code, rec.Body)
+	}
+}
+
+func TestConcurrentDisguisedErrors(t *testing.T) {
+	m := newTestMock(t)
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() { get(m) })
+	}
+	wg.Wait()
+}
@@ -5,6 +5,7 @@ type Article struct {
 	ID      int    `json:"id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	OwnerID int    `json:"owner_id,omitempty"`
 }
 
 // CreateArticleRequest represents the request body for creating a new article
@@ -15,21 +16,46 @@ type CreateArticleRequest struct {
 
 // GoatResponse represents the response from the GOAT method
 type GoatResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"` // set once the GOAT is no longer happy
 }
 
+// User roles, from least to most privileged
+const (
+	RoleReader = "reader"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
 // User represents a user in the system
 type User struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	APIKey string `json:"api_key,omitempty"` // only returned once, when the user is created
 }
 
 // CreateUserRequest represents the request body for creating a new user
 type CreateUserRequest struct {
-	Name  string `json:"name" binding:"required"`
-	Email string `json:"email" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role,omitempty" enums:"reader,editor,admin"` // anything but reader requires an admin
+}
+
+// LoginRequest represents the request body for logging in
+type LoginRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginResponse represents a successfully issued bearer token
+type LoginResponse struct {
+	Token     string `json:"token"`
+	TokenType string `json:"token_type"`
+	ExpiresAt string `json:"expires_at"`
 }
 
 // APIResponse represents a generic API response
@@ -38,4 +64,5 @@ type APIResponse struct {
 	Data    []Article  `json:"data,omitempty"`
 	Status  string     `json:"status,omitempty"`
 	Error   string     `json:"error,omitempty"`
+	RequestID string   `json:"request_id,omitempty"` // set on errors, matches X-Request-ID
 }
@@ -0,0 +1,448 @@
+// Package openapi reads Swagger 2.0 and OpenAPI 3.x documents, in JSON or
+// YAML, into a flat list of operations.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// methods are the operation keys of a path item
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Document is the part of an API description the server works with
+type Document struct {
+	Version    string // "2.0" or the OpenAPI 3 version
+	Title      string
+	BasePath   string // prefix of every path, "" for none
+	Operations []Operation
+	schemas    map[string]*Schema // by $ref, for resolving
+}
+
+// Operation is one method on one path
+type Operation struct {
+	Method             string // upper case, e.g. "GET"
+	Path               string // template relative to BasePath, e.g. "/api/article/{id}"
+	OperationID        string
+	Summary            string
+	Tags               []string
+	Parameters         []Parameter // path, query and header parameters
+	RequestBody        *Schema     // nil when the operation takes no body
+	RequestContentType string
+	Responses          []Response // numeric codes in ascending order, then "default"
+}
+
+// Parameter is a path, query or header parameter of an operation
+type Parameter struct {
+	Name     string
+	In       string // "path", "query" or "header"
+	Required bool
+	Schema   *Schema
+}
+
+// Response returns the documented response for a status code: an exact
+// match, else a range like "4XX", else "default"
+func (op Operation) Response(status int) (Response, bool) {
+	rangeKey := strconv.Itoa(status/100) + "XX"
+	var ranged, fallback *Response
+	for i, resp := range op.Responses {
+		switch {
+		case resp.Code() == status:
+			return resp, true
+		case strings.EqualFold(resp.Status, rangeKey):
+			ranged = &op.Responses[i]
+		case resp.Status == "default":
+			fallback = &op.Responses[i]
+		}
+	}
+	if ranged != nil {
+		return *ranged, true
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return Response{}, false
+}
+
+// Response is one documented response of an operation
+type Response struct {
+	Status      string // e.g. "200" or "default"
+	Description string
+	ContentType string
+	Schema      *Schema
+	Example     any
+	HasExample  bool
+}
+
+// Code returns the numeric status code, or 0 for "default" and ranges like "2XX"
+func (r Response) Code() int {
+	code, _ := strconv.Atoi(r.Status)
+	return code
+}
+
+// Schema is a JSON Schema as used by both document versions
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Example              any                `json:"example,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties,omitempty"`
+}
+
+// Types accepts both "type": "string" and the 3.1 form "type": ["string", "null"]
+type Types []string
+
+// UnmarshalJSON decodes a single type name or a list of them
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// MarshalJSON encodes a single type as a plain string
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Is reports whether the schema allows the JSON type name
+func (t Types) Is(name string) bool {
+	for _, typ := range t {
+		if typ == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Primary returns the first non-null type, or "" if none is given
+func (t Types) Primary() string {
+	for _, typ := range t {
+		if typ != "null" {
+			return typ
+		}
+	}
+	return ""
+}
+
+// rawDocument covers both document versions
+type rawDocument struct {
+	Swagger  string `json:"swagger"`
+	OpenAPI  string `json:"openapi"`
+	BasePath string `json:"basePath"`
+	Info     struct {
+		Title string `json:"title"`
+	} `json:"info"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Consumes    []string                              `json:"consumes"`
+	Produces    []string                              `json:"produces"`
+	Paths       map[string]map[string]json.RawMessage `json:"paths"`
+	Definitions map[string]*Schema                    `json:"definitions"`
+	Components  struct {
+		Schemas   map[string]*Schema     `json:"schemas"`
+		Responses map[string]rawResponse `json:"responses"`
+	} `json:"components"`
+	Responses map[string]rawResponse `json:"responses"` // Swagger 2 shared responses
+}
+
+type rawOperation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Tags        []string               `json:"tags"`
+	Consumes    []string               `json:"consumes"`
+	Produces    []string               `json:"produces"`
+	Parameters  []rawParameter         `json:"parameters"`
+	RequestBody *rawRequestBody        `json:"requestBody"`
+	Responses   map[string]rawResponse `json:"responses"`
+}
+
+type rawParameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+	Type     string  `json:"type"`   // Swagger 2 non-body parameters
+	Format   string  `json:"format"` // Swagger 2 non-body parameters
+}
+
+type rawRequestBody struct {
+	Required bool                `json:"required"`
+	Content  map[string]rawMedia `json:"content"`
+}
+
+type rawResponse struct {
+	Ref         string              `json:"$ref"`
+	Description string              `json:"description"`
+	Schema      *Schema             `json:"schema"`   // Swagger 2
+	Examples    map[string]any      `json:"examples"` // Swagger 2, keyed by media type
+	Content     map[string]rawMedia `json:"content"`  // OpenAPI 3
+}
+
+type rawMedia struct {
+	Schema   *Schema `json:"schema"`
+	Example  any     `json:"example"`
+	Examples map[string]struct {
+		Value any `json:"value"`
+	} `json:"examples"`
+}
+
+// Load reads a document from a JSON or YAML file
+func Load(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// Parse reads a document in JSON or YAML
+func Parse(data []byte) (*Document, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	var raw rawDocument
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	doc := &Document{
+		Title:   raw.Info.Title,
+		schemas: make(map[string]*Schema),
+	}
+	switch {
+	case strings.HasPrefix(raw.Swagger, "2."):
+		doc.Version = raw.Swagger
+		doc.BasePath = strings.TrimSuffix(raw.BasePath, "/")
+		for name, schema := range raw.Definitions {
+			doc.schemas["#/definitions/"+name] = schema
+		}
+	case strings.HasPrefix(raw.OpenAPI, "3."):
+		doc.Version = raw.OpenAPI
+		if len(raw.Servers) > 0 {
+			doc.BasePath = serverPath(raw.Servers[0].URL)
+		}
+		for name, schema := range raw.Components.Schemas {
+			doc.schemas["#/components/schemas/"+name] = schema
+		}
+	default:
+		return nil, fmt.Errorf("unsupported document: want swagger 2.x or openapi 3.x")
+	}
+
+	sharedResponses := raw.Responses
+	sharedPrefix := "#/responses/"
+	if doc.Version[0] == '3' {
+		sharedResponses = raw.Components.Responses
+		sharedPrefix = "#/components/responses/"
+	}
+
+	for path, item := range raw.Paths {
+		var shared []rawParameter
+		if data, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(data, &shared); err != nil {
+				return nil, fmt.Errorf("invalid parameters of %s: %w", path, err)
+			}
+		}
+		for _, method := range methods {
+			data, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op rawOperation
+			if err := json.Unmarshal(data, &op); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %w", strings.ToUpper(method), path, err)
+			}
+			produces := op.Produces
+			if len(produces) == 0 {
+				produces = raw.Produces
+			}
+
+			operation := Operation{
+				Method:      strings.ToUpper(method),
+				Path:        path,
+				OperationID: op.OperationID,
+				Summary:     op.Summary,
+				Tags:        op.Tags,
+			}
+			consumes := op.Consumes
+			if len(consumes) == 0 {
+				consumes = raw.Consumes
+			}
+			operation.addParameters(append(append([]rawParameter(nil), shared...), op.Parameters...), consumes)
+			if op.RequestBody != nil {
+				operation.addRequestBody(op.RequestBody)
+			}
+			for status, resp := range op.Responses {
+				if resp.Ref != "" {
+					resp = sharedResponses[strings.TrimPrefix(resp.Ref, sharedPrefix)]
+				}
+				operation.Responses = append(operation.Responses, newResponse(status, resp, produces))
+			}
+			sort.Slice(operation.Responses, func(i, j int) bool {
+				return responseOrder(operation.Responses[i]) < responseOrder(operation.Responses[j])
+			})
+			doc.Operations = append(doc.Operations, operation)
+		}
+	}
+	sort.Slice(doc.Operations, func(i, j int) bool {
+		a, b := doc.Operations[i], doc.Operations[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Method < b.Method
+	})
+	return doc, nil
+}
+
+// addParameters adds parameters of either version; operation parameters
+// come after path-level ones and replace them
+func (op *Operation) addParameters(params []rawParameter, consumes []string) {
+	for _, param := range params {
+		if param.In == "body" {
+			// Swagger 2 request body
+			op.RequestBody = param.Schema
+			op.RequestContentType = "application/json"
+			if len(consumes) > 0 {
+				op.RequestContentType = consumes[0]
+			}
+			continue
+		}
+		schema := param.Schema
+		if schema == nil {
+			schema = &Schema{Type: Types{param.Type}, Format: param.Format}
+		}
+		parameter := Parameter{Name: param.Name, In: param.In, Required: param.Required || param.In == "path", Schema: schema}
+		replaced := false
+		for i, existing := range op.Parameters {
+			if existing.Name == param.Name && existing.In == param.In {
+				op.Parameters[i], replaced = parameter, true
+			}
+		}
+		if !replaced {
+			op.Parameters = append(op.Parameters, parameter)
+		}
+	}
+}
+
+// addRequestBody adds an OpenAPI 3 request body, preferring JSON
+func (op *Operation) addRequestBody(body *rawRequestBody) {
+	for contentType, media := range body.Content {
+		if op.RequestBody == nil || strings.Contains(contentType, "json") {
+			schema := media.Schema
+			if schema == nil {
+				schema = &Schema{}
+			}
+			op.RequestBody, op.RequestContentType = schema, contentType
+		}
+	}
+}
+
+// newResponse flattens a raw response of either version
+func newResponse(status string, raw rawResponse, produces []string) Response {
+	resp := Response{Status: status, Description: raw.Description, Schema: raw.Schema}
+
+	// Swagger 2: one schema, examples keyed by media type
+	if len(raw.Content) == 0 {
+		if len(produces) > 0 {
+			resp.ContentType = produces[0]
+		}
+		if example, ok := raw.Examples[resp.ContentType]; ok {
+			resp.Example, resp.HasExample = example, true
+		} else {
+			for contentType, example := range raw.Examples {
+				resp.ContentType, resp.Example, resp.HasExample = contentType, example, true
+				break
+			}
+		}
+		return resp
+	}
+
+	// OpenAPI 3: prefer JSON among the media types
+	contentTypes := make([]string, 0, len(raw.Content))
+	for contentType := range raw.Content {
+		contentTypes = append(contentTypes, contentType)
+	}
+	sort.Slice(contentTypes, func(i, j int) bool {
+		return strings.Contains(contentTypes[i], "json") && !strings.Contains(contentTypes[j], "json")
+	})
+	resp.ContentType = contentTypes[0]
+	media := raw.Content[resp.ContentType]
+	resp.Schema = media.Schema
+	if media.Example != nil {
+		resp.Example, resp.HasExample = media.Example, true
+	} else {
+		names := make([]string, 0, len(media.Examples))
+		for name := range media.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) > 0 {
+			resp.Example, resp.HasExample = media.Examples[names[0]].Value, true
+		}
+	}
+	return resp
+}
+
+// responseOrder sorts numeric codes first, ranges like "4XX" next and "default" last
+func responseOrder(r Response) int {
+	if code := r.Code(); code > 0 {
+		return code
+	}
+	if len(r.Status) == 3 && strings.HasSuffix(strings.ToUpper(r.Status), "XX") {
+		return (int(r.Status[0]-'0'))*100 + 1000
+	}
+	return 10000
+}
+
+// serverPath returns the path part of an OpenAPI 3 server URL
+func serverPath(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+		if j := strings.Index(url, "/"); j >= 0 {
+			url = url[j:]
+		} else {
+			url = ""
+		}
+	}
+	return strings.TrimSuffix(url, "/")
+}
+
+// Resolve follows $ref until it reaches a schema that is not a reference.
+// Unknown references resolve to nil.
+func (d *Document) Resolve(schema *Schema) *Schema {
+	for depth := 0; schema != nil && schema.Ref != "" && depth < 32; depth++ {
+		schema = d.schemas[schema.Ref]
+	}
+	return schema
+}
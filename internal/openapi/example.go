@@ -0,0 +1,92 @@
+package openapi
+
+// maxExampleDepth stops example generation for recursive schemas
+const maxExampleDepth = 8
+
+// Example returns the example body for a response: the documented example if
+// there is one, otherwise one generated from the schema. It returns false
+// when the response has no body.
+func (d *Document) Example(resp Response) (any, bool) {
+	if resp.HasExample {
+		return resp.Example, true
+	}
+	if resp.Schema == nil {
+		return nil, false
+	}
+	return d.generate(resp.Schema, 0), true
+}
+
+// ExampleOf returns a value that satisfies schema, e.g. for a request body
+func (d *Document) ExampleOf(schema *Schema) any {
+	return d.generate(schema, 0)
+}
+
+// generate builds a value that satisfies schema
+func (d *Document) generate(schema *Schema, depth int) any {
+	schema = d.Resolve(schema)
+	if schema == nil || depth > maxExampleDepth {
+		return nil
+	}
+	switch {
+	case schema.Example != nil:
+		return schema.Example
+	case schema.Default != nil:
+		return schema.Default
+	case len(schema.Enum) > 0:
+		return schema.Enum[0]
+	case len(schema.AllOf) > 0:
+		merged := map[string]any{}
+		for _, part := range schema.AllOf {
+			if object, ok := d.generate(part, depth+1).(map[string]any); ok {
+				for k, v := range object {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	case len(schema.OneOf) > 0:
+		return d.generate(schema.OneOf[0], depth+1)
+	case len(schema.AnyOf) > 0:
+		return d.generate(schema.AnyOf[0], depth+1)
+	}
+
+	switch schema.Type.Primary() {
+	case "string":
+		return exampleString(schema.Format)
+	case "integer":
+		return 1
+	case "number":
+		return 1.5
+	case "boolean":
+		return true
+	case "array":
+		if schema.Items == nil {
+			return []any{}
+		}
+		return []any{d.generate(schema.Items, depth+1)}
+	case "object", "":
+		object := map[string]any{}
+		for name, property := range schema.Properties {
+			object[name] = d.generate(property, depth+1)
+		}
+		return object
+	}
+	return nil
+}
+
+// exampleString returns a plausible string for a format
+func exampleString(format string) string {
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "email":
+		return "user@example.com"
+	case "uuid":
+		return "00000000-0000-4000-8000-000000000000"
+	case "uri", "url":
+		return "https://example.com"
+	}
+	return "string"
+}
@@ -0,0 +1,110 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Components collects the named schemas of a generated document
+type Components map[string]*Schema
+
+// SchemaOf returns the schema of a Go value's type as encoding/json would
+// encode it. Named struct types are added to c and referenced by name.
+func (c Components) SchemaOf(v any) *Schema {
+	return c.schemaOf(reflect.TypeOf(v))
+}
+
+func (c Components) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return &Schema{Type: Types{"integer"}, Format: "int64"}
+	case reflect.TypeOf(http.Header{}):
+		return &Schema{Type: Types{"object"}, AdditionalProperties: []byte(`{"type":"array","items":{"type":"string"}}`)}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}, Format: "byte"}
+		}
+		return &Schema{Type: Types{"array"}, Items: c.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: Types{"object"}}
+	case reflect.Struct:
+		return c.structSchema(t)
+	}
+	// interface{} and anything else: any JSON value
+	return &Schema{}
+}
+
+// structSchema registers a named struct and returns a reference to it
+func (c Components) structSchema(t reflect.Type) *Schema {
+	name := t.Name()
+	if name == "" {
+		return c.buildStruct(t)
+	}
+	if _, ok := c[name]; !ok {
+		c[name] = &Schema{} // placeholder for recursive types
+		c[name] = c.buildStruct(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// buildStruct describes the JSON fields of a struct
+func (c Components) buildStruct(t reflect.Type) *Schema {
+	schema := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// Embedded structs contribute their fields, as with encoding/json
+			embedded := c.buildStruct(field.Type)
+			for key, property := range embedded.Properties {
+				schema.Properties[key] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := c.schemaOf(field.Type)
+		if enums := field.Tag.Get("enums"); enums != "" {
+			for _, value := range strings.Split(enums, ",") {
+				property.Enum = append(property.Enum, value)
+			}
+		}
+		schema.Properties[name] = property
+		if !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Validate checks a decoded JSON value (as produced by encoding/json into
+// an any) against schema and returns one message per violation, each
+// prefixed with the JSON path of the offending value
+func (d *Document) Validate(schema *Schema, value any) []string {
+	var problems []string
+	d.validate(schema, value, "$", &problems, 0)
+	return problems
+}
+
+func (d *Document) validate(schema *Schema, value any, path string, problems *[]string, depth int) {
+	schema = d.Resolve(schema)
+	if schema == nil || depth > 64 {
+		return
+	}
+	report := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	for _, part := range schema.AllOf {
+		d.validate(part, value, path, problems, depth+1)
+	}
+	for _, alternatives := range [][]*Schema{schema.OneOf, schema.AnyOf} {
+		if len(alternatives) > 0 && !d.matchesAny(alternatives, value, depth) {
+			report("matches none of the allowed schemas")
+		}
+	}
+
+	if value == nil {
+		if len(schema.Type) > 0 && !schema.Type.Is("null") && !schema.Nullable {
+			report("is null, want %s", schema.Type.Primary())
+		}
+		return
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		report("%s is not one of %v", describe(value), schema.Enum)
+	}
+	if len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		report("is %s, want %s", jsonType(value), schema.Type.Primary())
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				report("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := schema.Properties[name]; ok {
+				d.validate(property, v[name], path+"."+name, problems, depth+1)
+			} else if string(schema.AdditionalProperties) == "false" {
+				report("unexpected property %q", name)
+			}
+		}
+	case []any:
+		if schema.Items != nil {
+			for i, item := range v {
+				d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), problems, depth+1)
+			}
+		}
+	}
+}
+
+// matchesAny reports whether value satisfies one of the schemas
+func (d *Document) matchesAny(schemas []*Schema, value any, depth int) bool {
+	for _, schema := range schemas {
+		var problems []string
+		d.validate(schema, value, "$", &problems, depth+1)
+		if len(problems) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesType reports whether value has one of the JSON types
+func matchesType(types Types, value any) bool {
+	actual := jsonType(value)
+	for _, want := range types {
+		if want == actual || want == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// inEnum reports whether value is one of the allowed values
+func inEnum(enum []any, value any) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe renders a value for messages
+func describe(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	if len(data) > 40 {
+		return string(data[:37]) + "..."
+	}
+	return string(data)
+}
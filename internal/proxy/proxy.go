@@ -0,0 +1,249 @@
+// Package proxy puts the quirk engine in front of a real API: requests are
+// forwarded to an upstream and the answers come back strange.
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/tracing"
+)
+
+// Pattern is the route pattern proxied requests are logged and counted under
+const Pattern = "/{path...}"
+
+// maxBodyRewrite is the largest upstream body that gets rewritten
+const maxBodyRewrite = 1 << 20
+
+// statusQuirks maps upstream status codes to the quirk that distorts them
+var statusQuirks = map[int]string{
+	200: "proxy.ok",
+	201: "proxy.created",
+	400: "proxy.bad-request",
+	401: "proxy.unauthorized",
+	404: "proxy.not-found",
+	500: "proxy.server-error",
+}
+
+// giveawayHeaders would tell the client what really happened, so they are
+// dropped whenever a status code is rewritten
+var giveawayHeaders = []string{"Retry-After", "WWW-Authenticate", "Location", "Allow"}
+
+// Config configures a Proxy
+type Config struct {
+	Upstream *url.URL
+	Latency  time.Duration // added to every response
+	Jitter   time.Duration // up to this much more, chosen at random
+	Profile  *quirks.Profile
+}
+
+// Proxy forwards requests to an upstream and distorts the responses
+type Proxy struct {
+	mu        sync.RWMutex // guards the latency, jitter and profile in cfg
+	cfg       Config
+	proxy     *httputil.ReverseProxy
+	overrides map[string]http.HandlerFunc
+}
+
+// New creates a new Proxy instance
+func New(cfg Config) *Proxy {
+	if cfg.Profile == nil {
+		cfg.Profile = quirks.Strange
+	}
+	p := &Proxy{
+		cfg:       cfg,
+		overrides: make(map[string]http.HandlerFunc),
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.upstreamFailed,
+	}
+	return p
+}
+
+// SetProfile changes the quirk profile while the proxy is running
+func (p *Proxy) SetProfile(profile *quirks.Profile) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg.Profile = profile
+}
+
+// SetLatency changes the added latency and jitter while the proxy is running
+func (p *Proxy) SetLatency(latency, jitter time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg.Latency = latency
+	p.cfg.Jitter = jitter
+}
+
+// settings returns the parts of the configuration that can change
+func (p *Proxy) settings() (profile *quirks.Profile, latency, jitter time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg.Profile, p.cfg.Latency, p.cfg.Jitter
+}
+
+// SetMethodOverride answers every request with the given method locally,
+// whatever the path, instead of forwarding it
+func (p *Proxy) SetMethodOverride(method string, handler http.HandlerFunc) {
+	p.overrides[method] = handler
+}
+
+// Middleware forwards requests upstream, except for paths starting with one
+// of skip, which stay with the local routes
+func (p *Proxy) Middleware(skip ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range skip {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					handler(w, r)
+					return
+				}
+			}
+			p.ServeHTTP(w, r)
+		}
+	}
+}
+
+// ServeHTTP forwards a request and writes the distorted response
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	profile, latency, jitter := p.settings()
+	ctx := quirks.WithProfile(r.Context(), profile)
+	middleware.SetRoute(ctx, r.Method+" "+Pattern)
+	if override, ok := p.overrides[r.Method]; ok {
+		override(w, r.WithContext(ctx))
+		return
+	}
+
+	ctx, span := tracing.Start(ctx, "proxy "+r.Method, tracing.KindClient,
+		tracing.String("server.address", p.cfg.Upstream.Host),
+		tracing.String("url.path", r.URL.Path))
+	defer span.Finish()
+
+	delay(r, latency, jitter)
+	p.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// rewrite points the outgoing request at the upstream. The Host header is the
+// upstream's, so virtual hosts and TLS SNI work; the client's goes in
+// X-Forwarded-Host.
+func (p *Proxy) rewrite(pr *httputil.ProxyRequest) {
+	pr.SetURL(p.cfg.Upstream)
+	pr.SetXForwarded()
+	tracing.Inject(tracing.SpanFromContext(pr.In.Context()), pr.Out.Header)
+	if id := middleware.RequestIDFromContext(pr.In.Context()); id != "" {
+		pr.Out.Header.Set(middleware.RequestIDHeader, id)
+	}
+}
+
+// modifyResponse distorts the upstream response according to the profile
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	ctx := resp.Request.Context()
+	upstream := resp.StatusCode
+	tracing.SpanFromContext(ctx).SetAttributes(tracing.Int("http.response.status_code", upstream))
+
+	name, ok := statusQuirks[upstream]
+	if !ok {
+		return nil
+	}
+	status := quirks.Apply(ctx, name)
+	if status == upstream {
+		return nil
+	}
+
+	resp.StatusCode = status
+	resp.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	for _, name := range giveawayHeaders {
+		resp.Header.Del(name)
+	}
+
+	// An error passed off as success says so in the body too
+	if upstream >= 400 && status < 400 {
+		return rewriteBodyStatus(resp, "OK")
+	}
+	return nil
+}
+
+// rewriteBodyStatus sets the "status" field of a JSON object body. Bodies
+// larger than maxBodyRewrite are passed on untouched.
+func rewriteBodyStatus(resp *http.Response, value string) error {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyRewrite+1))
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+	if len(body) > maxBodyRewrite {
+		// Put back what was read, the rest is still streaming
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	var object map[string]any
+	if json.Unmarshal(body, &object) == nil && object != nil {
+		object["status"] = value
+		if rewritten, err := json.Marshal(object); err == nil {
+			body = rewritten
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// upstreamFailed answers when the upstream cannot be reached
+func (p *Proxy) upstreamFailed(w http.ResponseWriter, r *http.Request, err error) {
+	slog.WarnContext(r.Context(), "upstream request failed", "upstream", p.cfg.Upstream.String(), "error", err)
+	tracing.SpanFromContext(r.Context()).RecordError(err)
+
+	// Wrong status code - should be 502, but the proxy reports success
+	status := quirks.Apply(r.Context(), "proxy.bad-gateway")
+	response := models.APIResponse{
+		Error:     "Upstream unavailable",
+		Status:    "BAD_GATEWAY",
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	}
+	if status < 400 {
+		response.Status = "OK"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// delay holds the request for latency plus up to jitter more
+func delay(r *http.Request, latency, jitter time.Duration) {
+	wait := latency
+	if jitter > 0 {
+		wait += rand.N(jitter)
+	}
+	if wait <= 0 {
+		return
+	}
+	select {
+	case <-time.After(wait):
+	case <-r.Context().Done():
+	}
+}
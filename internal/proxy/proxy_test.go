@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"strange-errors-server/internal/quirks"
+)
+
+// jsonResponse returns an upstream response with a JSON body
+func jsonResponse(body string) *http.Response {
+	resp := &http.Response{
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return resp
+}
+
+func TestRewriteBodyStatus(t *testing.T) {
+	resp := jsonResponse(`{"status":"ERROR","error":"boom"}`)
+	if err := rewriteBodyStatus(resp, "OK"); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	var object map[string]any
+	if json.Unmarshal(body, &object) != nil || object["status"] != "OK" || object["error"] != "boom" {
+		t.Errorf("rewritten body = %s", body)
+	}
+	if resp.ContentLength != int64(len(body)) || resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+		t.Errorf("Content-Length = %d / %s for a %d byte body", resp.ContentLength, resp.Header.Get("Content-Length"), len(body))
+	}
+}
+
+func TestRewriteBodyStatusPassesLargeBodiesOn(t *testing.T) {
+	large := `{"status":"ERROR","data":"` + strings.Repeat("x", 2*maxBodyRewrite) + `"}`
+	resp := jsonResponse(large)
+	if err := rewriteBodyStatus(resp, "OK"); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, []byte(large)) {
+		t.Errorf("large body changed: %d bytes, want the %d upstream sent", len(body), len(large))
+	}
+	if resp.ContentLength != int64(len(large)) {
+		t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len(large))
+	}
+}
+
+func TestProxyForwardsToUpstream(t *testing.T) {
+	type seen struct{ host, forwardedHost, path, query string }
+	requests := make(chan seen, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- seen{r.Host, r.Header.Get("X-Forwarded-Host"), r.URL.Path, r.URL.RawQuery}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(500)
+		w.Write([]byte(`{"status":"ERROR","error":"boom"}`))
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL + "/v1")
+	proxy := httptest.NewServer(New(Config{Upstream: target, Profile: quirks.Strange}))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/api/things?page=2", nil)
+	req.Host = "trainee.example"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	got := <-requests
+	if want := target.Host; got.host != want {
+		t.Errorf("upstream saw Host %q, want its own %q", got.host, want)
+	}
+	if got.forwardedHost != "trainee.example" {
+		t.Errorf("X-Forwarded-Host = %q, want the client's Host", got.forwardedHost)
+	}
+	if got.path != "/v1/api/things" || got.query != "page=2" {
+		t.Errorf("upstream saw %s?%s, want /v1/api/things?page=2", got.path, got.query)
+	}
+
+	// The strange profile passes an upstream crash off as success
+	if resp.StatusCode != 200 {
+		t.Errorf("status %d, want the upstream 500 turned into 200", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") != "" {
+		t.Error("Retry-After was passed on with a rewritten status")
+	}
+	var object map[string]any
+	if json.Unmarshal(body, &object) != nil || object["status"] != "OK" || object["error"] != "boom" {
+		t.Errorf("body = %s, want the status field rewritten to OK", body)
+	}
+}
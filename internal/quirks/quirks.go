@@ -0,0 +1,296 @@
+package quirks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quirk is a deliberate deviation from what the HTTP specs call for
+type Quirk struct {
+	Name        string // e.g. "route.not-found"
+	Intended    int    // status code an honest server would use
+	Strange     int    // status code this server uses instead, obviously wrong
+	Plausible   int    // status code used at the intermediate level, wrong but believable
+	Hidden      bool   // the status code is right and the bug is elsewhere: body, headers, ordering or timing
+	Description string
+}
+
+// catalog holds every quirk the server knows about, keyed by name
+var catalog = map[string]Quirk{
+	"route.not-found": {
+		Name:        "route.not-found",
+		Intended:    404,
+		Strange:     200,
+		Plausible:   200,
+		Description: "Unknown routes answer 200 OK with an error in the body",
+	},
+	"articles.list.success": {
+		Name:        "articles.list.success",
+		Intended:    200,
+		Strange:     777,
+		Plausible:   202,
+		Description: "Listing articles succeeds with a non-existent status code",
+	},
+	"article.create.success": {
+		Name:        "article.create.success",
+		Intended:    201,
+		Strange:     888,
+		Plausible:   200,
+		Description: "Creating an article succeeds with a non-existent status code",
+	},
+	"article.create.invalid": {
+		Name:        "article.create.invalid",
+		Intended:    400,
+		Strange:     999,
+		Plausible:   500,
+		Description: "Invalid article data is rejected with a non-existent status code",
+	},
+	"article.delete.bad-id": {
+		Name:        "article.delete.bad-id",
+		Intended:    400,
+		Strange:     500,
+		Plausible:   404,
+		Description: "A non-numeric article ID is blamed on the server",
+	},
+	"article.delete.not-found": {
+		Name:        "article.delete.not-found",
+		Intended:    404,
+		Strange:     666,
+		Plausible:   200,
+		Description: "Deleting a missing article answers with a non-existent status code",
+	},
+	"articles.list.newest-missing": {
+		Name:        "articles.list.newest-missing",
+		Intended:    200,
+		Strange:     200,
+		Plausible:   200,
+		Hidden:      true,
+		Description: "Listing articles leaves out the newest one",
+	},
+	"articles.list.shuffled": {
+		Name:        "articles.list.shuffled",
+		Intended:    200,
+		Strange:     200,
+		Plausible:   200,
+		Hidden:      true,
+		Description: "Listing articles returns them in a different order every time",
+	},
+	"article.delete.delayed": {
+		Name:        "article.delete.delayed",
+		Intended:    200,
+		Strange:     200,
+		Plausible:   200,
+		Hidden:      true,
+		Description: "Deleting an article is confirmed right away, but the article only disappears seconds later",
+	},
+	"user.create.cacheable": {
+		Name:        "user.create.cacheable",
+		Intended:    201,
+		Strange:     201,
+		Plausible:   201,
+		Hidden:      true,
+		Description: "The response carrying a new user's API key may be stored by shared caches",
+	},
+	"user.create.invalid-email": {
+		Name:        "user.create.invalid-email",
+		Intended:    400,
+		Strange:     500,
+		Plausible:   409,
+		Description: "An invalid email address is blamed on the server",
+	},
+	"proxy.ok": {
+		Name:        "proxy.ok",
+		Intended:    200,
+		Strange:     777,
+		Plausible:   202,
+		Description: "Upstream successes are passed on with a non-existent status code",
+	},
+	"proxy.created": {
+		Name:        "proxy.created",
+		Intended:    201,
+		Strange:     888,
+		Plausible:   200,
+		Description: "Upstream creations are passed on with a non-existent status code",
+	},
+	"proxy.bad-request": {
+		Name:        "proxy.bad-request",
+		Intended:    400,
+		Strange:     999,
+		Plausible:   500,
+		Description: "Upstream validation errors are passed on with a non-existent status code",
+	},
+	"proxy.unauthorized": {
+		Name:        "proxy.unauthorized",
+		Intended:    401,
+		Strange:     404,
+		Plausible:   403,
+		Description: "Upstream authentication failures pretend the resource does not exist",
+	},
+	"proxy.not-found": {
+		Name:        "proxy.not-found",
+		Intended:    404,
+		Strange:     666,
+		Plausible:   204,
+		Description: "Upstream not-founds are passed on with a non-existent status code",
+	},
+	"proxy.server-error": {
+		Name:        "proxy.server-error",
+		Intended:    500,
+		Strange:     200,
+		Plausible:   200,
+		Description: "Upstream crashes are reported as success with \"status\": \"OK\" in the body",
+	},
+	"proxy.bad-gateway": {
+		Name:        "proxy.bad-gateway",
+		Intended:    502,
+		Strange:     200,
+		Plausible:   500,
+		Description: "An unreachable upstream is reported as success with the error in the body",
+	},
+	"mock.ok": {
+		Name:        "mock.ok",
+		Intended:    200,
+		Strange:     777,
+		Plausible:   202,
+		Description: "Documented successes are mocked with a non-existent status code",
+	},
+	"mock.created": {
+		Name:        "mock.created",
+		Intended:    201,
+		Strange:     888,
+		Plausible:   200,
+		Description: "Documented creations are mocked with a non-existent status code",
+	},
+	"mock.bad-request": {
+		Name:        "mock.bad-request",
+		Intended:    400,
+		Strange:     999,
+		Plausible:   500,
+		Description: "Documented validation errors are mocked with a non-existent status code",
+	},
+	"mock.not-found": {
+		Name:        "mock.not-found",
+		Intended:    404,
+		Strange:     666,
+		Plausible:   204,
+		Description: "Documented not-founds are mocked with a non-existent status code",
+	},
+	"mock.server-error": {
+		Name:        "mock.server-error",
+		Intended:    500,
+		Strange:     200,
+		Plausible:   200,
+		Description: "Documented server errors are mocked as success with \"status\": \"OK\" in the body",
+	},
+}
+
+// Lookup returns the quirk with the given name
+func Lookup(name string) (Quirk, bool) {
+	q, ok := catalog[name]
+	return q, ok
+}
+
+// All returns every known quirk, sorted by name
+func All() []Quirk {
+	all := make([]Quirk, 0, len(catalog))
+	for _, q := range catalog {
+		all = append(all, q)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Difficulty levels, from the most obvious quirks to the best hidden ones
+const (
+	Beginner     = "beginner"
+	Intermediate = "intermediate"
+	Expert       = "expert"
+)
+
+// Profile decides which status code each quirk answers with
+type Profile struct {
+	Name       string
+	Difficulty string         // the level the profile is played at, if it is one
+	Honest     bool           // every quirk answers with its intended status
+	Plausible  bool           // every quirk answers with its plausible status
+	Hidden     bool           // hidden quirks are active
+	Overrides  map[string]int // per-quirk status codes, winning over the above
+}
+
+var (
+	// Strange is the default profile: every quirk is active
+	Strange = &Profile{Name: "strange", Difficulty: Beginner}
+	// Plausible swaps the non-existent codes for real ones that are just as
+	// wrong
+	Plausible = &Profile{Name: "plausible", Difficulty: Intermediate, Plausible: true}
+	// Subtle gets every status code right and hides the bugs elsewhere
+	Subtle = &Profile{Name: "subtle", Difficulty: Expert, Honest: true, Hidden: true}
+	// Honest turns every quirk off
+	Honest = &Profile{Name: "honest", Honest: true}
+)
+
+// profiles are the built-in profiles, easiest first
+var profiles = []*Profile{Strange, Plausible, Subtle, Honest}
+
+// ByName returns one of the built-in profiles, by its name or by its
+// difficulty level
+func ByName(name string) (*Profile, error) {
+	if name == "" {
+		return Strange, nil
+	}
+	for _, p := range profiles {
+		if strings.EqualFold(name, p.Name) || (p.Difficulty != "" && strings.EqualFold(name, p.Difficulty)) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown quirk profile %q (want strange, plausible, subtle or honest, or a difficulty: beginner, intermediate or expert)", name)
+}
+
+// Status returns the status code a quirk answers with under this profile
+func (p *Profile) Status(name string) int {
+	q, ok := catalog[name]
+	if !ok {
+		panic(fmt.Sprintf("quirks: unknown quirk %q", name))
+	}
+	if code, ok := p.Overrides[name]; ok {
+		return code
+	}
+	switch {
+	case p.Honest:
+		return q.Intended
+	case p.Plausible:
+		return q.Plausible
+	}
+	return q.Strange
+}
+
+// Active reports whether a quirk changes responses under this profile.
+// Hidden quirks never change the status code, only the profile switches
+// them on.
+func (p *Profile) Active(name string) bool {
+	q, ok := catalog[name]
+	if !ok {
+		panic(fmt.Sprintf("quirks: unknown quirk %q", name))
+	}
+	if q.Hidden {
+		return p.Hidden
+	}
+	return p.Status(name) != q.Intended
+}
+
+type contextKey struct{}
+
+// WithProfile returns a copy of ctx carrying a quirk profile
+func WithProfile(ctx context.Context, p *Profile) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the quirk profile stored in ctx, or Strange if there is none
+func FromContext(ctx context.Context) *Profile {
+	if p, ok := ctx.Value(contextKey{}).(*Profile); ok {
+		return p
+	}
+	return Strange
+}
@@ -0,0 +1,101 @@
+package quirks
+
+import (
+	"context"
+	"sync"
+
+	"strange-errors-server/internal/tracing"
+)
+
+// Applied is a quirk that changed a particular response
+type Applied struct {
+	Name     string `json:"name"`
+	Intended int    `json:"intended"`
+	Actual   int    `json:"actual"`
+}
+
+// Recorder collects the quirks applied while serving one request
+type Recorder struct {
+	mu      sync.Mutex
+	applied []Applied
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a copy of ctx carrying a new Recorder
+func WithRecorder(ctx context.Context) (context.Context, *Recorder) {
+	rec := &Recorder{}
+	return context.WithValue(ctx, recorderKey{}, rec), rec
+}
+
+// RecorderFromContext returns the Recorder stored in ctx, if any
+func RecorderFromContext(ctx context.Context) (*Recorder, bool) {
+	rec, ok := ctx.Value(recorderKey{}).(*Recorder)
+	return rec, ok
+}
+
+// Applied returns the quirks recorded so far
+func (rec *Recorder) Applied() []Applied {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]Applied(nil), rec.applied...)
+}
+
+// Apply returns the status code a catalog quirk answers with under the
+// request's profile, recording it if that differs from the intended code
+func Apply(ctx context.Context, name string) int {
+	profile := FromContext(ctx)
+	_, span := tracing.Start(ctx, "quirk "+name, tracing.KindInternal,
+		tracing.String("quirk.name", name),
+		tracing.String("quirk.profile", profile.Name))
+	defer span.Finish()
+
+	status := profile.Status(name)
+	span.SetAttributes(
+		tracing.Int("quirk.intended_status", catalog[name].Intended),
+		tracing.Int("quirk.actual_status", status),
+		tracing.Bool("quirk.applied", status != catalog[name].Intended))
+	Note(ctx, name, catalog[name].Intended, status)
+	return status
+}
+
+// Note records a quirk that is not driven by the profile, such as a rate
+// limiter or auth failure mode. Nothing is recorded when intended == actual.
+func Note(ctx context.Context, name string, intended, actual int) {
+	if intended == actual {
+		return
+	}
+	tracing.SpanFromContext(ctx).AddEvent("quirk applied",
+		tracing.String("quirk.name", name),
+		tracing.Int("quirk.intended_status", intended),
+		tracing.Int("quirk.actual_status", actual))
+	if rec, ok := RecorderFromContext(ctx); ok {
+		rec.mu.Lock()
+		rec.applied = append(rec.applied, Applied{Name: name, Intended: intended, Actual: actual})
+		rec.mu.Unlock()
+	}
+}
+
+// Hide reports whether a hidden quirk is active under the request's
+// profile, recording it if so. Hidden quirks keep the status code right,
+// so they are recorded with intended == actual.
+func Hide(ctx context.Context, name string) bool {
+	profile := FromContext(ctx)
+	if !profile.Active(name) {
+		return false
+	}
+	status := catalog[name].Intended
+	_, span := tracing.Start(ctx, "quirk "+name, tracing.KindInternal,
+		tracing.String("quirk.name", name),
+		tracing.String("quirk.profile", profile.Name),
+		tracing.Int("quirk.intended_status", status),
+		tracing.Int("quirk.actual_status", status),
+		tracing.Bool("quirk.applied", true))
+	span.Finish()
+	if rec, ok := RecorderFromContext(ctx); ok {
+		rec.mu.Lock()
+		rec.applied = append(rec.applied, Applied{Name: name, Intended: status, Actual: status})
+		rec.mu.Unlock()
+	}
+	return true
+}
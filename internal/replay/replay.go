@@ -0,0 +1,201 @@
+// Package replay answers requests from a recorded session instead of
+// running the handlers, so a strange session can be replayed in CI.
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/traffic"
+)
+
+// MissMode selects what happens to a request the recording has no answer for
+type MissMode string
+
+const (
+	// MissPassthrough runs the real handlers
+	MissPassthrough MissMode = "passthrough"
+	// MissNotFound answers 404 Not Found
+	MissNotFound MissMode = "404"
+	// MissStrange answers 200 OK with the error hidden in the body
+	MissStrange MissMode = "200"
+)
+
+// maxBodyHash is how much of a request body takes part in matching; it
+// matches what the recorder keeps
+const maxBodyHash = 64 << 10
+
+// skipHeaders are recorded response headers that are not replayed because
+// the server sets them itself
+var skipHeaders = []string{"Content-Length", "Date", "X-Request-Id", "Transfer-Encoding"}
+
+// ParseMissMode validates a miss mode name
+func ParseMissMode(s string) (MissMode, error) {
+	switch mode := MissMode(strings.ToLower(s)); mode {
+	case MissPassthrough, MissNotFound, MissStrange:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown replay miss mode %q (want passthrough, 404 or 200)", s)
+}
+
+// Replayer serves recorded responses. Requests are matched by method, path,
+// query and a hash of the body. Identical requests get the recorded answers
+// in recorded order, so a GOAT losing its patience replays faithfully; once
+// they run out the last answer repeats.
+type Replayer struct {
+	mu      sync.Mutex
+	entries map[string][]traffic.Exchange
+	served  map[string]int
+	miss    MissMode
+}
+
+// NewReplayer creates a new Replayer instance serving exchanges
+func NewReplayer(exchanges []traffic.Exchange, miss MissMode) *Replayer {
+	rp := &Replayer{
+		entries: make(map[string][]traffic.Exchange),
+		served:  make(map[string]int),
+		miss:    miss,
+	}
+	for _, e := range exchanges {
+		key := matchKey(e.Method, e.Path, e.Query, e.RequestBody)
+		rp.entries[key] = append(rp.entries[key], e)
+	}
+	return rp
+}
+
+// Len returns the number of distinct requests the replayer can answer
+func (rp *Replayer) Len() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return len(rp.entries)
+}
+
+// next returns the recorded exchange for key, advancing its sequence
+func (rp *Replayer) next(key string) (traffic.Exchange, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	recorded := rp.entries[key]
+	if len(recorded) == 0 {
+		return traffic.Exchange{}, false
+	}
+	i := min(rp.served[key], len(recorded)-1)
+	rp.served[key] = i + 1
+	return recorded[i], true
+}
+
+// Middleware answers requests from the recording, except for paths starting
+// with one of skip
+func (rp *Replayer) Middleware(skip ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range skip {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					handler(w, r)
+					return
+				}
+			}
+
+			body := readBody(r)
+			e, ok := rp.next(matchKey(r.Method, r.URL.Path, r.URL.RawQuery, body))
+			if !ok {
+				rp.missed(w, r, handler)
+				return
+			}
+			serve(w, r, e)
+		}
+	}
+}
+
+// serve writes a recorded response
+func serve(w http.ResponseWriter, r *http.Request, e traffic.Exchange) {
+	middleware.SetRoute(r.Context(), e.Route)
+	for _, q := range e.Quirks {
+		quirks.Note(r.Context(), q.Name, q.Intended, q.Actual)
+	}
+
+	for name, values := range e.ResponseHeaders {
+		if isSkipped(name) {
+			continue
+		}
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	if e.RequestID != "" {
+		w.Header().Set("X-Replayed-From", e.RequestID)
+	}
+	w.WriteHeader(e.Status)
+	w.Write(e.ResponseBody)
+}
+
+// missed answers a request the recording has no answer for
+func (rp *Replayer) missed(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	slog.DebugContext(r.Context(), "replay miss", "method", r.Method, "path", r.URL.Path, "mode", rp.miss)
+	switch rp.miss {
+	case MissNotFound:
+		writeMiss(w, r, http.StatusNotFound)
+	case MissStrange:
+		// Wrong status code - should be 404, but the recording "found" something
+		quirks.Note(r.Context(), "replay.miss", http.StatusNotFound, 200)
+		writeMiss(w, r, 200)
+	default:
+		handler(w, r)
+	}
+}
+
+// writeMiss writes the JSON body for a replay miss
+func writeMiss(w http.ResponseWriter, r *http.Request, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.APIResponse{
+		Error:     "No recorded response for this request",
+		Status:    "REPLAY_MISS",
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	})
+}
+
+// readBody reads the part of the request body that takes part in matching and
+// puts it back for the handler in case of a passthrough
+func readBody(r *http.Request) []byte {
+	if r.Body == nil {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(r.Body, maxBodyHash))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body
+}
+
+// matchKey identifies a request; query parameters are compared in canonical order
+func matchKey(method, path, rawQuery string, body []byte) string {
+	query := rawQuery
+	if values, err := url.ParseQuery(rawQuery); err == nil {
+		query = values.Encode()
+	}
+	sum := sha256.Sum256(body)
+	return method + " " + path + "?" + query + " " + hex.EncodeToString(sum[:])
+}
+
+// isSkipped reports whether a recorded response header is left out of replays
+func isSkipped(name string) bool {
+	for _, skip := range skipHeaders {
+		if http.CanonicalHeaderKey(name) == skip {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package report
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"strange-errors-server/internal/traffic"
+)
+
+// Outcome is how a classification rule files an exchange
+type Outcome string
+
+const (
+	Success Outcome = "success"
+	Error   Outcome = "error"
+	Unknown Outcome = "unknown"
+)
+
+// Rule is one way a monitoring tool might decide whether a response succeeded
+type Rule struct {
+	Name        string
+	Description string
+	Classify    func(e traffic.Exchange) Outcome
+}
+
+// Rules are the classification rules compared by the report. "intended" is
+// the ground truth: the status code the server should have sent.
+var Rules = []Rule{
+	{
+		Name:        "first-digit",
+		Description: "2xx/3xx are successes, 4xx/5xx are errors, anything else is unknown",
+		Classify:    func(e traffic.Exchange) Outcome { return byFirstDigit(e.Status) },
+	},
+	{
+		Name:        "rfc-registry",
+		Description: "Only status codes in the IANA registry count; unregistered codes are unknown",
+		Classify:    func(e traffic.Exchange) Outcome { return byRegistry(e.Status) },
+	},
+	{
+		Name:        "body-status",
+		Description: `The "status" field of a JSON body decides, whatever the status code says`,
+		Classify:    byBodyStatus,
+	},
+	{
+		Name:        "intended",
+		Description: "The status code an honest server would have sent (ground truth)",
+		Classify:    func(e traffic.Exchange) Outcome { return byRegistry(e.IntendedStatus()) },
+	},
+}
+
+// byFirstDigit classifies like a dashboard that buckets by status class
+func byFirstDigit(code int) Outcome {
+	switch code / 100 {
+	case 2, 3:
+		return Success
+	case 4, 5:
+		return Error
+	}
+	return Unknown
+}
+
+// byRegistry classifies like a tool that only trusts registered status codes
+func byRegistry(code int) Outcome {
+	if http.StatusText(code) == "" {
+		return Unknown
+	}
+	if code < 400 {
+		return Success
+	}
+	return Error
+}
+
+// successWords and errorWords are "status" body values with an obvious meaning
+var (
+	successWords = []string{"OK", "SUCCESS"}
+	errorWords   = []string{"FAIL", "ERROR", "INCORRECT", "BAD", "EXISTS", "UNAUTHORIZED", "FORBIDDEN", "NOT_FOUND", "LIMITED", "ANNOYED", "UPSET", "ENRAGED", "FATAL", "OVERLOADED"}
+)
+
+// byBodyStatus classifies by the "status" field of a JSON body
+func byBodyStatus(e traffic.Exchange) Outcome {
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(e.ResponseBody, &body); err != nil {
+		return Unknown
+	}
+	status := strings.ToUpper(body.Status)
+	for _, word := range errorWords {
+		if strings.Contains(status, word) {
+			return Error
+		}
+	}
+	for _, word := range successWords {
+		if status == word {
+			return Success
+		}
+	}
+	if body.Error != "" {
+		return Error
+	}
+	return Unknown
+}
+
+// Counts tallies outcomes for one rule
+type Counts struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Success     int    `json:"success"`
+	Error       int    `json:"error"`
+	Unknown     int    `json:"unknown"`
+}
+
+// Disagreement is an exchange the rules did not agree on
+type Disagreement struct {
+	RequestID string             `json:"request_id"`
+	Method    string             `json:"method"`
+	Path      string             `json:"path"`
+	Status    int                `json:"status"`
+	Intended  int                `json:"intended_status"`
+	Outcomes  map[string]Outcome `json:"outcomes"`
+}
+
+// Classification is the result of running every rule over recorded traffic
+type Classification struct {
+	Exchanges     int            `json:"exchanges"`
+	Counts        []Counts       `json:"counts"`
+	Disagreements []Disagreement `json:"disagreements"`
+}
+
+// Classify runs every rule over the exchanges
+func Classify(exchanges []traffic.Exchange) Classification {
+	result := Classification{
+		Exchanges:     len(exchanges),
+		Counts:        make([]Counts, len(Rules)),
+		Disagreements: []Disagreement{},
+	}
+	for i, rule := range Rules {
+		result.Counts[i] = Counts{Rule: rule.Name, Description: rule.Description}
+	}
+
+	for _, e := range exchanges {
+		outcomes := make(map[string]Outcome, len(Rules))
+		agree := true
+		var first Outcome
+		for i, rule := range Rules {
+			outcome := rule.Classify(e)
+			outcomes[rule.Name] = outcome
+			switch outcome {
+			case Success:
+				result.Counts[i].Success++
+			case Error:
+				result.Counts[i].Error++
+			default:
+				result.Counts[i].Unknown++
+			}
+			if i == 0 {
+				first = outcome
+			} else if outcome != first {
+				agree = false
+			}
+		}
+		if !agree {
+			result.Disagreements = append(result.Disagreements, Disagreement{
+				RequestID: e.RequestID,
+				Method:    e.Method,
+				Path:      e.Path,
+				Status:    e.Status,
+				Intended:  e.IntendedStatus(),
+				Outcomes:  outcomes,
+			})
+		}
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteText renders a classification as a plain-text report
+func WriteText(w io.Writer, c Classification) {
+	fmt.Fprintf(w, "Classified %d recorded exchanges\n\n", c.Exchanges)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tSUCCESS\tERROR\tUNKNOWN\tDESCRIPTION")
+	for _, counts := range c.Counts {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", counts.Rule, counts.Success, counts.Error, counts.Unknown, counts.Description)
+	}
+	tw.Flush()
+
+	if len(c.Disagreements) == 0 {
+		fmt.Fprintln(w, "\nAll rules agree on every exchange.")
+		return
+	}
+
+	fmt.Fprintf(w, "\n%d exchanges where the rules disagree:\n\n", len(c.Disagreements))
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"REQUEST", "METHOD", "PATH", "STATUS", "INTENDED"}
+	for _, rule := range Rules {
+		header = append(header, strings.ToUpper(rule.Name))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, d := range c.Disagreements {
+		row := []string{d.RequestID, d.Method, d.Path, fmt.Sprint(d.Status), fmt.Sprint(d.Intended)}
+		for _, rule := range Rules {
+			row = append(row, string(d.Outcomes[rule.Name]))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
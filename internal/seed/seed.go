@@ -0,0 +1,126 @@
+// Package seed fills a database with articles and users from a file, and
+// exports a database back into the same format
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/database"
+	"strange-errors-server/internal/models"
+)
+
+// Article is an article to seed
+type Article struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	OwnerID int    `json:"owner_id,omitempty"`
+}
+
+// User is a user to seed. Role defaults to reader. Password is hashed on
+// the way in; exports carry PasswordHash instead so that they round-trip.
+type User struct {
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Role         string `json:"role,omitempty"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// Data is the content of a seed file
+type Data struct {
+	// Articles, if not nil, replace the two built-in test articles on a reset
+	Articles []Article `json:"articles"`
+	Users    []User    `json:"users"`
+}
+
+// Load reads a YAML or JSON seed file
+func Load(path string) (*Data, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := yaml.YAMLToJSON(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var data Data
+	if err := json.Unmarshal(converted, &data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &data, nil
+}
+
+// Apply adds the seed data to db. With reset, the database is emptied first
+// and gets the built-in test articles back unless data has articles of its own.
+func Apply(ctx context.Context, db *database.DB, data *Data, reset bool) error {
+	if reset {
+		var err error
+		if data.Articles == nil {
+			err = db.Reset(ctx)
+		} else {
+			err = db.Clear(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, article := range data.Articles {
+		if err := db.CreateArticle(ctx, article.Title, article.Content, article.OwnerID); err != nil {
+			return fmt.Errorf("failed to seed article %q: %w", article.Title, err)
+		}
+	}
+	for _, user := range data.Users {
+		role := user.Role
+		if role == "" {
+			role = models.RoleReader
+		}
+		if !auth.ValidRole(role) {
+			return fmt.Errorf("failed to seed user %q: unknown role %q", user.Name, role)
+		}
+		creds := database.Credentials{PasswordHash: user.PasswordHash}
+		if user.Password != "" {
+			hash, err := auth.HashPassword(user.Password)
+			if err != nil {
+				return err
+			}
+			creds.PasswordHash = hash
+		}
+		if _, err := db.CreateUser(ctx, user.Name, user.Email, role, creds); err != nil {
+			return fmt.Errorf("failed to seed user %q: %w", user.Name, err)
+		}
+	}
+	return nil
+}
+
+// Export reads every article and user from db. API keys are not exported:
+// only their hashes are stored and they are handed out once.
+func Export(ctx context.Context, db *database.DB) (*Data, error) {
+	articles, err := db.GetArticles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users, err := db.GetAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &Data{Articles: []Article{}, Users: []User{}}
+	for _, a := range articles {
+		data.Articles = append(data.Articles, Article{Title: a.Title, Content: a.Content, OwnerID: a.OwnerID})
+	}
+	for _, u := range users {
+		_, hash, err := db.GetUserCredentials(ctx, u.Name)
+		if err != nil {
+			return nil, err
+		}
+		data.Users = append(data.Users, User{Name: u.Name, Email: u.Email, Role: u.Role, PasswordHash: hash})
+	}
+	return data, nil
+}
@@ -0,0 +1,101 @@
+// Package tenant gives every workshop participant a sandbox of their own,
+// so that one trainee deleting article 1 does not break everybody else's
+// exercise. Requests are assigned to a tenant by a header, a cookie or a
+// subdomain.
+package tenant
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// validID is what a tenant ID may look like. IDs name database files, so
+// they are kept to characters that are safe in a file name.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ErrInvalidID is returned for requests naming a tenant ID that is not valid
+var ErrInvalidID = errors.New("tenant ID must be 1-64 letters, digits, _ or -")
+
+// Key kinds
+const (
+	KindHeader    = "header"
+	KindCookie    = "cookie"
+	KindSubdomain = "subdomain"
+)
+
+// Key tells which tenant a request belongs to
+type Key struct {
+	Kind string
+	Name string // header name, cookie name or the domain below which subdomains are tenants
+}
+
+// ParseKey parses a key such as "header:X-Tenant", "cookie:sandbox" or
+// "subdomain:workshop.example.com". A bare "header", "cookie" or
+// "subdomain" picks X-Tenant, sandbox and localhost.
+func ParseKey(s string) (Key, error) {
+	kind, name, _ := strings.Cut(strings.TrimSpace(s), ":")
+	kind = strings.ToLower(kind)
+	switch kind {
+	case KindHeader:
+		if name == "" {
+			name = "X-Tenant"
+		}
+		return Key{Kind: kind, Name: http.CanonicalHeaderKey(name)}, nil
+	case KindCookie:
+		if name == "" {
+			name = "sandbox"
+		}
+		return Key{Kind: kind, Name: name}, nil
+	case KindSubdomain:
+		if name == "" {
+			name = "localhost"
+		}
+		return Key{Kind: kind, Name: strings.ToLower(strings.Trim(name, "."))}, nil
+	}
+	return Key{}, fmt.Errorf("invalid tenant key %q (want header[:NAME], cookie[:NAME] or subdomain[:DOMAIN])", s)
+}
+
+// String returns the key the way ParseKey accepts it
+func (k Key) String() string {
+	return k.Kind + ":" + k.Name
+}
+
+// ID returns the tenant a request belongs to, or "" if it names none
+func (k Key) ID(r *http.Request) (string, error) {
+	var id string
+	switch k.Kind {
+	case KindHeader:
+		id = strings.TrimSpace(r.Header.Get(k.Name))
+	case KindCookie:
+		if c, err := r.Cookie(k.Name); err == nil {
+			id = c.Value
+		}
+	case KindSubdomain:
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		prefix, ok := strings.CutSuffix(strings.ToLower(host), "."+k.Name)
+		if !ok {
+			return "", nil
+		}
+		id = prefix
+	}
+	if id != "" && !validID.MatchString(id) {
+		return "", ErrInvalidID
+	}
+	return id, nil
+}
+
+// newID returns a random tenant ID for clients without one
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,383 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/models"
+)
+
+// ErrFull is returned when a new tenant would exceed the limit
+var ErrFull = errors.New("too many sandboxes")
+
+// Sandbox is what a tenant gets: a copy of the API with its own state
+type Sandbox interface {
+	http.Handler
+	// Close releases the sandbox's resources once it is dropped
+	Close() error
+}
+
+// Info describes a tenant
+type Info struct {
+	ID       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+	Requests int       `json:"requests"`
+}
+
+// entry is a tenant's sandbox together with its bookkeeping
+type entry[S Sandbox] struct {
+	sandbox S
+	info    Info
+	ready   chan struct{} // closed once the sandbox is created or failed to be
+	err     error         // why the sandbox could not be created
+	refs    int           // requests using the sandbox
+	dropped bool          // closed once the last request releases it
+}
+
+// Manager hands out sandboxes, creating them on first use and dropping the
+// ones that have been idle for too long
+type Manager[S Sandbox] struct {
+	mu        sync.Mutex
+	key       Key
+	create    func(id string) (S, error)
+	sandboxes map[string]*entry[S]
+	idle      time.Duration
+	limit     int
+	now       func() time.Time
+}
+
+// NewManager creates a new Manager instance assigning requests to tenants
+// by key and creating their sandboxes with create
+func NewManager[S Sandbox](key Key, create func(id string) (S, error)) *Manager[S] {
+	return &Manager[S]{
+		key:       key,
+		create:    create,
+		sandboxes: make(map[string]*entry[S]),
+		idle:      30 * time.Minute,
+		limit:     100,
+		now:       time.Now,
+	}
+}
+
+// SetIdleTimeout sets how long a sandbox lives without requests
+func (m *Manager[S]) SetIdleTimeout(idle time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idle = idle
+}
+
+// IdleTimeout returns how long a sandbox lives without requests
+func (m *Manager[S]) IdleTimeout() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.idle
+}
+
+// SetLimit sets how many sandboxes may exist at once
+func (m *Manager[S]) SetLimit(limit int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limit = limit
+}
+
+// SetClock sets where the manager gets the time from
+func (m *Manager[S]) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// Key returns how requests are assigned to tenants
+func (m *Manager[S]) Key() Key {
+	return m.key
+}
+
+// Resolve returns the sandbox of the tenant r belongs to, creating it if
+// needed. The sandbox stays open until release is called. Requests naming
+// no tenant get ok == false; with a cookie key, that includes clients
+// without the cookie, which get one set on w and their sandbox once they
+// send it back. Clients that keep no cookies never get one.
+func (m *Manager[S]) Resolve(w http.ResponseWriter, r *http.Request) (info Info, sandbox S, release func(), ok bool, err error) {
+	id, err := m.key.ID(r)
+	if err != nil {
+		return Info{}, sandbox, nil, false, err
+	}
+	if id == "" {
+		if m.key.Kind == KindCookie {
+			http.SetCookie(w, &http.Cookie{
+				Name:     m.key.Name,
+				Value:    newID(),
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		return Info{}, sandbox, nil, false, nil
+	}
+
+	e, err := m.acquire(r.Context(), id)
+	if err != nil {
+		return Info{}, sandbox, nil, false, err
+	}
+	m.mu.Lock()
+	e.info.LastUsed = m.now()
+	e.info.Requests++
+	info = e.info
+	m.mu.Unlock()
+	return info, e.sandbox, sync.OnceFunc(func() { m.release(e) }), true, nil
+}
+
+// acquire returns the entry of tenant id with a reference taken, creating
+// the sandbox if needed. Creating one opens and seeds a database, so it
+// happens outside the lock; requests for the same tenant wait for it.
+func (m *Manager[S]) acquire(ctx context.Context, id string) (*entry[S], error) {
+	m.mu.Lock()
+	e, exists := m.sandboxes[id]
+	if exists {
+		e.refs++
+		m.mu.Unlock()
+		<-e.ready
+		if e.err != nil {
+			m.release(e)
+			return nil, e.err
+		}
+		return e, nil
+	}
+	if len(m.sandboxes) >= m.limit {
+		m.mu.Unlock()
+		return nil, ErrFull
+	}
+	e = &entry[S]{info: Info{ID: id, Created: m.now()}, ready: make(chan struct{}), refs: 1}
+	m.sandboxes[id] = e
+	m.mu.Unlock()
+
+	e.sandbox, e.err = m.create(id)
+	m.mu.Lock()
+	if e.err != nil {
+		delete(m.sandboxes, id)
+	}
+	count := len(m.sandboxes)
+	m.mu.Unlock()
+	close(e.ready)
+	if e.err != nil {
+		m.release(e)
+		return nil, e.err
+	}
+	slog.InfoContext(ctx, "sandbox created", "tenant", id, "sandboxes", count)
+	return e, nil
+}
+
+// release gives back a reference taken by acquire, closing the sandbox if
+// it was dropped while in use
+func (m *Manager[S]) release(e *entry[S]) {
+	m.mu.Lock()
+	e.refs--
+	closeNow := e.dropped && e.refs == 0 && e.err == nil
+	m.mu.Unlock()
+	if closeNow {
+		m.close(e.info.ID, e.sandbox)
+	}
+}
+
+// drop takes entries out of the map and closes those no request is using;
+// the others are closed by the last release. Call it with m.mu held.
+func (m *Manager[S]) drop(entries []*entry[S], reason string) (closeNow []*entry[S]) {
+	for _, e := range entries {
+		delete(m.sandboxes, e.info.ID)
+		e.dropped = true
+		slog.Info("sandbox dropped", "tenant", e.info.ID, "reason", reason)
+		if e.refs == 0 {
+			closeNow = append(closeNow, e)
+		}
+	}
+	return closeNow
+}
+
+// Get returns a tenant's sandbox without touching it
+func (m *Manager[S]) Get(id string) (Info, S, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.sandboxes[id]
+	if !ok || !isReady(e) {
+		var zero S
+		return Info{}, zero, false
+	}
+	return e.info, e.sandbox, true
+}
+
+// List describes every tenant, most recently used first
+func (m *Manager[S]) List() []Info {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	infos := make([]Info, 0, len(m.sandboxes))
+	for _, e := range m.sandboxes {
+		if isReady(e) {
+			infos = append(infos, e.info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].LastUsed.Equal(infos[j].LastUsed) {
+			return infos[i].LastUsed.After(infos[j].LastUsed)
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Each calls fn for every sandbox, such as to apply a configuration reload
+func (m *Manager[S]) Each(fn func(S)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.sandboxes {
+		if isReady(e) {
+			fn(e.sandbox)
+		}
+	}
+}
+
+// Remove drops a tenant's sandbox. The next request of the tenant gets a
+// fresh one; requests still using the old one finish first.
+func (m *Manager[S]) Remove(id string) bool {
+	m.mu.Lock()
+	e, ok := m.sandboxes[id]
+	ok = ok && isReady(e)
+	var closeNow []*entry[S]
+	if ok {
+		closeNow = m.drop([]*entry[S]{e}, "removed")
+	}
+	m.mu.Unlock()
+	m.closeAll(closeNow)
+	return ok
+}
+
+// Sweep drops the sandboxes that have been idle for longer than the idle
+// timeout and returns how many it dropped
+func (m *Manager[S]) Sweep() int {
+	m.mu.Lock()
+	cutoff := m.now().Add(-m.idle)
+	var idle []*entry[S]
+	for _, e := range m.sandboxes {
+		if isReady(e) && e.refs == 0 && e.info.LastUsed.Before(cutoff) {
+			idle = append(idle, e)
+		}
+	}
+	closeNow := m.drop(idle, "idle")
+	m.mu.Unlock()
+	m.closeAll(closeNow)
+	return len(idle)
+}
+
+// Run sweeps idle sandboxes until ctx is done
+func (m *Manager[S]) Run(ctx context.Context) {
+	interval := min(max(m.IdleTimeout()/4, time.Second), time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Sweep()
+		}
+	}
+}
+
+// Close drops every sandbox
+func (m *Manager[S]) Close() {
+	m.mu.Lock()
+	var all []*entry[S]
+	for _, e := range m.sandboxes {
+		if isReady(e) {
+			all = append(all, e)
+		}
+	}
+	closeNow := m.drop(all, "shutdown")
+	m.mu.Unlock()
+	m.closeAll(closeNow)
+}
+
+// closeAll closes dropped sandboxes
+func (m *Manager[S]) closeAll(entries []*entry[S]) {
+	for _, e := range entries {
+		m.close(e.info.ID, e.sandbox)
+	}
+}
+
+// close releases a dropped sandbox
+func (m *Manager[S]) close(id string, sandbox S) {
+	if err := sandbox.Close(); err != nil {
+		slog.Error("failed to close sandbox", "tenant", id, "error", err)
+	}
+}
+
+// isReady reports whether an entry's sandbox has been created
+func isReady[S Sandbox](e *entry[S]) bool {
+	select {
+	case <-e.ready:
+		return e.err == nil
+	default:
+		return false
+	}
+}
+
+// Middleware serves requests belonging to a tenant from the tenant's
+// sandbox, except for paths starting with one of skip. Requests naming no
+// tenant go on to the shared server.
+func (m *Manager[S]) Middleware(skip ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range skip {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next(w, r)
+					return
+				}
+			}
+			info, sandbox, release, ok, err := m.Resolve(w, r)
+			if err != nil {
+				WriteError(w, r, err)
+				return
+			}
+			if !ok {
+				next(w, r)
+				return
+			}
+			defer release()
+			middleware.SetTenant(r.Context(), info.ID)
+			sandbox.ServeHTTP(w, r)
+		}
+	}
+}
+
+// WriteError answers a request whose sandbox could not be resolved. These
+// errors are the server's own, so the status codes are honest.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	status, response := http.StatusInternalServerError, models.APIResponse{
+		Error:  "Failed to create sandbox",
+		Status: "SANDBOX_ERROR",
+	}
+	switch {
+	case errors.Is(err, ErrInvalidID):
+		status, response = http.StatusBadRequest, models.APIResponse{Error: err.Error(), Status: "BAD_REQUEST"}
+	case errors.Is(err, ErrFull):
+		w.Header().Set("Retry-After", "60")
+		status, response = http.StatusServiceUnavailable, models.APIResponse{
+			Error:  "Too many sandboxes, try again when an idle one has been cleaned up",
+			Status: "SANDBOXES_FULL",
+		}
+	default:
+		slog.ErrorContext(r.Context(), "failed to create sandbox", "error", err)
+	}
+	response.RequestID = middleware.RequestIDFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
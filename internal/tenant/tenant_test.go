@@ -0,0 +1,250 @@
+package tenant
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeSandbox answers with its tenant ID and remembers being closed
+type fakeSandbox struct {
+	id     string
+	closed bool
+}
+
+func (s *fakeSandbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(s.id))
+}
+
+func (s *fakeSandbox) Close() error {
+	s.closed = true
+	return nil
+}
+
+// newTestManager returns a manager of fake sandboxes and the ones it created
+func newTestManager(t *testing.T, key string) (*Manager[*fakeSandbox], map[string]*fakeSandbox) {
+	t.Helper()
+	k, err := ParseKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := map[string]*fakeSandbox{}
+	m := NewManager(k, func(id string) (*fakeSandbox, error) {
+		s := &fakeSandbox{id: id}
+		created[id] = s
+		return s, nil
+	})
+	return m, created
+}
+
+func TestKeyID(t *testing.T) {
+	tests := []struct {
+		key     string
+		prepare func(*http.Request)
+		want    string
+		wantErr bool
+	}{
+		{"header", func(r *http.Request) { r.Header.Set("X-Tenant", "ana") }, "ana", false},
+		{"header:X-Team", func(r *http.Request) { r.Header.Set("X-Team", " blue ") }, "blue", false},
+		{"header", func(r *http.Request) {}, "", false},
+		{"header", func(r *http.Request) { r.Header.Set("X-Tenant", "../etc") }, "", true},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "sandbox", Value: "s1"}) }, "s1", false},
+		{"subdomain", func(r *http.Request) { r.Host = "ana.localhost:3000" }, "ana", false},
+		{"subdomain", func(r *http.Request) { r.Host = "localhost:3000" }, "", false},
+		{"subdomain:workshop.example.com", func(r *http.Request) { r.Host = "Bo.Workshop.Example.com" }, "bo", false},
+		{"subdomain", func(r *http.Request) { r.Host = "a.b.localhost" }, "", true},
+	}
+	for _, tt := range tests {
+		key, err := ParseKey(tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/api/articles", nil)
+		tt.prepare(r)
+		got, err := key.ID(r)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: ID() = %q, %v; want %q", tt.key, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "query:tenant", "ip"} {
+		if _, err := ParseKey(bad); err == nil {
+			t.Errorf("ParseKey(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m, created := newTestManager(t, "header")
+	shared := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("shared")) }
+	handler := m.Middleware("/metrics")(shared)
+
+	do := func(path, tenant string) string {
+		r := httptest.NewRequest("GET", path, nil)
+		if tenant != "" {
+			r.Header.Set("X-Tenant", tenant)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		return rec.Body.String()
+	}
+
+	if got := do("/api/articles", "ana"); got != "ana" {
+		t.Errorf("ana was served by %q", got)
+	}
+	if got := do("/api/articles", "ana"); got != "ana" || len(created) != 1 {
+		t.Errorf("second request: served by %q with %d sandboxes, want ana's sandbox again", got, len(created))
+	}
+	if got := do("/api/articles", ""); got != "shared" {
+		t.Errorf("request without a tenant was served by %q", got)
+	}
+	if got := do("/metrics", "ana"); got != "shared" {
+		t.Errorf("skipped path was served by %q", got)
+	}
+	if info, _, _ := m.Get("ana"); info.Requests != 2 {
+		t.Errorf("ana made %d requests, want 2", info.Requests)
+	}
+	var each []string
+	m.Each(func(s *fakeSandbox) { each = append(each, s.id) })
+	if len(each) != 1 || each[0] != "ana" {
+		t.Errorf("Each() visited %v, want only ana's sandbox", each)
+	}
+}
+
+func TestCookieAssignsSandbox(t *testing.T) {
+	m, created := newTestManager(t, "cookie")
+
+	// A client without the cookie gets one, but no sandbox yet
+	rec := httptest.NewRecorder()
+	if _, _, _, ok, err := m.Resolve(rec, httptest.NewRequest("GET", "/", nil)); ok || err != nil {
+		t.Fatalf("Resolve() without a cookie = %v, %v; want no sandbox", ok, err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "sandbox" || len(created) != 0 {
+		t.Fatalf("cookies = %v with %d sandboxes, want one cookie and no sandbox", cookies, len(created))
+	}
+
+	// A client that keeps no cookies never fills the sandbox limit
+	for range 10 {
+		m.Resolve(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if len(created) != 0 {
+		t.Errorf("%d sandboxes created for clients without cookies", len(created))
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	_, sandbox, release, ok, err := m.Resolve(httptest.NewRecorder(), r)
+	if err != nil || !ok {
+		t.Fatalf("Resolve() with the cookie = %v, %v", ok, err)
+	}
+	defer release()
+	if created[cookies[0].Value] != sandbox {
+		t.Errorf("the cookie %s does not name the new sandbox", cookies[0].Value)
+	}
+}
+
+func TestRemoveWaitsForRequests(t *testing.T) {
+	m, created := newTestManager(t, "header")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant", "ana")
+	_, _, release, _, _ := m.Resolve(httptest.NewRecorder(), r)
+
+	if !m.Remove("ana") {
+		t.Fatal("Remove() did not find ana's sandbox")
+	}
+	if created["ana"].closed {
+		t.Error("the sandbox was closed while a request was still using it")
+	}
+	release()
+	release()
+	if !created["ana"].closed {
+		t.Error("the sandbox was not closed once the request was done")
+	}
+}
+
+func TestCreateOutsideTheLock(t *testing.T) {
+	k, _ := ParseKey("header")
+	slow := make(chan struct{})
+	calls := make(chan string, 3)
+	m := NewManager(k, func(id string) (*fakeSandbox, error) {
+		calls <- id
+		if id == "slow" {
+			<-slow
+		}
+		return &fakeSandbox{id: id}, nil
+	})
+	resolve := func(id string) error {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant", id)
+		_, sandbox, release, _, err := m.Resolve(httptest.NewRecorder(), r)
+		if err == nil {
+			defer release()
+			if sandbox.id != id {
+				t.Errorf("%s got the sandbox of %s", id, sandbox.id)
+			}
+		}
+		return err
+	}
+
+	done := make(chan error, 2)
+	go func() { done <- resolve("slow") }()
+	<-calls
+	go func() { done <- resolve("slow") }()
+
+	// Another tenant is not held up by the slow one
+	if err := resolve("fast"); err != nil {
+		t.Fatal(err)
+	}
+	close(slow)
+	for range 2 {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(calls) != 1 {
+		t.Errorf("created %d more sandboxes, want only fast's: the second slow request waits for the first", len(calls)-1)
+	}
+}
+
+func TestLimitAndSweep(t *testing.T) {
+	m, created := newTestManager(t, "header")
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	m.SetClock(func() time.Time { return now })
+	m.SetLimit(2)
+	m.SetIdleTimeout(10 * time.Minute)
+
+	resolve := func(id string) error {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant", id)
+		_, _, release, _, err := m.Resolve(httptest.NewRecorder(), r)
+		if err == nil {
+			release()
+		}
+		return err
+	}
+	resolve("ana")
+	now = now.Add(5 * time.Minute)
+	resolve("bo")
+	if err := resolve("cy"); !errors.Is(err, ErrFull) {
+		t.Fatalf("third sandbox: err = %v, want ErrFull", err)
+	}
+
+	now = now.Add(6 * time.Minute)
+	if n := m.Sweep(); n != 1 || !created["ana"].closed || created["bo"].closed {
+		t.Fatalf("Sweep() dropped %d, want only ana's idle sandbox", n)
+	}
+	if err := resolve("cy"); err != nil {
+		t.Errorf("after the sweep: %v", err)
+	}
+
+	if !m.Remove("bo") || !created["bo"].closed || m.Remove("bo") {
+		t.Error("Remove() did not drop bo's sandbox exactly once")
+	}
+	m.Close()
+	if !created["cy"].closed || len(m.List()) != 0 {
+		t.Error("Close() left sandboxes behind")
+	}
+}
@@ -0,0 +1,158 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// StdoutExporter writes each span as one JSON line
+type StdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutExporter creates a new StdoutExporter instance writing to w
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	return &StdoutExporter{w: w}
+}
+
+// Export writes the spans
+func (e *StdoutExporter) Export(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, span := range spans {
+		if err := enc.Encode(otlpSpan(span)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown does nothing; there is nothing to flush
+func (e *StdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP endpoint using the JSON encoding,
+// e.g. a local OpenTelemetry Collector at http://localhost:4318/v1/traces
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+}
+
+// NewOTLPExporter creates a new OTLPExporter instance
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{},
+	}
+}
+
+// Export posts the spans in one request
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	encoded := make([]map[string]any, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, otlpSpan(span))
+	}
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttributes([]Attribute{String("service.name", e.service)}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "strange-errors-server/internal/tracing"},
+				"spans": encoded,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build OTLP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("OTLP endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Shutdown does nothing; Export is synchronous
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// otlpSpan encodes a span the way OTLP/JSON expects: hex IDs and
+// nanosecond timestamps as strings
+func otlpSpan(span *Span) map[string]any {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	events := make([]map[string]any, 0, len(span.Events))
+	for _, ev := range span.Events {
+		events = append(events, map[string]any{
+			"name":         ev.Name,
+			"timeUnixNano": strconv.FormatInt(ev.Time.UnixNano(), 10),
+			"attributes":   otlpAttributes(ev.Attributes),
+		})
+	}
+
+	encoded := map[string]any{
+		"traceId":           span.TraceID.String(),
+		"spanId":            span.SpanID.String(),
+		"name":              span.Name,
+		"kind":              int(span.Kind),
+		"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+		"attributes":        otlpAttributes(span.Attributes),
+		"events":            events,
+		"status":            map[string]any{"code": int(span.Status), "message": span.StatusMsg},
+	}
+	if span.ParentID.IsValid() {
+		encoded["parentSpanId"] = span.ParentID.String()
+	}
+	return encoded
+}
+
+// otlpAttributes encodes attributes as OTLP key/value pairs
+func otlpAttributes(attrs []Attribute) []map[string]any {
+	encoded := make([]map[string]any, 0, len(attrs))
+	for _, attr := range attrs {
+		var value map[string]any
+		switch v := attr.Value.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]any{"key": attr.Key, "value": value})
+	}
+	return encoded
+}
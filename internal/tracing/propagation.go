@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent parses a W3C traceparent header value
+// ("00-<32 hex trace id>-<16 hex parent id>-<2 hex flags>")
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	var sc SpanContext
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || !sc.TraceID.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid trace id in traceparent %q", value)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || !sc.SpanID.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid parent id in traceparent %q", value)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid flags in traceparent %q", value)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// FormatTraceparent renders a span context as a W3C traceparent header value
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// Inject sets the traceparent header for an outgoing request made within span
+func Inject(span *Span, header http.Header) {
+	if span == nil {
+		return
+	}
+	header.Set(TraceparentHeader, FormatTraceparent(span.Context()))
+}
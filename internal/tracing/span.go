@@ -0,0 +1,208 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, SpanID a span within it
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+// String returns the lowercase hex form of the ID
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// String returns the lowercase hex form of the ID
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether the ID is not all zeroes
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// IsValid reports whether the ID is not all zeroes
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
+
+// SpanKind mirrors the OpenTelemetry span kinds used by this server
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// StatusCode mirrors the OpenTelemetry span status codes
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key/value pair attached to a span. Values are strings,
+// ints, int64s, float64s or bools.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute { return Attribute{key, value} }
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute { return Attribute{key, int64(value)} }
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute { return Attribute{key, value} }
+
+// Event is a timestamped annotation on a span
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+// Span is one timed operation in a trace. A nil *Span is valid and does
+// nothing, which is what Start returns while tracing is disabled.
+type Span struct {
+	mu         sync.Mutex
+	tracer     *Tracer
+	Name       string
+	Kind       SpanKind
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Events     []Event
+	Status     StatusCode
+	StatusMsg  string
+	ended      bool
+}
+
+// SetName renames the span, e.g. once the route of a request is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Name = name
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes = append(s.Attributes, attrs...)
+}
+
+// AddEvent records an event on the span
+func (s *Span) AddEvent(name string, attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Events = append(s.Events, Event{Name: name, Time: time.Now(), Attributes: attrs})
+}
+
+// SetStatus sets the span status
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Status = code
+	s.StatusMsg = msg
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.AddEvent("exception", String("exception.message", err.Error()))
+	s.SetStatus(StatusError, err.Error())
+}
+
+// Finish ends the span and hands it to the exporter. Only the first call counts.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	s.tracer.enqueue(s)
+}
+
+// SpanContext is the part of a span that crosses process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Context returns the span's propagation context
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.TraceID, SpanID: s.SpanID, Sampled: true}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span as the current span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span in ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemote returns a copy of ctx carrying a parent span context
+// received from another process
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// TraceIDFromContext returns the ID of the trace ctx belongs to, or ""
+func TraceIDFromContext(ctx context.Context) string {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.TraceID.String()
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Exporter sends finished spans somewhere
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer batches finished spans and exports them in the background
+type Tracer struct {
+	service  string
+	exporter Exporter
+	queue    chan *Span
+	done     chan struct{} // closed to ask the export loop to stop
+	stopped  chan struct{} // closed by the export loop once it has flushed
+	once     sync.Once
+}
+
+// batchSize and flushInterval bound how long a span waits before export
+const (
+	batchSize     = 128
+	flushInterval = 2 * time.Second
+)
+
+// NewTracer creates a new Tracer instance and starts its export loop
+func NewTracer(service string, exporter Exporter) *Tracer {
+	t := &Tracer{
+		service:  service,
+		exporter: exporter,
+		queue:    make(chan *Span, 4096),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// global is the tracer Start uses; nil disables tracing
+var global atomic.Pointer[Tracer]
+
+// SetTracer installs the tracer used by Start. Passing nil disables tracing.
+func SetTracer(t *Tracer) {
+	global.Store(t)
+}
+
+// Enabled reports whether a tracer is installed
+func Enabled() bool {
+	return global.Load() != nil
+}
+
+// Start begins a span as a child of the span in ctx, or of a remote parent
+// extracted from a traceparent header, or as a new trace. The returned
+// context carries the new span. While tracing is disabled the span is nil.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	t := global.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:     t,
+		Name:       name,
+		Kind:       kind,
+		SpanID:     newSpanID(),
+		Start:      time.Now(),
+		Attributes: attrs,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.TraceID.IsValid() {
+		span.TraceID = remote.TraceID
+		span.ParentID = remote.SpanID
+	} else {
+		span.TraceID = newTraceID()
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// enqueue hands a finished span to the export loop, dropping it if the queue is full
+func (t *Tracer) enqueue(span *Span) {
+	select {
+	case t.queue <- span:
+	default:
+		slog.Warn("trace queue full, dropping span", "span", span.Name)
+	}
+}
+
+// run exports spans in batches until Shutdown
+func (t *Tracer) run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			slog.Warn("failed to export spans", "spans", len(batch), "error", err)
+		}
+		cancel()
+		batch = nil
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown exports the remaining spans and stops the exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() { close(t.done) })
+	select {
+	case <-t.stopped:
+	case <-ctx.Done():
+	}
+	return t.exporter.Shutdown(ctx)
+}
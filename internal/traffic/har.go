@@ -0,0 +1,294 @@
+package traffic
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"strange-errors-server/internal/quirks"
+)
+
+// HAR is an HTTP Archive 1.2 document
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of a HAR document
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator names the application that wrote the archive
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one exchange. Fields starting with an underscore are custom
+// fields, which HAR 1.2 allows; they carry what the server knows about the
+// exchange that a browser would not.
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+
+	RequestID      string           `json:"_requestId,omitempty"`
+	Route          string           `json:"_route,omitempty"`
+	IntendedStatus int              `json:"_intendedStatus"`
+	Quirks         []quirks.Applied `json:"_quirks,omitempty"`
+}
+
+// HARRequest describes the request of an entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse describes the response of an entry
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie or query parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is a request body
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // non-standard, "base64" for binary bodies
+}
+
+// HARContent is a response body
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings splits the entry time; the server only knows how long it worked
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NewHAR converts exchanges into a HAR document
+func NewHAR(exchanges []Exchange) HAR {
+	har := HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "strange-errors-server", Version: "1.0"},
+		Entries: make([]HAREntry, 0, len(exchanges)),
+	}}
+	for _, e := range exchanges {
+		har.Log.Entries = append(har.Log.Entries, harEntry(e))
+	}
+	return har
+}
+
+// WriteHAR writes exchanges as a HAR 1.2 document
+func WriteHAR(w io.Writer, exchanges []Exchange) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(NewHAR(exchanges))
+}
+
+// ReadHAR reads the exchanges back from a HAR document. Archives written by
+// other tools work too; they just lack the custom fields.
+func ReadHAR(r io.Reader) ([]Exchange, error) {
+	var har HAR
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %w", err)
+	}
+	if har.Log.Version == "" {
+		return nil, fmt.Errorf("invalid HAR: missing log.version")
+	}
+
+	exchanges := make([]Exchange, 0, len(har.Log.Entries))
+	for i, entry := range har.Log.Entries {
+		e, err := entryExchange(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HAR entry %d: %w", i, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, nil
+}
+
+// entryExchange converts a HAR entry back into an exchange
+func entryExchange(entry HAREntry) (Exchange, error) {
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return Exchange{}, err
+	}
+	started, _ := time.Parse(time.RFC3339Nano, entry.StartedDateTime)
+	e := Exchange{
+		RequestID:       entry.RequestID,
+		StartedAt:       started,
+		Duration:        time.Duration(entry.Time * float64(time.Millisecond)),
+		Method:          entry.Request.Method,
+		Scheme:          u.Scheme,
+		Host:            u.Host,
+		Path:            u.Path,
+		Query:           u.RawQuery,
+		Route:           entry.Route,
+		RequestHeaders:  headersFromHAR(entry.Request.Headers),
+		Status:          entry.Response.Status,
+		ResponseHeaders: headersFromHAR(entry.Response.Headers),
+		Quirks:          entry.Quirks,
+	}
+	if entry.Request.PostData != nil {
+		if e.RequestBody, err = harBytes(entry.Request.PostData.Text, entry.Request.PostData.Encoding); err != nil {
+			return Exchange{}, err
+		}
+	}
+	if e.ResponseBody, err = harBytes(entry.Response.Content.Text, entry.Response.Content.Encoding); err != nil {
+		return Exchange{}, err
+	}
+	return e, nil
+}
+
+// headersFromHAR turns name/value pairs back into headers
+func headersFromHAR(pairs []HARNameValue) http.Header {
+	if len(pairs) == 0 {
+		return nil
+	}
+	h := make(http.Header)
+	for _, pair := range pairs {
+		h.Add(pair.Name, pair.Value)
+	}
+	return h
+}
+
+// harBytes decodes a body written by harText
+func harBytes(text, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return []byte(text), nil
+}
+
+// harEntry converts a single exchange
+func harEntry(e Exchange) HAREntry {
+	millis := float64(e.Duration.Microseconds()) / 1000
+	entry := HAREntry{
+		StartedDateTime: e.StartedAt.Format("2006-01-02T15:04:05.000Z07:00"),
+		Time:            millis,
+		Request: HARRequest{
+			Method:      e.Method,
+			URL:         exchangeURL(e),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(e.RequestHeaders),
+			QueryString: harQuery(e.Query),
+			HeadersSize: -1,
+			BodySize:    len(e.RequestBody),
+		},
+		Response: HARResponse{
+			Status:      e.Status,
+			StatusText:  http.StatusText(e.Status),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(e.ResponseHeaders),
+			Content: HARContent{
+				Size:     len(e.ResponseBody),
+				MimeType: e.ResponseHeaders.Get("Content-Type"),
+			},
+			HeadersSize: -1,
+			BodySize:    len(e.ResponseBody),
+		},
+		Timings:        HARTimings{Wait: millis},
+		RequestID:      e.RequestID,
+		Route:          e.Route,
+		IntendedStatus: e.IntendedStatus(),
+		Quirks:         e.Quirks,
+	}
+	entry.Response.Content.Text, entry.Response.Content.Encoding = harText(e.ResponseBody)
+	if len(e.RequestBody) > 0 {
+		text, encoding := harText(e.RequestBody)
+		entry.Request.PostData = &HARPostData{
+			MimeType: e.RequestHeaders.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+	}
+	return entry
+}
+
+// exchangeURL rebuilds the absolute URL of the request
+func exchangeURL(e Exchange) string {
+	u := url.URL{Scheme: e.Scheme, Host: e.Host, Path: e.Path, RawQuery: e.Query}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	if u.Host == "" {
+		u.Host = "localhost"
+	}
+	return u.String()
+}
+
+// harHeaders flattens headers into sorted name/value pairs
+func harHeaders(h http.Header) []HARNameValue {
+	out := []HARNameValue{}
+	for name, values := range h {
+		for _, value := range values {
+			out = append(out, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// harQuery splits a raw query string into name/value pairs
+func harQuery(raw string) []HARNameValue {
+	out := []HARNameValue{}
+	values, _ := url.ParseQuery(raw)
+	for name, vs := range values {
+		for _, value := range vs {
+			out = append(out, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// harText returns a body as text, base64-encoding it if it is not UTF-8
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
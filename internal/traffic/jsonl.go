@@ -0,0 +1,58 @@
+package traffic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WriteJSONL writes exchanges as one JSON object per line
+func WriteJSONL(w io.Writer, exchanges []Exchange) error {
+	enc := json.NewEncoder(w)
+	for _, e := range exchanges {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadJSONL reads exchanges written by WriteJSONL or a recording file.
+// Blank lines are skipped.
+func ReadJSONL(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 4*maxBodyCapture)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid exchange on line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, scanner.Err()
+}
+
+// ReadFile reads a recording, telling HAR archives and JSONL logs apart by
+// their content
+func ReadFile(path string) ([]Exchange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A HAR archive is a single object with a "log" member
+	var probe struct {
+		Log json.RawMessage `json:"log"`
+	}
+	if json.Unmarshal(data, &probe) == nil && probe.Log != nil {
+		return ReadHAR(bytes.NewReader(data))
+	}
+	return ReadJSONL(bytes.NewReader(data))
+}
@@ -0,0 +1,163 @@
+package traffic
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"strange-errors-server/internal/quirks"
+)
+
+// Exchange is one recorded request/response pair. Headers and the request
+// body are only kept when the log does full captures.
+type Exchange struct {
+	RequestID       string           `json:"request_id"`
+	StartedAt       time.Time        `json:"started_at"`
+	Duration        time.Duration    `json:"duration_ns"`
+	Method          string           `json:"method"`
+	Scheme          string           `json:"scheme,omitempty"`
+	Host            string           `json:"host,omitempty"`
+	Path            string           `json:"path"`
+	Query           string           `json:"query,omitempty"`
+	Route           string           `json:"route,omitempty"`
+	Trainee         string           `json:"trainee,omitempty"`
+	Tenant          string           `json:"tenant,omitempty"`
+	RequestHeaders  http.Header      `json:"request_headers,omitempty"`
+	RequestBody     []byte           `json:"request_body,omitempty"`
+	Status          int              `json:"status"`
+	ResponseHeaders http.Header      `json:"response_headers,omitempty"`
+	ResponseBody    []byte           `json:"response_body,omitempty"`
+	Quirks          []quirks.Applied `json:"quirks,omitempty"`
+}
+
+// IntendedStatus returns the status code an honest server would have sent
+func (e Exchange) IntendedStatus() int {
+	if len(e.Quirks) > 0 {
+		return e.Quirks[len(e.Quirks)-1].Intended
+	}
+	return e.Status
+}
+
+// Log keeps the most recent exchanges in a ring buffer
+type Log struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	next      int
+	full      bool
+	capture   bool      // keep headers and request bodies too
+	sink      io.Writer // every exchange is also appended here as JSONL
+	now       func() time.Time
+	watchers  map[chan struct{}]struct{}
+}
+
+// NewLog creates a new Log instance holding up to capacity exchanges
+func NewLog(capacity int) *Log {
+	return &Log{exchanges: make([]Exchange, max(capacity, 1)), now: time.Now}
+}
+
+// SetClock sets where the log gets the start time of exchanges from
+func (l *Log) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+}
+
+// clock returns the current time according to the log's clock
+func (l *Log) clock() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.now()
+}
+
+// SetFullCapture makes the log keep request and response headers and request
+// bodies, enough to hand a session in as evidence or replay it
+func (l *Log) SetFullCapture(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.capture = enabled
+}
+
+// FullCapture reports whether the log keeps headers and request bodies
+func (l *Log) FullCapture() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.capture
+}
+
+// SetSink appends every exchange added from now on to w as a JSON line, so
+// that a recording outlives the ring buffer and the process
+func (l *Log) SetSink(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sink = w
+}
+
+// Add records an exchange, evicting the oldest one when the log is full
+func (l *Log) Add(e Exchange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sink != nil {
+		if err := json.NewEncoder(l.sink).Encode(e); err != nil {
+			slog.Error("failed to write exchange to recording", "request_id", e.RequestID, "error", err)
+		}
+	}
+	l.exchanges[l.next] = e
+	l.next = (l.next + 1) % len(l.exchanges)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.notify()
+}
+
+// Watch returns a channel that receives a value whenever exchanges are added
+// or the log is reset. Notifications are coalesced, so a slow reader sees
+// one for any number of changes. Call stop to release the channel.
+func (l *Log) Watch() (changes <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watchers == nil {
+		l.watchers = make(map[chan struct{}]struct{})
+	}
+	l.watchers[ch] = struct{}{}
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.watchers, ch)
+	}
+}
+
+// notify wakes up the watchers; caller must hold l.mu
+func (l *Log) notify() {
+	for ch := range l.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Exchanges returns the recorded exchanges, oldest first
+func (l *Log) Exchanges() []Exchange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]Exchange(nil), l.exchanges[:l.next]...)
+	}
+	out := make([]Exchange, 0, len(l.exchanges))
+	out = append(out, l.exchanges[l.next:]...)
+	return append(out, l.exchanges[:l.next]...)
+}
+
+// Reset forgets every recorded exchange
+func (l *Log) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.exchanges)
+	l.next = 0
+	l.full = false
+	l.notify()
+}
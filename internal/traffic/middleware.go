@@ -0,0 +1,190 @@
+package traffic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/quirks"
+)
+
+// maxBodyCapture is how much of each request and response body is kept
+const maxBodyCapture = 64 << 10
+
+// TraineeHeader names the trainee behind a request when nobody is logged in,
+// so that challenge mode can tell workshop participants apart
+const TraineeHeader = "X-Trainee"
+
+// maxTraineeName caps the trainee names taken from TraineeHeader
+const maxTraineeName = 64
+
+// redactedHeaders are replaced in recordings so that evidence can be shared
+// without handing out credentials
+var redactedHeaders = []string{"Authorization", "X-API-Key", "Cookie", "Set-Cookie"}
+
+// redactedFields are masked wherever they appear in a JSON body, such as the
+// password sent to POST /api/login and the token it answers with
+var redactedFields = []string{"password", "token", "api_key"}
+
+// captureWriter records the status code and the start of the body
+type captureWriter struct {
+	*middleware.LoggingResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader captures the status code
+func (cw *captureWriter) WriteHeader(code int) {
+	cw.status = code
+	cw.LoggingResponseWriter.WriteHeader(code)
+}
+
+// Write captures up to maxBodyCapture bytes of the body
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if room := maxBodyCapture - cw.body.Len(); room > 0 {
+		cw.body.Write(b[:min(len(b), room)])
+	}
+	return cw.LoggingResponseWriter.Write(b)
+}
+
+// Record is a middleware that adds every exchange to the log, except for
+// paths starting with one of skip. It relies on LogRequest further out for
+// the request ID, the matched route and the applied quirks.
+func Record(log *Log, skip ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range skip {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					handler(w, r)
+					return
+				}
+			}
+
+			capture := log.FullCapture()
+			var requestBody []byte
+			if capture && r.Body != nil {
+				requestBody = captureBody(r)
+			}
+
+			startedAt := log.clock()
+			start := time.Now()
+			cw := &captureWriter{
+				LoggingResponseWriter: middleware.NewLoggingResponseWriter(w),
+				status:                http.StatusOK,
+			}
+
+			handler(cw, r)
+
+			e := Exchange{
+				RequestID:    middleware.RequestIDFromContext(r.Context()),
+				StartedAt:    startedAt,
+				Duration:     time.Since(start),
+				Method:       r.Method,
+				Scheme:       scheme(r),
+				Host:         r.Host,
+				Path:         r.URL.Path,
+				Query:        r.URL.RawQuery,
+				Status:       cw.status,
+				ResponseBody: redactBody(bytes.Clone(cw.body.Bytes())),
+			}
+			if capture {
+				e.RequestHeaders = redact(r.Header)
+				e.RequestBody = redactBody(requestBody)
+				e.ResponseHeaders = redact(cw.Header())
+			}
+			e.Trainee = strings.TrimSpace(r.Header.Get(TraineeHeader))
+			if info, ok := middleware.InfoFromContext(r.Context()); ok {
+				e.Route = info.MatchedRoute()
+				e.Tenant = info.TenantID()
+				if user := info.AuthenticatedUser(); user != "" {
+					e.Trainee = user
+				} else if e.Trainee == "" {
+					e.Trainee = e.Tenant
+				}
+			}
+			if len(e.Trainee) > maxTraineeName {
+				e.Trainee = e.Trainee[:maxTraineeName]
+			}
+			if rec, ok := quirks.RecorderFromContext(r.Context()); ok {
+				e.Quirks = rec.Applied()
+			}
+			log.Add(e)
+		}
+	}
+}
+
+// captureBody reads up to maxBodyCapture bytes of the request body and puts
+// them back in front of whatever is left, so the handler still sees it all
+func captureBody(r *http.Request) []byte {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyCapture))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+// scheme returns the URL scheme the request arrived with
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// redact returns a copy of h with credentials masked
+func redact(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range redactedHeaders {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out.Set(name, "[redacted]")
+		}
+	}
+	return out
+}
+
+// redactBody returns a JSON body with the values of redactedFields masked,
+// at any depth. Anything that is not JSON is returned as it is.
+func redactBody(body []byte) []byte {
+	var v any
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil || !redactValue(v) {
+		return body
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// redactValue masks redactedFields in a decoded JSON value, reporting
+// whether it found any
+func redactValue(v any) bool {
+	found := false
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if slices.ContainsFunc(redactedFields, func(field string) bool { return strings.EqualFold(field, key) }) {
+				v[key] = "[redacted]"
+				found = true
+			} else if redactValue(value) {
+				found = true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if redactValue(value) {
+				found = true
+			}
+		}
+	}
+	return found
+}
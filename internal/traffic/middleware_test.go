@@ -0,0 +1,57 @@
+package traffic
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordRedactsCredentials(t *testing.T) {
+	log := NewLog(10)
+	log.SetFullCapture(true)
+	var seen string
+	handler := Record(log)(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"eyJ.secret.jwt","user":{"name":"ana","api_key":"sk-secret"}}`))
+	})
+
+	req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"name":"ana","password":"hunter2"}`))
+	req.Header.Set("Authorization", "Bearer old-token")
+	handler(httptest.NewRecorder(), req)
+
+	if !strings.Contains(seen, "hunter2") {
+		t.Errorf("the handler got %q, want the password untouched", seen)
+	}
+	exchanges := log.Exchanges()
+	if len(exchanges) != 1 {
+		t.Fatalf("%d exchanges recorded, want 1", len(exchanges))
+	}
+	e := exchanges[0]
+	recorded := string(e.RequestBody) + string(e.ResponseBody) + e.RequestHeaders.Get("Authorization")
+	for _, secret := range []string{"hunter2", "eyJ.secret.jwt", "sk-secret", "old-token"} {
+		if strings.Contains(recorded, secret) {
+			t.Errorf("%q was recorded: %s", secret, recorded)
+		}
+	}
+	var request map[string]string
+	if err := json.Unmarshal(e.RequestBody, &request); err != nil || request["name"] != "ana" || request["password"] != "[redacted]" {
+		t.Errorf("request body %s, want the name kept and the password masked", e.RequestBody)
+	}
+}
+
+func TestRedactBodyLeavesOtherBodiesAlone(t *testing.T) {
+	for _, body := range []string{
+		`{"title":"T","content":"C"}`,
+		`not JSON, password=hunter2`,
+		``,
+	} {
+		if got := string(redactBody([]byte(body))); got != body {
+			t.Errorf("redactBody(%q) = %q, want it unchanged", body, got)
+		}
+	}
+}
@@ -1,13 +1,36 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/challenge"
 	"strange-errors-server/internal/config"
 	"strange-errors-server/internal/database"
 	"strange-errors-server/internal/handlers"
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/mock"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/openapi"
+	"strange-errors-server/internal/proxy"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/replay"
+	"strange-errors-server/internal/tenant"
+	"strange-errors-server/internal/tracing"
+	"strange-errors-server/internal/traffic"
 
 	_ "strange-errors-server/docs" // This is the generated docs package
 )
@@ -28,38 +51,256 @@ import (
 // @BasePath /
 // @schemes http
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Bearer token from POST /api/login, sent as "Bearer <token>"
+
 // @tag.name articles
 // @tag.description Article management operations
 
 // @tag.name users
 // @tag.description User management operations
 
+// @tag.name auth
+// @tag.description Authentication operations
+
+// @tag.name reports
+// @tag.description Reports built from recorded traffic
+
+// @tag.name admin
+// @tag.description Administration of recorded traffic and sandboxes
+
 // @tag.name health
 // @tag.description Health check and GOAT method operations
 
+// @tag.name challenge
+// @tag.description Challenge mode: defect catalog, submissions, scores and the instructor dashboard
+
+// @tag.name sandbox
+// @tag.description Per-tenant sandboxes with their own data, GOAT and quirk profile
+
 func main() {
-	fmt.Println("🚀 Starting Strange Errors Server in Go...")
-	
+	os.Exit(run(os.Args[1:]))
+}
+
+// runServe implements "strange-errors-server serve", the default command:
+// it runs the server until it is stopped and returns the exit code
+func runServe(args []string) int {
 	// Load configuration
-	cfg := config.LoadConfig()
-	
+	cfg, loader, code := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), args)
+	if cfg == nil {
+		return code
+	}
+
+	fmt.Println("🚀 Starting Strange Errors Server in Go...")
+
+	// Set up structured logging; the standard log package goes through it too
+	logger, err := middleware.NewLogger(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serve: invalid logging configuration: %v\n", err)
+		return 2
+	}
+	slog.SetDefault(logger)
+
+	code, err = startServer(cfg, loader)
+	if err != nil {
+		slog.Error("failed to start server", "error", err)
+		return 1
+	}
+	return code
+}
+
+// startServer sets the server up as configured and serves until it is
+// stopped. Whatever it opened is closed when it returns, also when setting
+// up fails part way: pending spans are flushed, delayed deletes cancelled,
+// and the recording file and database closed.
+func startServer(cfg *config.Config, loader *config.Loader) (int, error) {
+	// Set up tracing if configured
+	tracer, err := newTracer(cfg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tracing configuration: %w", err)
+	}
+	if tracer != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+			if err := tracer.Shutdown(ctx); err != nil {
+				slog.Error("failed to flush spans", "error", err)
+			}
+		}()
+	}
+
 	// Initialize database
 	db, err := database.New(cfg.DBPath)
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		return 0, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			slog.Error("failed to close database", "error", err)
+		}
+	}()
+
+	// Make sure there is an admin to hand out roles
+	if cfg.AdminPassword != "" {
+		if err := ensureAdmin(db, cfg.AdminPassword); err != nil {
+			return 0, fmt.Errorf("failed to create admin user: %w", err)
+		}
+	}
+
+	// Set up authentication
+	authenticator, err := newAuthenticator(cfg, db)
+	if err != nil {
+		return 0, fmt.Errorf("invalid auth configuration: %w", err)
 	}
-	defer db.Close()
-	
+
 	// Create handlers
 	handler := handlers.New(db)
+	defer handler.Close()
 	goatHandler := handlers.NewGoatHandler()
-	
+	if database.IsMemory(cfg.DBPath) {
+		goatHandler.SetDestroyFunc(func() error { return db.Clear(context.Background()) })
+	} else {
+		goatHandler.SetDatabasePath(cfg.DBPath)
+	}
+	goatShutdown := make(chan struct{})
+	goatHandler.SetShutdownFunc(sync.OnceFunc(func() { close(goatShutdown) }))
+	authHandler := handlers.NewAuthHandler(db, authenticator, cfg.AuthRequired)
+	authHandler.SetOwnershipChecks(!cfg.IDORBug)
+
 	// Create router
-	router := handlers.NewRouter(handler, goatHandler)
-	
+	router := handlers.NewRouter(handler, goatHandler, authHandler)
+	profile, err := quirks.ByName(cfg.QuirkProfile)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quirk profile: %w", err)
+	}
+	router.SetQuirkProfile(profile)
+
+	// Keep recent traffic around for the classification report
+	trafficLog := traffic.NewLog(cfg.TrafficBuffer)
+	router.Use(traffic.Record(trafficLog, handlers.LocalPaths...))
+	reportHandler := handlers.NewReportHandler(trafficLog)
+	router.AddRoute(handlers.Route{Method: "GET", Pattern: "/api/reports/classification", Handler: reportHandler.ClassificationHandler})
+
+	// Full recordings can be downloaded as evidence
+	if cfg.RecordTraffic {
+		recording, err := startRecording(trafficLog, cfg.RecordFile)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open recording file: %w", err)
+		}
+		if recording != nil {
+			defer recording.Close()
+		}
+		recordingHandler := handlers.NewRecordingHandler(trafficLog)
+		router.AddRoute(handlers.Route{Method: "GET", Pattern: "/api/admin/recording", Handler: authHandler.Protect(recordingHandler.DownloadHandler, models.RoleAdmin)})
+		router.AddRoute(handlers.Route{Method: "DELETE", Pattern: "/api/admin/recording", Handler: authHandler.Protect(recordingHandler.ResetHandler, models.RoleAdmin)})
+	}
+
+	// Score trainees hunting for the planted defects if configured
+	var dashboard *handlers.DashboardHandler
+	if cfg.ChallengeMode {
+		board := challenge.NewBoard(trafficLog, challenge.Catalog(optionalQuirks(cfg)...))
+		challengeHandler := handlers.NewChallengeHandler(board)
+		dashboard = handlers.NewDashboardHandler(board, trafficLog, goatHandler)
+		for _, route := range append(challengeHandler.Routes(authHandler), dashboard.Routes()...) {
+			router.AddRoute(route)
+		}
+	}
+
+	// Answer from a recorded session if configured
+	if cfg.ReplayFile != "" {
+		replayer, err := newReplayer(cfg)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load replay file: %w", err)
+		}
+		router.Use(replayer.Middleware(handlers.LocalPaths...))
+		fmt.Printf("⏪ Replaying %d recorded requests from %s (on miss: %s)\n", replayer.Len(), cfg.ReplayFile, cfg.ReplayMiss)
+	}
+
+	// Put the quirks in front of a real API if configured
+	var upstream *proxy.Proxy
+	if cfg.ProxyUpstream != "" {
+		upstream, err = newProxy(cfg, profile)
+		if err != nil {
+			return 0, fmt.Errorf("invalid proxy configuration: %w", err)
+		}
+		upstream.SetMethodOverride("GOAT", goatHandler.Handle)
+		router.Use(upstream.Middleware(handlers.LocalPaths...))
+		fmt.Printf("🔀 Proxying to %s (latency: %s + up to %s)\n", cfg.ProxyUpstream, cfg.ProxyLatency, cfg.ProxyJitter)
+	}
+
+	// Serve the examples of an API description if configured
+	var mocker *mock.Mock
+	if cfg.MockSpec != "" {
+		doc, err := openapi.Load(cfg.MockSpec)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load mock spec: %w", err)
+		}
+		mocker = mock.New(doc, profile)
+		router.Use(mocker.Middleware(handlers.LocalPaths...))
+		fmt.Printf("🎭 Mocking %d operations from %s (%s)\n", mocker.Len(), cfg.MockSpec, doc.Title)
+	}
+
+	// Set up rate limiting; the limiter is always installed so that limits
+	// can be switched on by a configuration reload
+	limiterConfig, err := rateLimiterConfig(cfg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate limit configuration: %w", err)
+	}
+	limiter := middleware.NewRateLimiter(limiterConfig)
+	limiter.SetIdentifier(func(r *http.Request) (string, bool) {
+		user, ok := authenticator.Identity(r)
+		if !ok {
+			return "", false
+		}
+		return strconv.Itoa(user.ID), true
+	})
+	router.SetRateLimiter(limiter)
+
+	// Give every tenant a sandbox of its own if configured
+	var tenants *tenant.Manager[*handlers.Sandbox]
+	if cfg.TenantKey != "" {
+		tenants, err = newTenants(cfg, db, router, limiter)
+		if err != nil {
+			return 0, fmt.Errorf("failed to set up sandboxes: %w", err)
+		}
+		router.Use(tenants.Middleware(handlers.LocalPaths...))
+		sandboxHandler := handlers.NewSandboxHandler(tenants)
+		for _, route := range sandboxHandler.Routes(authHandler) {
+			router.AddRoute(route)
+		}
+	}
+	if cfg.RateLimit > 0 || cfg.RateLimitRoutes != "" {
+		fmt.Printf("🚦 Rate limiting enabled (mode: %s, key: %s)\n", cfg.RateLimitMode, cfg.RateLimitKey)
+	}
+	if cfg.RecordTraffic {
+		fmt.Println("📼 Recording full exchanges - download them from GET /api/admin/recording")
+	}
+	if tracer != nil {
+		fmt.Printf("🔭 Tracing enabled (exporter: %s)\n", cfg.TracingExporter)
+	}
+	if cfg.AuthRequired {
+		fmt.Printf("🔐 Authentication required for article changes (failure mode: %s)\n", cfg.AuthFailureMode)
+	}
+	if cfg.IDORBug {
+		fmt.Println("🕳️  Ownership checks disabled - editors can delete any article (IDOR)")
+	}
+	if tenants != nil {
+		store := "in memory"
+		if cfg.TenantDir != "" {
+			store = "in " + cfg.TenantDir
+		}
+		fmt.Printf("🏠 Sandbox per tenant (key: %s, store: %s, dropped after %s idle)\n", tenants.Key(), store, cfg.TenantIdleTimeout)
+	}
+	if cfg.ChallengeMode {
+		fmt.Println("🏆 Challenge mode - report defects to POST /api/challenge/submissions")
+		fmt.Printf("📺 Instructor dashboard at http://localhost%s/api/challenge/dashboard\n", cfg.Port)
+	}
+
 	// Set up routes with logging middleware
 	httpHandler := router.SetupRoutes()
-	
+
 	fmt.Printf("🌐 Server running on http://localhost%s\n", cfg.Port)
 	fmt.Println("📝 Demonstrating various error handling fallacies")
 	fmt.Println("🔗 Available endpoints:")
@@ -67,14 +308,247 @@ func main() {
 	fmt.Println("   POST /api/article - Create article (returns 888/999 instead of 201/400)")
 	fmt.Println("   DELETE /api/article/{id} - Delete article (returns 666 instead of 404)")
 	fmt.Println("   POST /api/user - Create user (idempotent POST - returns 201/400)")
+	fmt.Println("   POST /api/login - Log in (returns a bearer token)")
 	fmt.Println("   GET  /api/health-check - Regular health check")
 	fmt.Println("   GOAT /api/health-check - GOAT method (annoying server behavior)")
+	fmt.Println("   GET  /metrics - Prometheus metrics")
+	fmt.Println("   GET  /api/reports/classification - How monitoring would count the traffic so far")
+	fmt.Println("   GET  /openapi.json - OpenAPI 3.1 document of what the server really does")
 	fmt.Println("   GET  /swagger/ - Swagger API documentation")
 	fmt.Println("")
 	fmt.Println("🐐 Try the GOAT method:")
 	fmt.Printf("   curl -X GOAT http://localhost%s/api/health-check\n", cfg.Port)
 	fmt.Println("📚 View API documentation:")
 	fmt.Printf("   http://localhost%s/swagger/\n", cfg.Port)
-	
-	log.Fatal(http.ListenAndServe(cfg.Port, httpHandler))
-}
\ No newline at end of file
+
+	server := &http.Server{
+		Addr:              cfg.Port,
+		Handler:           httpHandler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if dashboard != nil {
+		server.RegisterOnShutdown(dashboard.Close)
+	}
+
+	// Pick up new quirk profiles, rate limits and planted faults without
+	// restarting
+	live := &liveConfig{
+		loader:        loader,
+		current:       cfg,
+		router:        router,
+		limiter:       limiter,
+		authenticator: authenticator,
+		authHandler:   authHandler,
+		upstream:      upstream,
+		mocker:        mocker,
+		tenants:       tenants,
+	}
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	go live.watch(reloadCtx)
+	if file := loader.File(); file != "" {
+		fmt.Printf("♻️  Reloading %s on change or SIGHUP\n", file)
+	}
+
+	if tenants != nil {
+		// Sandboxes are dropped once the server has drained
+		defer tenants.Close()
+		sweepCtx, stopSweep := context.WithCancel(context.Background())
+		defer stopSweep()
+		go tenants.Run(sweepCtx)
+	}
+
+	return serve(server, goatShutdown, cfg.ShutdownTimeout), nil
+}
+
+// serve runs the server until it fails, receives SIGINT/SIGTERM or the GOAT
+// loses its temper, then drains in-flight requests. It returns the process
+// exit code.
+func serve(server *http.Server, goatShutdown <-chan struct{}, timeout time.Duration) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		slog.Error("server failed", "error", err)
+		return 1
+	case <-ctx.Done():
+		slog.Info("shutdown signal received, draining in-flight requests")
+	case <-goatShutdown:
+		// The GOAT still takes the server down, just politely
+		slog.Warn("the GOAT has had enough, draining in-flight requests")
+		exitCode = 1
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("graceful shutdown timed out", "error", err)
+		server.Close()
+		exitCode = 1
+	}
+	slog.Info("server stopped")
+	return exitCode
+}
+
+// startRecording switches the traffic log to full captures and, if path is
+// set, appends every exchange to that file as JSONL and returns the file for
+// the caller to close. Every line is written unbuffered.
+func startRecording(trafficLog *traffic.Log, path string) (*os.File, error) {
+	trafficLog.SetFullCapture(true)
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	trafficLog.SetSink(f)
+	return f, nil
+}
+
+// newReplayer loads the recording described by the configuration
+func newReplayer(cfg *config.Config) (*replay.Replayer, error) {
+	miss, err := replay.ParseMissMode(cfg.ReplayMiss)
+	if err != nil {
+		return nil, err
+	}
+	exchanges, err := traffic.ReadFile(cfg.ReplayFile)
+	if err != nil {
+		return nil, err
+	}
+	return replay.NewReplayer(exchanges, miss), nil
+}
+
+// newProxy builds the reverse proxy described by the configuration
+func newProxy(cfg *config.Config, profile *quirks.Profile) (*proxy.Proxy, error) {
+	upstream, err := url.Parse(cfg.ProxyUpstream)
+	if err != nil {
+		return nil, err
+	}
+	if upstream.Scheme != "http" && upstream.Scheme != "https" || upstream.Host == "" {
+		return nil, fmt.Errorf("upstream %q must be an absolute http or https URL", cfg.ProxyUpstream)
+	}
+	return proxy.New(proxy.Config{
+		Upstream: upstream,
+		Latency:  cfg.ProxyLatency,
+		Jitter:   cfg.ProxyJitter,
+		Profile:  profile,
+	}), nil
+}
+
+// newTracer installs the tracer described by the configuration. It returns
+// nil when tracing is disabled.
+func newTracer(cfg *config.Config) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch cfg.TracingExporter {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		exporter = tracing.NewStdoutExporter(os.Stdout)
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(cfg.OTLPEndpoint, cfg.ServiceName)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q (want none, stdout or otlp)", cfg.TracingExporter)
+	}
+	tracer := tracing.NewTracer(cfg.ServiceName, exporter)
+	tracing.SetTracer(tracer)
+	return tracer, nil
+}
+
+// rateLimiterConfig builds the rate limits described by the configuration.
+// Without any limits the limiter lets everything through.
+func rateLimiterConfig(cfg *config.Config) (middleware.RateLimiterConfig, error) {
+	mode, err := middleware.ParseRejectMode(cfg.RateLimitMode)
+	if err != nil {
+		return middleware.RateLimiterConfig{}, err
+	}
+	routes, err := middleware.ParseRouteLimits(cfg.RateLimitRoutes)
+	if err != nil {
+		return middleware.RateLimiterConfig{}, err
+	}
+	var def middleware.Limit
+	if cfg.RateLimit > 0 {
+		def = middleware.Limit{Rate: cfg.RateLimit, Burst: max(cfg.RateBurst, 1)}
+	}
+	return middleware.RateLimiterConfig{
+		Default: def,
+		Routes:  routes,
+		KeyBy:   cfg.RateLimitKey,
+		Mode:    mode,
+	}, nil
+}
+
+// newAuthenticator builds the authenticator described by the configuration
+func newAuthenticator(cfg *config.Config, db *database.DB) (*auth.Authenticator, error) {
+	mode, err := auth.ParseFailureMode(cfg.AuthFailureMode)
+	if err != nil {
+		return nil, err
+	}
+	secret := []byte(cfg.AuthSecret)
+	if len(secret) == 0 {
+		// Tokens will not survive a restart, which is fine for a demo
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate auth secret: %w", err)
+		}
+	}
+	issuer := auth.NewIssuer(secret, cfg.AuthTokenTTL)
+	return auth.NewAuthenticator(issuer, db, mode, cfg.AuthGracePeriod), nil
+}
+
+// optionalQuirks names the quirks the configuration switches on beyond the
+// quirk profile, so that challenge mode can score them. The hidden quirks
+// of the expert level count when it is the profile or sandboxes can pick it.
+func optionalQuirks(cfg *config.Config) []string {
+	var names []string
+	if profile, _ := quirks.ByName(cfg.QuirkProfile); profile.Hidden || cfg.TenantKey != "" {
+		for _, q := range quirks.All() {
+			if q.Hidden {
+				names = append(names, q.Name)
+			}
+		}
+	}
+	if (cfg.RateLimit > 0 || cfg.RateLimitRoutes != "") && !strings.EqualFold(cfg.RateLimitMode, string(middleware.RejectHonest)) {
+		names = append(names, "rate-limit."+strings.ToLower(cfg.RateLimitMode))
+	}
+	if cfg.AuthRequired {
+		if !strings.EqualFold(cfg.AuthFailureMode, string(auth.FailHonest)) {
+			names = append(names, "auth."+strings.ToLower(cfg.AuthFailureMode))
+		}
+		if cfg.AuthGracePeriod > 0 {
+			names = append(names, "auth.expired-token-accepted")
+		}
+	}
+	return names
+}
+
+// ensureAdmin creates the "admin" user, or takes over an existing one, so
+// that somebody can log in and hand out editor and admin roles. Anybody can
+// sign up as "admin" before, so an existing account gets ADMIN_PASSWORD and
+// loses its API key rather than keeping the credentials of whoever made it.
+func ensureAdmin(db *database.DB, password string) error {
+	ctx := context.Background()
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = db.CreateUser(ctx, "admin", "admin@example.com", models.RoleAdmin, database.Credentials{PasswordHash: passwordHash})
+	if err != nil {
+		if _, lookupErr := db.GetUserByName(ctx, "admin"); lookupErr != nil {
+			return err
+		}
+		slog.Info("admin user exists, resetting its credentials to ADMIN_PASSWORD")
+		return db.ResetUser(ctx, "admin", models.RoleAdmin, database.Credentials{PasswordHash: passwordHash})
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package strangeserver embeds the Strange Errors Server in other programs,
+// mostly in the test suites of API clients that want to prove they cope with
+// 777s, a GOAT method and everything else the server gets wrong.
+//
+//	func TestClient(t *testing.T) {
+//		srv := strangeserver.NewTestServer(t, strangeserver.WithQuirkProfile("strange"))
+//		client := myapi.New(srv.URL)
+//		...
+//		srv.AssertQuirk("articles.list.success")
+//	}
+package strangeserver
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/database"
+	"strange-errors-server/internal/handlers"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/seed"
+	"strange-errors-server/internal/traffic"
+)
+
+// Roles a seeded user can have
+const (
+	RoleReader = models.RoleReader
+	RoleEditor = models.RoleEditor
+	RoleAdmin  = models.RoleAdmin
+)
+
+// Article is an article the database is seeded with
+type Article struct {
+	Title   string
+	Content string
+}
+
+// User is a user the database is seeded with. Role defaults to RoleReader.
+type User struct {
+	Name     string
+	Email    string
+	Role     string
+	Password string
+}
+
+// Seed is the data the database starts with, and returns to on Reset.
+// Articles, if not nil, replace the two built-in test articles.
+type Seed struct {
+	Articles []Article
+	Users    []User
+}
+
+// Quirk is a quirk that changed a recorded response
+type Quirk struct {
+	Name     string
+	Intended int
+	Actual   int
+}
+
+// Exchange is one recorded request/response pair
+type Exchange struct {
+	RequestID      string
+	StartedAt      time.Time
+	Method         string
+	Path           string
+	Query          string
+	Route          string
+	RequestHeaders http.Header
+	RequestBody    []byte
+	Status         int
+	// IntendedStatus is the status an honest server would have sent
+	IntendedStatus  int
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	Quirks          []Quirk
+}
+
+// options collects what the Option functions set
+type options struct {
+	dbPath        string
+	profile       string
+	seed          *Seed
+	clock         func() time.Time
+	randSeed      *uint64
+	authRequired  bool
+	trafficBuffer int
+}
+
+// Option configures a Server
+type Option func(*options)
+
+// WithDatabase stores the data in a SQLite database at path instead of in
+// memory. The file is created if needed and never deleted, not even by an
+// enraged GOAT. The data already in it is kept unless WithSeed is given too,
+// or Reset is called: both empty the database first.
+func WithDatabase(path string) Option {
+	return func(o *options) { o.dbPath = path }
+}
+
+// WithQuirkProfile selects a built-in quirk profile: "strange", the
+// default, "plausible", "subtle" or "honest", or a difficulty such as
+// "expert"
+func WithQuirkProfile(name string) Option {
+	return func(o *options) { o.profile = name }
+}
+
+// WithSeed sets the data the database starts with, replacing whatever it
+// held
+func WithSeed(seed Seed) Option {
+	return func(o *options) { o.seed = &seed }
+}
+
+// WithClock sets where the server gets the current time from. It decides
+// when tokens are issued and expire and when exchanges were recorded.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.clock = now }
+}
+
+// WithRandSeed seeds the randomness of the quirks, so that the order the
+// expert level shuffles articles into is the same on every run
+func WithRandSeed(seed uint64) Option {
+	return func(o *options) { o.randSeed = &seed }
+}
+
+// WithAuth makes article and user changes require a bearer token or API key
+func WithAuth(required bool) Option {
+	return func(o *options) { o.authRequired = required }
+}
+
+// WithTrafficBuffer sets how many exchanges are kept for assertions
+func WithTrafficBuffer(size int) Option {
+	return func(o *options) { o.trafficBuffer = size }
+}
+
+// Server is an embedded Strange Errors Server. It does not listen on
+// anything by itself: mount Handler wherever you like, or use NewTestServer.
+type Server struct {
+	db      *database.DB
+	api     *handlers.Handler
+	goat    *handlers.GoatHandler
+	traffic *traffic.Log
+	handler http.Handler
+	seed    Seed
+	// goatShutdown is set once the GOAT has tried to take the server down
+	goatShutdown atomic.Bool
+}
+
+// New creates a new Server instance
+func New(opts ...Option) (*Server, error) {
+	o := options{dbPath: ":memory:", trafficBuffer: 1000}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	profile, err := quirks.ByName(o.profile)
+	if err != nil {
+		return nil, err
+	}
+	db, err := database.New(o.dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to generate auth secret: %w", err)
+	}
+	issuer := auth.NewIssuer(secret, time.Hour)
+	if o.clock != nil {
+		issuer.SetClock(o.clock)
+	}
+	authenticator := auth.NewAuthenticator(issuer, db, auth.FailHonest, 0)
+
+	s := &Server{db: db, api: handlers.New(db), goat: handlers.NewGoatHandler(), traffic: traffic.NewLog(o.trafficBuffer)}
+	if o.randSeed != nil {
+		s.api.SetRand(mathrand.New(mathrand.NewPCG(*o.randSeed, 0)))
+	}
+	if o.seed != nil {
+		s.seed = *o.seed
+	}
+	if o.seed != nil {
+		if err := s.applySeed(context.Background()); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	// The GOAT takes the server down by recording it, never by exiting, and
+	// only ever deletes a database file it was given
+	s.goat.SetShutdownFunc(func() { s.goatShutdown.Store(true) })
+	s.goat.SetDatabasePath("")
+
+	router := handlers.NewRouter(s.api, s.goat, handlers.NewAuthHandler(db, authenticator, o.authRequired))
+	router.SetQuirkProfile(profile)
+
+	s.traffic.SetFullCapture(true)
+	if o.clock != nil {
+		s.traffic.SetClock(o.clock)
+	}
+	router.Use(traffic.Record(s.traffic, handlers.LocalPaths...))
+	reportHandler := handlers.NewReportHandler(s.traffic)
+	router.AddRoute(handlers.Route{Method: "GET", Pattern: "/api/reports/classification", Handler: reportHandler.ClassificationHandler})
+
+	s.handler = router.SetupRoutes()
+	return s, nil
+}
+
+// Handler returns the server's http.Handler
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Close cancels the deletes the server has confirmed but not done yet and
+// closes the database
+func (s *Server) Close() error {
+	s.api.Close()
+	return s.db.Close()
+}
+
+// Reset returns the server to its initial state: the seed data, a calm
+// GOAT and no recorded traffic. The database is emptied first, also one
+// given to WithDatabase.
+func (s *Server) Reset() error {
+	if err := s.applySeed(context.Background()); err != nil {
+		return err
+	}
+	s.goat.SetCalls(0)
+	s.goatShutdown.Store(false)
+	s.traffic.Reset()
+	return nil
+}
+
+// GoatStage returns how many times the GOAT has been called
+func (s *Server) GoatStage() int {
+	return s.goat.Calls()
+}
+
+// SetGoatStage makes the GOAT believe it has been called n times, so that
+// the next GOAT request gets the response of call n+1: SetGoatStage(3)
+// skips straight to the enraged GOAT
+func (s *Server) SetGoatStage(n int) {
+	s.goat.SetCalls(n)
+}
+
+// GoatShutdown reports whether the GOAT has tried to take the server down.
+// It does so a second after answering its fifth call.
+func (s *Server) GoatShutdown() bool {
+	return s.goatShutdown.Load()
+}
+
+// Exchanges returns the recorded traffic, oldest first. Requests for the
+// server's own pages, such as /metrics, /swagger and /api/reports, are not
+// recorded.
+func (s *Server) Exchanges() []Exchange {
+	recorded := s.traffic.Exchanges()
+	out := make([]Exchange, len(recorded))
+	for i, e := range recorded {
+		out[i] = Exchange{
+			RequestID:       e.RequestID,
+			StartedAt:       e.StartedAt,
+			Method:          e.Method,
+			Path:            e.Path,
+			Query:           e.Query,
+			Route:           e.Route,
+			RequestHeaders:  e.RequestHeaders,
+			RequestBody:     e.RequestBody,
+			Status:          e.Status,
+			IntendedStatus:  e.IntendedStatus(),
+			ResponseHeaders: e.ResponseHeaders,
+			ResponseBody:    e.ResponseBody,
+		}
+		for _, q := range e.Quirks {
+			out[i].Quirks = append(out[i].Quirks, Quirk{Name: q.Name, Intended: q.Intended, Actual: q.Actual})
+		}
+	}
+	return out
+}
+
+// applySeed empties the database and fills it with the seed data
+func (s *Server) applySeed(ctx context.Context) error {
+	data := &seed.Data{}
+	if s.seed.Articles != nil {
+		data.Articles = []seed.Article{}
+	}
+	for _, article := range s.seed.Articles {
+		data.Articles = append(data.Articles, seed.Article{Title: article.Title, Content: article.Content})
+	}
+	for _, user := range s.seed.Users {
+		data.Users = append(data.Users, seed.User{Name: user.Name, Email: user.Email, Role: user.Role, Password: user.Password})
+	}
+	return seed.Apply(ctx, s.db, data, true)
+}
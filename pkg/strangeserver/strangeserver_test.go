@@ -0,0 +1,274 @@
+package strangeserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// articles decodes the articles of a GET /api/articles response
+func articles(t *testing.T, resp Response) []Article {
+	t.Helper()
+	var body struct {
+		Data []Article `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatalf("articles response is not JSON: %v: %s", err, resp.Body)
+	}
+	return body.Data
+}
+
+// login returns an Authorization header value for a seeded user
+func login(ts *TestServer, name, password string) string {
+	ts.t.Helper()
+	resp := ts.Do("POST", "/api/login", fmt.Sprintf(`{"name":%q,"password":%q}`, name, password))
+	if resp.Status != 200 {
+		ts.t.Fatalf("login %s: status %d: %s", name, resp.Status, resp.Body)
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		ts.t.Fatalf("login %s: %v", name, err)
+	}
+	return "Bearer " + body.Token
+}
+
+func TestWithQuirkProfile(t *testing.T) {
+	strange := NewTestServer(t)
+	if resp := strange.Do("GET", "/api/articles", ""); resp.Status != 777 {
+		t.Errorf("default profile: status %d, want 777", resp.Status)
+	}
+	strange.AssertRecorded("GET", "/api/articles", 777)
+	strange.AssertQuirk("articles.list.success")
+	if e := strange.LastExchange("GET", "/api/articles"); e.IntendedStatus != 200 {
+		t.Errorf("intended status %d, want 200", e.IntendedStatus)
+	}
+
+	honest := NewTestServer(t, WithQuirkProfile("honest"))
+	if resp := honest.Do("GET", "/api/articles", ""); resp.Status != 200 {
+		t.Errorf("honest profile: status %d, want 200", resp.Status)
+	}
+	honest.AssertRecorded("GET", "/api/articles", 200)
+	honest.AssertNoQuirks()
+
+	if _, err := New(WithQuirkProfile("no-such-profile")); err == nil {
+		t.Error("New accepted an unknown quirk profile")
+	}
+}
+
+func TestWithSeed(t *testing.T) {
+	ts := NewTestServer(t, WithQuirkProfile("honest"), WithSeed(Seed{
+		Articles: []Article{{Title: "Seeded", Content: "From the test"}},
+		Users:    []User{{Name: "ed", Email: "ed@example.com", Role: RoleEditor, Password: "secret"}},
+	}))
+
+	got := articles(t, ts.Do("GET", "/api/articles", ""))
+	if len(got) != 1 || got[0].Title != "Seeded" {
+		t.Errorf("articles %+v, want only the seeded one", got)
+	}
+	login(ts, "ed", "secret")
+
+	// An empty, non-nil list leaves the database without articles
+	empty := NewTestServer(t, WithQuirkProfile("honest"), WithSeed(Seed{Articles: []Article{}}))
+	if got := articles(t, empty.Do("GET", "/api/articles", "")); len(got) != 0 {
+		t.Errorf("articles %+v, want none", got)
+	}
+}
+
+func TestWithAuth(t *testing.T) {
+	seed := WithSeed(Seed{Users: []User{{Name: "ed", Email: "ed@example.com", Role: RoleEditor, Password: "secret"}}})
+
+	open := NewTestServer(t, WithQuirkProfile("honest"), seed)
+	if resp := open.Do("POST", "/api/article", `{"title":"T","content":"C"}`); resp.Status != 201 {
+		t.Errorf("without auth: status %d, want 201", resp.Status)
+	}
+
+	ts := NewTestServer(t, WithQuirkProfile("honest"), seed, WithAuth(true))
+	if resp := ts.Do("POST", "/api/article", `{"title":"T","content":"C"}`); resp.Status != 401 {
+		t.Errorf("anonymous: status %d, want 401", resp.Status)
+	}
+	token := login(ts, "ed", "secret")
+	if resp := ts.Do("POST", "/api/article", `{"title":"T","content":"C"}`, "Authorization", token); resp.Status != 201 {
+		t.Errorf("as an editor: status %d, want 201", resp.Status)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	ts := NewTestServer(t, WithClock(func() time.Time { return now }), WithSeed(Seed{
+		Users: []User{{Name: "ed", Email: "ed@example.com", Role: RoleEditor, Password: "secret"}},
+	}))
+
+	resp := ts.Do("POST", "/api/login", `{"name":"ed","password":"secret"}`)
+	var body struct {
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatalf("login: %v: %s", err, resp.Body)
+	}
+	if want := now.Add(time.Hour).Format(time.RFC3339); body.ExpiresAt != want {
+		t.Errorf("token expires at %s, want %s", body.ExpiresAt, want)
+	}
+	if e := ts.LastExchange("POST", "/api/login"); !e.StartedAt.Equal(now) {
+		t.Errorf("exchange started at %s, want %s", e.StartedAt, now)
+	}
+}
+
+func TestWithRandSeed(t *testing.T) {
+	seed := make([]Article, 8)
+	for i := range seed {
+		seed[i] = Article{Title: fmt.Sprintf("Article %d", i), Content: "C"}
+	}
+	order := func() string {
+		ts := NewTestServer(t, WithQuirkProfile("subtle"), WithSeed(Seed{Articles: seed}), WithRandSeed(42))
+		var titles []string
+		for _, article := range articles(t, ts.Do("GET", "/api/articles", "")) {
+			titles = append(titles, article.Title)
+		}
+		return strings.Join(titles, ", ")
+	}
+
+	if first, second := order(), order(); first != second {
+		t.Errorf("articles in order %s, then %s with the same seed", first, second)
+	}
+}
+
+func TestWithTrafficBuffer(t *testing.T) {
+	ts := NewTestServer(t, WithTrafficBuffer(2))
+	ts.Do("GET", "/api/health-check", "")
+	ts.Do("GET", "/api/articles", "")
+	ts.Do("GET", "/api/articles", "")
+
+	ts.AssertRequests(2)
+	for _, e := range ts.Exchanges() {
+		if e.Path != "/api/articles" {
+			t.Errorf("%s %s is still recorded, want the oldest exchange dropped", e.Method, e.Path)
+		}
+	}
+
+	// Local paths are not recorded at all
+	ts.Do("GET", "/openapi.json", "")
+	ts.AssertRequests(2)
+}
+
+func TestWithDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strange.db")
+	ts := NewTestServer(t, WithDatabase(path))
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("database file: %v", err)
+	}
+
+	ts.SetGoatStage(3)
+	if resp := ts.Do("GOAT", "/api/health-check", ""); resp.Status != 500 {
+		t.Errorf("enraged GOAT: status %d, want 500", resp.Status)
+	}
+	if ts.GoatStage() != 4 {
+		t.Errorf("GOAT stage %d, want 4", ts.GoatStage())
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the GOAT deleted the database file: %v", err)
+	}
+	if resp := ts.Do("GET", "/api/articles", ""); resp.Status != 777 {
+		t.Errorf("after the GOAT: status %d, want the server still answering", resp.Status)
+	}
+}
+
+func TestWithDatabaseKeepsData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strange.db")
+	first := NewTestServer(t, WithQuirkProfile("honest"), WithDatabase(path))
+	if resp := first.Do("POST", "/api/article", `{"title":"Kept","content":"C"}`); resp.Status != 201 {
+		t.Fatalf("create: status %d: %s", resp.Status, resp.Body)
+	}
+
+	reopened := NewTestServer(t, WithQuirkProfile("honest"), WithDatabase(path))
+	if got := articles(t, reopened.Do("GET", "/api/articles", "")); len(got) != 3 {
+		t.Errorf("articles %+v, want the two built-in ones and the one created before", got)
+	}
+
+	seeded := NewTestServer(t, WithQuirkProfile("honest"), WithDatabase(path), WithSeed(Seed{Articles: []Article{}}))
+	if got := articles(t, seeded.Do("GET", "/api/articles", "")); len(got) != 0 {
+		t.Errorf("articles %+v, want WithSeed to replace them", got)
+	}
+}
+
+func TestSetGoatStage(t *testing.T) {
+	ts := NewTestServer(t)
+	for _, tt := range []struct {
+		stage  int
+		status int
+	}{
+		{0, 200},
+		{1, 400},
+		{2, 400},
+		{3, 500},
+	} {
+		ts.SetGoatStage(tt.stage)
+		if resp := ts.Do("GOAT", "/api/health-check", ""); resp.Status != tt.status {
+			t.Errorf("after SetGoatStage(%d): status %d, want %d", tt.stage, resp.Status, tt.status)
+		}
+	}
+	if ts.GoatShutdown() {
+		t.Error("the GOAT shut the server down before its fifth call")
+	}
+}
+
+func TestReset(t *testing.T) {
+	ts := NewTestServer(t, WithQuirkProfile("honest"))
+	before := articles(t, ts.Do("GET", "/api/articles", ""))
+	ts.Do("POST", "/api/article", `{"title":"T","content":"C"}`)
+	ts.SetGoatStage(2)
+
+	ts.Reset()
+	ts.AssertRequests(0)
+	if ts.GoatStage() != 0 {
+		t.Errorf("GOAT stage %d after Reset, want 0", ts.GoatStage())
+	}
+	if after := articles(t, ts.Do("GET", "/api/articles", "")); len(after) != len(before) {
+		t.Errorf("%d articles after Reset, want the %d seeded ones", len(after), len(before))
+	}
+}
+
+// failures records what the Assert helpers report instead of failing the test
+type failures struct {
+	testing.TB
+	errors []string
+}
+
+func (f *failures) Helper() {}
+
+func (f *failures) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertHelpersFail(t *testing.T) {
+	f := &failures{TB: t}
+	ts := NewTestServer(f)
+	ts.Do("GET", "/api/articles", "")
+
+	for _, tt := range []struct {
+		name   string
+		assert func()
+		fails  bool
+	}{
+		{"AssertRecorded with the actual status", func() { ts.AssertRecorded("GET", "/api/articles", 777) }, false},
+		{"AssertRecorded with another status", func() { ts.AssertRecorded("GET", "/api/articles", 200) }, true},
+		{"AssertRequests with the actual count", func() { ts.AssertRequests(1) }, false},
+		{"AssertRequests with another count", func() { ts.AssertRequests(2) }, true},
+		{"AssertQuirk with an applied quirk", func() { ts.AssertQuirk("articles.list.success") }, false},
+		{"AssertQuirk with a quirk never applied", func() { ts.AssertQuirk("article.create.success") }, true},
+		{"AssertNoQuirks after a quirk", ts.AssertNoQuirks, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f.errors = nil
+			tt.assert()
+			if failed := len(f.errors) > 0; failed != tt.fails {
+				t.Errorf("failed %v (%q), want %v", failed, f.errors, tt.fails)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package strangeserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestServer is a Server listening on a local port for the duration of a
+// test, with helpers that fail the test instead of returning errors
+type TestServer struct {
+	*Server
+	// URL is the base URL of the server, e.g. "http://127.0.0.1:51234"
+	URL string
+
+	t    testing.TB
+	http *httptest.Server
+}
+
+// Response is a response read in full
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// NewTestServer starts a Server for the test t. It is stopped and its
+// database closed when the test ends.
+func NewTestServer(t testing.TB, opts ...Option) *TestServer {
+	t.Helper()
+	srv, err := New(opts...)
+	if err != nil {
+		t.Fatalf("strangeserver: %v", err)
+	}
+	ts := &TestServer{Server: srv, t: t, http: httptest.NewServer(srv.Handler())}
+	ts.URL = ts.http.URL
+	t.Cleanup(func() {
+		ts.http.Close()
+		srv.Close()
+	})
+	return ts
+}
+
+// Client returns an HTTP client for the server
+func (ts *TestServer) Client() *http.Client {
+	return ts.http.Client()
+}
+
+// Reset returns the server to its initial state, failing the test if it cannot
+func (ts *TestServer) Reset() {
+	ts.t.Helper()
+	if err := ts.Server.Reset(); err != nil {
+		ts.t.Fatalf("strangeserver: reset: %v", err)
+	}
+}
+
+// Do sends a request with an optional JSON body and reads the response.
+// headers are name/value pairs, e.g. "Authorization", "Bearer ...".
+func (ts *TestServer) Do(method, path, body string, headers ...string) Response {
+	ts.t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		ts.t.Fatalf("strangeserver: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		ts.t.Fatalf("strangeserver: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatalf("strangeserver: %s %s: reading body: %v", method, path, err)
+	}
+	return Response{Status: resp.StatusCode, Header: resp.Header, Body: data}
+}
+
+// LastExchange returns the most recent recorded exchange for method and
+// path, failing the test if there is none
+func (ts *TestServer) LastExchange(method, path string) Exchange {
+	ts.t.Helper()
+	exchanges := ts.Exchanges()
+	for i := len(exchanges) - 1; i >= 0; i-- {
+		if exchanges[i].Method == method && exchanges[i].Path == path {
+			return exchanges[i]
+		}
+	}
+	ts.t.Fatalf("strangeserver: no %s %s was recorded", method, path)
+	return Exchange{}
+}
+
+// AssertRecorded checks that the most recent exchange for method and path
+// was answered with status
+func (ts *TestServer) AssertRecorded(method, path string, status int) {
+	ts.t.Helper()
+	if e := ts.LastExchange(method, path); e.Status != status {
+		ts.t.Errorf("strangeserver: %s %s answered %d, want %d", method, path, e.Status, status)
+	}
+}
+
+// AssertRequests checks how many exchanges were recorded
+func (ts *TestServer) AssertRequests(n int) {
+	ts.t.Helper()
+	if got := len(ts.Exchanges()); got != n {
+		ts.t.Errorf("strangeserver: %d requests were recorded, want %d", got, n)
+	}
+}
+
+// AssertQuirk checks that the quirk name changed at least one recorded response
+func (ts *TestServer) AssertQuirk(name string) {
+	ts.t.Helper()
+	for _, e := range ts.Exchanges() {
+		for _, q := range e.Quirks {
+			if q.Name == name {
+				return
+			}
+		}
+	}
+	ts.t.Errorf("strangeserver: quirk %s was never applied", name)
+}
+
+// AssertNoQuirks checks that every recorded response was the honest one
+func (ts *TestServer) AssertNoQuirks() {
+	ts.t.Helper()
+	for _, e := range ts.Exchanges() {
+		for _, q := range e.Quirks {
+			ts.t.Errorf("strangeserver: %s %s: quirk %s answered %d instead of %d",
+				e.Method, e.Path, q.Name, q.Actual, q.Intended)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/config"
+	"strange-errors-server/internal/handlers"
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/mock"
+	"strange-errors-server/internal/proxy"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/tenant"
+)
+
+// reloadableSettings can change while the server is running: the quirk
+// profile, the rate limits and the faults the server plants. Everything
+// else needs a restart.
+var reloadableSettings = []string{
+	"quirk-profile",
+	"rate-limit", "rate-burst", "rate-limit-key", "rate-limit-mode", "rate-limit-routes",
+	"auth-failure-mode", "idor-bug",
+	"proxy-latency", "proxy-jitter",
+}
+
+// watchInterval is how often the config file is checked for changes
+const watchInterval = 2 * time.Second
+
+// liveConfig applies configuration changes to a running server. The
+// listener is left alone, so no connection is dropped.
+type liveConfig struct {
+	loader        *config.Loader
+	current       *config.Config
+	router        *handlers.Router
+	limiter       *middleware.RateLimiter
+	authenticator *auth.Authenticator
+	authHandler   *handlers.AuthHandler
+	upstream      *proxy.Proxy                       // nil unless proxying
+	mocker        *mock.Mock                         // nil unless mocking
+	tenants       *tenant.Manager[*handlers.Sandbox] // nil unless there are sandboxes
+}
+
+// watch reloads the configuration on SIGHUP and whenever the config file
+// changes, until ctx is done
+func (lc *liveConfig) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	changed := make(chan struct{}, 1)
+	if file := lc.loader.File(); file != "" {
+		go config.Watch(ctx, file, watchInterval, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			lc.reload("SIGHUP")
+		case <-changed:
+			lc.reload("config file changed")
+		}
+	}
+}
+
+// reload loads the configuration again and applies what can change. An
+// invalid configuration is rejected as a whole and the current one stays.
+func (lc *liveConfig) reload(reason string) {
+	cfg, err := lc.loader.Load()
+	if err != nil {
+		slog.Error("configuration reload failed, keeping the current configuration", "reason", reason, "error", err)
+		return
+	}
+
+	var applied, skipped []string
+	for _, key := range config.Changed(lc.current, cfg) {
+		if slices.Contains(reloadableSettings, key) {
+			applied = append(applied, key)
+		} else {
+			skipped = append(skipped, key)
+		}
+	}
+	if len(skipped) > 0 {
+		slog.Warn("some changed settings only take effect after a restart", "settings", skipped)
+	}
+	if len(applied) == 0 {
+		slog.Info("configuration reloaded, nothing to apply", "reason", reason)
+		return
+	}
+
+	// Validation already accepted these, so parsing cannot fail
+	profile, _ := quirks.ByName(cfg.QuirkProfile)
+	previous := lc.router.QuirkProfile()
+	lc.router.SetQuirkProfile(profile)
+	if lc.upstream != nil {
+		lc.upstream.SetProfile(profile)
+		lc.upstream.SetLatency(cfg.ProxyLatency, cfg.ProxyJitter)
+	}
+	if lc.mocker != nil {
+		lc.mocker.SetProfile(profile)
+	}
+	limiterConfig, _ := rateLimiterConfig(cfg)
+	lc.limiter.Reconfigure(limiterConfig)
+	mode, _ := auth.ParseFailureMode(cfg.AuthFailureMode)
+	lc.authenticator.SetFailureMode(mode)
+	lc.authHandler.SetOwnershipChecks(!cfg.IDORBug)
+	if lc.tenants != nil {
+		// Sandboxes follow the server's profile unless their tenant picked
+		// another one
+		lc.tenants.Each(func(sandbox *handlers.Sandbox) {
+			if sandbox.Router().QuirkProfile() == previous {
+				sandbox.Router().SetQuirkProfile(profile)
+			}
+			sandbox.SetAuthSettings(mode, !cfg.IDORBug)
+		})
+	}
+
+	// Keep the settings that were not applied, so that they are reported
+	// again until the restart
+	lc.current.CopyFrom(cfg, applied...)
+	slog.Info("configuration reloaded", "reason", reason, "applied", applied)
+}
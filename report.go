@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"strange-errors-server/internal/report"
+)
+
+// runReport implements "strange-errors-server report": it fetches the
+// classification of a running server's recorded traffic and prints it
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	url := fs.String("url", "http://localhost:3000", "base URL of a running server")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(*url, "/") + "/api/reports/classification")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "report: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var classification report.Classification
+	if err := json.NewDecoder(resp.Body).Decode(&classification); err != nil {
+		fmt.Fprintf(os.Stderr, "report: unexpected response (%s): %v\n", resp.Status, err)
+		return 1
+	}
+
+	report.WriteText(os.Stdout, classification)
+	return 0
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"strange-errors-server/internal/auth"
+	"strange-errors-server/internal/config"
+	"strange-errors-server/internal/database"
+	"strange-errors-server/internal/handlers"
+	"strange-errors-server/internal/middleware"
+	"strange-errors-server/internal/models"
+	"strange-errors-server/internal/quirks"
+	"strange-errors-server/internal/seed"
+	"strange-errors-server/internal/tenant"
+)
+
+// newTenants gives every tenant a sandbox of its own: a database seeded
+// from the same template, its own handlers, GOAT and quirk profile. New
+// sandboxes start with the quirk profile router has at the time and share
+// the rate limiter.
+func newTenants(cfg *config.Config, db *database.DB, router *handlers.Router, limiter *middleware.RateLimiter) (*tenant.Manager[*handlers.Sandbox], error) {
+	key, err := tenant.ParseKey(cfg.TenantKey)
+	if err != nil {
+		return nil, err
+	}
+	template, err := sandboxTemplate(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TenantDir != "" {
+		if err := os.MkdirAll(cfg.TenantDir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	var tenants *tenant.Manager[*handlers.Sandbox]
+	tenants = tenant.NewManager(key, func(id string) (*handlers.Sandbox, error) {
+		// The GOAT of a sandbox only takes its own sandbox down
+		return newSandbox(cfg, template, router.QuirkProfile(), limiter, id, func() { tenants.Remove(id) })
+	})
+	tenants.SetIdleTimeout(cfg.TenantIdleTimeout)
+	tenants.SetLimit(cfg.TenantMax)
+	return tenants, nil
+}
+
+// sandboxTemplate returns the data every sandbox starts with: the tenant
+// seed file, or else a copy of the shared database as it is at startup.
+// Passwords are hashed once here rather than for every sandbox.
+func sandboxTemplate(cfg *config.Config, db *database.DB) (*seed.Data, error) {
+	if cfg.TenantSeed == "" {
+		return seed.Export(context.Background(), db)
+	}
+	data, err := seed.Load(cfg.TenantSeed)
+	if err != nil {
+		return nil, err
+	}
+	for i, user := range data.Users {
+		if user.Password == "" {
+			continue
+		}
+		if data.Users[i].PasswordHash, err = auth.HashPassword(user.Password); err != nil {
+			return nil, err
+		}
+		data.Users[i].Password = ""
+	}
+	if cfg.AdminPassword != "" && !slices.ContainsFunc(data.Users, func(u seed.User) bool { return u.Name == "admin" }) {
+		hash, err := auth.HashPassword(cfg.AdminPassword)
+		if err != nil {
+			return nil, err
+		}
+		data.Users = append(data.Users, seed.User{Name: "admin", Email: "admin@example.com", Role: models.RoleAdmin, PasswordHash: hash})
+	}
+	return data, nil
+}
+
+// newSandbox creates the sandbox of tenant id. Its database lives in
+// memory unless there is a tenant directory.
+func newSandbox(cfg *config.Config, template *seed.Data, profile *quirks.Profile, limiter *middleware.RateLimiter, id string, shutdown func()) (*handlers.Sandbox, error) {
+	path := ""
+	if cfg.TenantDir != "" {
+		path = filepath.Join(cfg.TenantDir, id+".db")
+		// Left behind by a crash; the sandbox starts over
+		os.Remove(path)
+	}
+	dbPath := path
+	if dbPath == "" {
+		dbPath = ":memory:"
+	}
+	db, err := database.New(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := seed.Apply(context.Background(), db, template, true); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to seed sandbox %s: %w", id, err)
+	}
+	authenticator, err := newAuthenticator(cfg, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	goatHandler := handlers.NewGoatHandler()
+	if path != "" {
+		goatHandler.SetDatabasePath(path)
+	} else {
+		goatHandler.SetDestroyFunc(func() error { return db.Clear(context.Background()) })
+	}
+	goatHandler.SetShutdownFunc(shutdown)
+	authHandler := handlers.NewAuthHandler(db, authenticator, cfg.AuthRequired)
+	authHandler.SetOwnershipChecks(!cfg.IDORBug)
+
+	router := handlers.NewRouter(handlers.New(db), goatHandler, authHandler)
+	router.SetQuirkProfile(profile)
+	router.SetRateLimiter(limiter)
+	return handlers.NewSandbox(router, db, path), nil
+}